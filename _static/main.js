@@ -209,6 +209,21 @@ function onPanelAuxClick(evt, panelIdx, pOffX, pOffY, langs, zoomDiv) {
     }
 }
 
+function acceptTextAreaSugg(panelIdx, x, y, w, h) {
+    const pid = "p" + panelIdx;
+    for (let ridx = 0; ridx < numImagePanelTextAreas; ridx++) {
+        const trXy = document.getElementById(pid + "t" + ridx + "rxy"), trWh = document.getElementById(pid + "t" + ridx + "rwh");
+        const trW = parseInt(trWh.value.split(',')[0]), trH = parseInt(trWh.value.split(',')[1]);
+        if ((isNaN(trW) || (trW == 0)) && (isNaN(trH) || (trH == 0))) {
+            trXy.value = x + "," + y;
+            trWh.value = w + "," + h;
+            doPostBack(pid + "save");
+            return;
+        }
+    }
+    alert("All " + numImagePanelTextAreas + " text-rect editors of this panel are already in use.");
+}
+
 function toggleScanOptsPane(curScanDev) {
     var divs = document.getElementsByClassName("scandevopts");
     if (divs && divs.length)
@@ -233,6 +248,54 @@ function kickOffScanJob() {
     doPostBack('');
 }
 
+function kickOffScanPreview() {
+    const btn = $.scanpreviewbtn;
+    btn.disabled = 'disabled';
+    btn.innerText = 'Wait...';
+    $.scanpreview.value = '1';
+    doPostBack('');
+}
+
+// px of the (possibly css-scaled) preview img to scan-bed mm at the preview's dpi, and back
+function scanPreviewPxToMm(px, dpi) {
+    return Math.round(10 * px * ($.scanpreviewimg.naturalWidth / $.scanpreviewimg.width) * 25.4 / dpi) / 10;
+}
+
+function scanPreviewMmToPx(mm, dpi) {
+    return mm * dpi / 25.4 / ($.scanpreviewimg.naturalWidth / $.scanpreviewimg.width);
+}
+
+function scanPreviewCropShow(dpi) {
+    const ltwh = $.scancrop.value.split(',').map(parseFloat), div = $.scanpreviewcrop;
+    if (ltwh.length != 4 || ltwh.some(isNaN)) {
+        div.style.display = 'none';
+        return;
+    }
+    div.style.display = 'block';
+    div.style.left = scanPreviewMmToPx(ltwh[0], dpi) + 'px';
+    div.style.top = scanPreviewMmToPx(ltwh[1], dpi) + 'px';
+    div.style.width = scanPreviewMmToPx(ltwh[2], dpi) + 'px';
+    div.style.height = scanPreviewMmToPx(ltwh[3], dpi) + 'px';
+    $.scancroptext.innerText = $.scancrop.value;
+}
+
+function scanPreviewCropStart(evt, dpi) {
+    evt.preventDefault();
+    const img = $.scanpreviewimg, x0 = evt.offsetX, y0 = evt.offsetY;
+    const onMove = (e) => {
+        const rect = img.getBoundingClientRect();
+        const x1 = Math.max(0, Math.min(img.width, e.clientX - rect.left)), y1 = Math.max(0, Math.min(img.height, e.clientY - rect.top));
+        $.scancrop.value = [Math.min(x0, x1), Math.min(y0, y1), Math.abs(x1 - x0), Math.abs(y1 - y0)].map((px) => scanPreviewPxToMm(px, dpi)).join(',');
+        scanPreviewCropShow(dpi);
+    };
+    const onUp = () => {
+        document.removeEventListener('mousemove', onMove);
+        document.removeEventListener('mouseup', onUp);
+    };
+    document.addEventListener('mousemove', onMove);
+    document.addEventListener('mouseup', onUp);
+}
+
 function addBwtPreviewLinks(sheetVerSrcFilePath) {
     $.previewbwtlinks.innerHTML = '';
     let nums = $.previewbwt.value.split(',');
@@ -267,3 +330,11 @@ function txtImp() {
         doPostBack('txtimpsel')
     }
 }
+
+function onPanelsTreeEditClick(evt, div, panelIdx, x, y, w, h) {
+    evt.stopPropagation();
+    $.ptreepidx.value = panelIdx;
+    $.ptreex.value = Math.round(x + (w * (evt.offsetX / div.clientWidth)));
+    $.ptreey.value = Math.round(y + (h * (evt.offsetY / div.clientHeight)));
+    doPostBack('ptreeop');
+}
@@ -9,22 +9,29 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var appMainActions = map[string]bool{}
 var AppMainActions = A{
-	"gen":  "Re-generate site",
-	"book": "Generate book",
-	"cfg":  "Edit cx.json",
-	"pngs": "Generate lettered PNGs",
+	"gen":       "Re-generate site",
+	"serve":     "Serve & live-preview site, re-generating on changes (command line only)",
+	"check":     "Check project for inconsistencies (without prepping)",
+	"book":      "Generate book",
+	"cfg":       "Edit cx.json",
+	"pngs":      "Generate lettered PNGs",
+	"translate": "Machine-translate missing texts into drafts (optional args: langs)",
+	"restore":   "List _txt.json snapshots, or roll back to one (arg: its number)",
 }
 
 var App struct {
 	StaticFilesDirPath string
 	Proj               Project
+	Report             Report
 	Gui                struct {
-		Exiting    bool
+		Exiting    atomic.Bool // polled by the background loops (inbox, PNG optimizing, serve, etc.)
 		BrowserPid int
 		State      struct {
 			Sel struct {
@@ -63,6 +70,9 @@ func appOnExit() {
 }
 
 func appMainAction(fromGui bool, name string, args map[string]bool) string {
+	if fromGui && name == "serve" { // blocks until Ctrl+C, and swaps out `App.Proj` on changes
+		return "Action 'serve' is for the command line only."
+	}
 	if appMainActions[name] {
 		return "Action '" + name + "' already in progress and not yet done."
 	}
@@ -72,10 +82,18 @@ func appMainAction(fromGui bool, name string, args map[string]bool) string {
 	switch name {
 	case "gen":
 		action = func(flags map[string]bool) { siteGen{}.genSite(fromGui, flags) }
+	case "serve":
+		action = siteServe
+	case "check":
+		action = projCheck
 	case "book":
 		action = makeBook
 	case "pngs":
 		action = makePngs
+	case "translate":
+		action = projTranslate
+	case "restore":
+		action = projRestore
 	default:
 		s := "Unknown action: '" + name + "', try one of these:"
 		for name, desc := range AppMainActions {
@@ -85,32 +103,60 @@ func appMainAction(fromGui bool, name string, args map[string]bool) string {
 	}
 
 	if fromGui {
-		go func() { defer func() { appMainActions[name] = false }(); action(args) }()
+		go func() {
+			defer func() { appMainActions[name] = false }()
+			defer App.Report.catch(name, nil, nil)
+			action(args)
+		}()
 		return "Action '" + name + "' kicked off. Progress printed to stdio."
 	}
-	action(args)
+	func() { defer App.Report.catch(name, nil, nil); action(args) }()
 	return ""
 }
 
 func appPrepWork(fromGui bool) {
+	appPrep.Lock()
 	App.Proj.allPrepsDone = false
+	appPrep.Unlock()
+	App.Report.reset("prep")
 	timedLogged("Reprocessing...", func() string {
+		var svs []*SheetVer
+		for _, series := range App.Proj.Series {
+			for _, chapter := range series.Chapters {
+				for _, sheet := range chapter.sheets {
+					for _, sv := range sheet.versions {
+						if !sv.prep.done {
+							svs = append(svs, sv)
+						}
+					}
+				}
+			}
+		}
+
 		var numjobs, numwork int
+		var mu sync.Mutex
+		broken := map[*SheetVer]bool{}
+		prepRun(svs, func(job *PrepJob) {
+			mu.Lock()
+			defer mu.Unlock()
+			if numjobs++; job.State == PrepFailed {
+				broken[job.Sv] = true
+			} else if job.DidWork {
+				App.Proj.save(false)
+				printLn(time.Now().Format("15:04:05")+"\t#"+itoa(1+numwork)+"\t"+job.Sv.FileName, "BW:", job.Sv.bwThreshold())
+				numwork = numwork + 1
+			}
+		})
+
 		for _, series := range App.Proj.Series {
 			for _, chapter := range series.Chapters {
+				var chapbroken []*SheetVer
 				hp_sv, hp_pidx := chapter.homePic()
 				for _, sheet := range chapter.sheets {
 					for _, sv := range sheet.versions {
-						if !sv.prep.done {
-							sv.prep.Lock()
-							if !sv.prep.done {
-								didwork := sv.ensurePrep(true, false)
-								if sv.prep.done, numjobs = true, numjobs+1; didwork {
-									printLn(time.Now().Format("15:04:05")+"\t#"+itoa(1+numwork)+"\t"+sv.FileName, "BW:", sv.bwThreshold())
-									numwork = numwork + 1
-								}
-							}
-							sv.prep.Unlock()
+						if broken[sv] {
+							chapbroken = append(chapbroken, sv)
+							continue
 						}
 						if num_panels, _ := sv.panelCount(); num_panels > 0 {
 							for pidx := 0; pidx < num_panels; pidx++ {
@@ -122,10 +168,13 @@ func appPrepWork(fromGui bool) {
 						}
 					}
 				}
+				chapter.removeSheetVers("prep", chapbroken...)
 			}
 		}
+		appPrep.Lock()
 		App.Proj.allPrepsDone = true
-		return "for " + itoa(numwork) + "/" + itoa(numjobs) + " reprocessing jobs"
+		appPrep.Unlock()
+		return "for " + itoa(numwork) + "/" + itoa(numjobs) + " reprocessing jobs" + sIf(len(broken) == 0, "", " ("+itoa(len(broken))+" broken sheets skipped)")
 	})
 	if fromGui && os.Getenv("NOOPT") == "" {
 		pngOptsLoop()
@@ -136,7 +185,7 @@ func pngOptsLoop() {
 	App.pngOptBusy = true
 	defer func() { App.pngOptBusy = false }()
 
-	for dirfs := os.DirFS("."); !App.Gui.Exiting; time.Sleep(15 * time.Minute) {
+	for dirfs := os.DirFS("."); !App.Gui.Exiting.Load(); time.Sleep(15 * time.Minute) {
 		dels := false
 		for k := range App.Proj.data.PngOpt {
 			if fileStat(k) == nil {
@@ -147,13 +196,13 @@ func pngOptsLoop() {
 		if dels {
 			App.Proj.save(false)
 		}
-		if App.Gui.Exiting {
+		if App.Gui.Exiting.Load() {
 			return
 		}
 
 		numdone, matches, totalsize, errexiting := 0, FilePathsSortingByFileSize{}, uint64(0), errors.New("exiting")
 		if err := fs.WalkDir(dirfs, ".", func(fspath string, dir fs.DirEntry, err error) error {
-			if App.Gui.Exiting {
+			if App.Gui.Exiting.Load() {
 				return errexiting
 			}
 			if fileinfo, err := os.Lstat(fspath); err == nil && (!fileinfo.IsDir()) &&
@@ -178,7 +227,7 @@ func pngOptsLoop() {
 		}
 		printLn("PNGOPT: found", len(matches), "("+itoa(numfullynew)+" new) PNGs (~"+itoa(int(totalsize/(1024*1024)))+"MB) to scrutinize...")
 		for _, pngfilename := range matches {
-			if App.Gui.Exiting {
+			if App.Gui.Exiting.Load() {
 				return
 			}
 			if pngOpt(pngfilename) {
@@ -210,7 +259,7 @@ func pngOpt(pngFilePath string) bool {
 		}
 		go cmd.Wait()
 		for ; cmd.ProcessState == nil; time.Sleep(time.Second) {
-			if App.Gui.Exiting {
+			if App.Gui.Exiting.Load() {
 				_ = cmd.Process.Kill()
 				_ = exec.Command("killall", "zopflipng").Run()
 				_ = exec.Command("killall", "pngbattle").Run()
@@ -241,6 +290,7 @@ func pngOpt(pngFilePath string) bool {
 			if known_bytexts {
 				App.Proj.data.Sv.textRects[newfilehash] = App.Proj.data.Sv.textRects[curfilehash]
 				delete(App.Proj.data.Sv.textRects, curfilehash)
+				App.Proj.txtJournalRelink(curfilehash, newfilehash)
 			}
 			if err := os.Rename(".ccache/"+svCacheDirNamePrefix+curfilehash, ".ccache/"+svCacheDirNamePrefix+newfilehash); err != nil {
 				printLn("MUST mv manually:", curfilehash, "to", newfilehash, "because:", err.Error())
@@ -265,7 +315,7 @@ func pngOpt(pngFilePath string) bool {
 			}
 			if msg := "relinked hash from " + curfilehash + " to " + newfilehash; os.Getenv("NOCRASH") == "" {
 				_ = exec.Command("beepintime", "1ns").Start()
-				App.Proj.save(os.Getenv("NOGUI") != "")
+				App.Proj.save(known_bytexts)
 				panic(msg + " — intentional crash, restart manually")
 			} else {
 				println(msg)
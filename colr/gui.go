@@ -127,13 +127,7 @@ func guiLoop() {
 		pos_in_img.X = int(float64(pos_in_img.X) * (float64(imgSize.Dx()) / float64(imgScreenPosRect.Dx())))
 		pos_in_img.Y = int(float64(pos_in_img.Y) * (float64(imgSize.Dy()) / float64(imgScreenPosRect.Dy())))
 	}
-	idxCurPanel = -1
-	for i, panelrect := range pageLayout.panels {
-		if pos_in_img.X >= panelrect.Min.X && pos_in_img.X <= panelrect.Max.X &&
-			pos_in_img.Y >= panelrect.Min.Y && pos_in_img.Y <= panelrect.Max.Y {
-			idxCurPanel = i
-		}
-	}
+	idxCurPanel = pageLayout.panelAt(pos_in_img)
 
 	if guiBrush.isRec {
 		if idxCurPanel != guiBrush.idxPanel {
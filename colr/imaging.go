@@ -163,6 +163,7 @@ func imgDstBrushPreview() {
 func imgSrcEnsurePanelBorders() {
 	factor := float64(pageLayout.Page.Dx()) / float64(imgSrc[0].Rect.Dx())
 	pageLayout.panels = make([]image.Rectangle, len(pageLayout.Panels))
+	pageLayout.polys = make([][]image.Point, len(pageLayout.Panels))
 	for i, panelrect := range pageLayout.Panels {
 		pageLayout.panels[i] = image.Rect(
 			int(float64(panelrect.Min.X)/factor),
@@ -170,24 +171,53 @@ func imgSrcEnsurePanelBorders() {
 			int(float64(panelrect.Max.X)/factor),
 			int(float64(panelrect.Max.Y)/factor),
 		)
+		if i < len(pageLayout.Polys) {
+			for _, pt := range pageLayout.Polys[i] {
+				pageLayout.polys[i] = append(pageLayout.polys[i], image.Pt(int(float64(pt.X)/factor), int(float64(pt.Y)/factor)))
+			}
+		}
 	}
 	for x := 0; x < imgSize.Dx(); x++ {
 		for y := 0; y < imgSize.Dy(); y++ {
-			is_pixel_in_any_panel := false
-			for _, panelrect := range pageLayout.panels {
-				if x >= panelrect.Min.X && x <= panelrect.Max.X &&
-					y >= panelrect.Min.Y && y <= panelrect.Max.Y {
-					is_pixel_in_any_panel = true
-					break
-				}
-			}
-			if !is_pixel_in_any_panel {
+			if pageLayout.panelAt(image.Pt(x, y)) < 0 {
 				imgSrc[0].SetRGBA(x, y, color.RGBA{A: 255})
 			}
 		}
 	}
 }
 
+// the index of the top-most panel containing pt, or -1
+func (me *PageLayout) panelAt(pt image.Point) (idx int) {
+	idx = -1
+	for i, panelrect := range me.panels {
+		if pt.X >= panelrect.Min.X && pt.X <= panelrect.Max.X &&
+			pt.Y >= panelrect.Min.Y && pt.Y <= panelrect.Max.Y &&
+			(len(me.polys[i]) == 0 || polyContains(me.polys[i], pt)) &&
+			(idx < 0 || me.z(i) >= me.z(idx)) {
+			idx = i
+		}
+	}
+	return
+}
+
+func (me *PageLayout) z(panelIdx int) int {
+	if panelIdx < len(me.Zs) {
+		return me.Zs[panelIdx]
+	}
+	return 0
+}
+
+// even-odd rule ray casting
+func polyContains(poly []image.Point, pt image.Point) (ret bool) {
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		if pi, pj := poly[i], poly[j]; (pi.Y > pt.Y) != (pj.Y > pt.Y) &&
+			float64(pt.X) < float64(pj.X-pi.X)*float64(pt.Y-pi.Y)/float64(pj.Y-pi.Y)+float64(pi.X) {
+			ret = !ret
+		}
+	}
+	return
+}
+
 func imgDownsized(imgSrc *image.RGBA, maxWidth int) (ret *image.RGBA) {
 	origwidth, origheight := imgSrc.Bounds().Max.X, imgSrc.Bounds().Max.Y
 	newheight := int(float64(origheight) / (float64(origwidth) / float64(maxWidth)))
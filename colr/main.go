@@ -17,7 +17,10 @@ var (
 type PageLayout struct {
 	Page   image.Rectangle
 	Panels []image.Rectangle
+	Polys  [][]image.Point // if any, per panel: nil or its non-rectangular outline
+	Zs     []int           // if any, per panel: its z-order for overlapping panels
 	panels []image.Rectangle
+	polys  [][]image.Point
 }
 
 func main() {
@@ -9,9 +9,11 @@ import (
 	"image/draw"
 	_ "image/png"
 	"io"
+	"maps"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -25,6 +27,9 @@ const (
 	bookPrintBorderMmLil   = 7
 	bookPrintBorderMmShift = 3
 	bookPanelsHPadding     = 188
+	bookPrintBleedMm       = 3
+	bookPrintCoverMarginMm = 22.0
+	bookPrintCoverSpineMm  = 22
 )
 
 var (
@@ -42,12 +47,38 @@ type BookGen struct {
 
 	year           int
 	facesFilePaths []string
+	ebookFiles     map[string]string // only during genEbookVersion: in-epub file names to their src file paths
 	perRow         struct {
 		vertText  string
 		firstOnly bool
 	}
 }
 
+// the book title: $TITLE if set, else that of the `Books.Pubs` entry for `Phrase`,
+// else that of the one series all sheets belong to, else just `Phrase`
+func (me *BookGen) title(lang string) string {
+	if title := os.Getenv("TITLE"); title != "" {
+		return title
+	}
+	for _, bookpub := range App.Proj.Books.Pubs {
+		if bookpub.RepoName == me.Phrase && bookpub.Title != "" {
+			return bookpub.Title
+		}
+	}
+	var series *Series
+	for _, sv := range me.Sheets {
+		if ser := sv.parentSheet.parentChapter.parentSeries; series == nil || series == ser {
+			series = ser
+		} else {
+			return me.Phrase
+		}
+	}
+	if series != nil {
+		return locStr(series.Title, lang)
+	}
+	return me.Phrase
+}
+
 func makePngs(_ map[string]bool) {
 	for _, series := range App.Proj.Series {
 		for _, chap := range series.Chapters {
@@ -93,15 +124,17 @@ func makeBook(flags map[string]bool) {
 				(gen.year == 0 || chap.scanYearHas(gen.year, true)) {
 				for _, sheet := range chap.sheets {
 					sv := sheet.versions[0]
-					gen.Sheets = append(gen.Sheets, sv)
-
-					rect := sv.Data.pxBounds()
-					if w := rect.Dx(); w > gen.MaxSheetWidth {
-						gen.MaxSheetWidth = w
-					}
-					if h := rect.Dy(); h > gen.MaxSheetHeight {
-						gen.MaxSheetHeight = h
-					}
+					func() {
+						defer App.Report.catch("gen", sv, nil) // as in `siteGen.genSite`, a broken sheet gets left out
+						rect := sv.Data.pxBounds()
+						if w := rect.Dx(); w > gen.MaxSheetWidth {
+							gen.MaxSheetWidth = w
+						}
+						if h := rect.Dy(); h > gen.MaxSheetHeight {
+							gen.MaxSheetHeight = h
+						}
+						gen.Sheets = append(gen.Sheets, sv)
+					}()
 				}
 			}
 		}
@@ -135,6 +168,9 @@ func makeBook(flags map[string]bool) {
 			if os.Getenv("NOSCREEN") == "" {
 				gen.genScreenVersion(dirrtl, lang)
 			}
+			if os.Getenv("NOEPUB") == "" {
+				gen.genEbookVersion(dirrtl, lang)
+			}
 			if os.Getenv("NOPRINT") == "" {
 				numpages := atoi(os.Getenv("ONLYCOV"), 0, 999)
 				if numpages == 0 {
@@ -155,21 +191,37 @@ func makeBook(flags map[string]bool) {
 	}
 }
 
+// sheets failing here get reported and left out of `me.Sheets`, so out of all later book versions too
 func (me *BookGen) genSheetSvgsAndPngs(dirRtl bool, lang string) {
 	lores := (os.Getenv("LORES") != "")
-	for i, sv := range me.Sheets {
-		if os.Getenv("NOPRINT") == "" {
-			sheetsvgfilepath := me.sheetSvgPath(i, dirRtl, lang, true)
-			me.genSheetSvg(sv, sheetsvgfilepath, dirRtl, lang, true, "white")
-		}
-		if os.Getenv("NOSCREEN") == "" {
-			sheetsvgfilepath := me.sheetSvgPath(i, dirRtl, lang, false)
-			me.genSheetSvg(sv, sheetsvgfilepath, dirRtl, lang, false, "#"+itoh(bookScreenPgBgCol[0])+itoh(bookScreenPgBgCol[1])+itoh(bookScreenPgBgCol[2]))
-			sheetpngfilepath := sheetsvgfilepath + ".sh.png"
-			printLn(sheetpngfilepath, "...")
-			imgAnyToPng(sheetsvgfilepath, sheetpngfilepath, iIf(!lores, 0, bookScreenWidth/bookScreenLoResDiv), false, sIf(!lores, "sh_", "sh_lq_"), 0)
+	sheets := make([]*SheetVer, 0, len(me.Sheets))
+	for _, sv := range me.Sheets {
+		func() {
+			defer App.Report.catch("gen", sv, nil)
+			i := len(sheets)
+			if os.Getenv("NOPRINT") == "" {
+				sheetsvgfilepath := me.sheetSvgPath(i, dirRtl, lang, true)
+				me.genSheetSvg(sv, sheetsvgfilepath, dirRtl, lang, true, "white")
+			}
+			if os.Getenv("NOSCREEN") == "" {
+				sheetsvgfilepath := me.sheetSvgPath(i, dirRtl, lang, false)
+				me.genSheetSvg(sv, sheetsvgfilepath, dirRtl, lang, false, "#"+itoh(bookScreenPgBgCol[0])+itoh(bookScreenPgBgCol[1])+itoh(bookScreenPgBgCol[2]))
+				sheetpngfilepath := sheetsvgfilepath + ".sh.png"
+				printLn(sheetpngfilepath, "...")
+				imgAnyToPng(sheetsvgfilepath, sheetpngfilepath, iIf(!lores, 0, bookScreenWidth/bookScreenLoResDiv), false, sIf(!lores, "sh_", "sh_lq_"), 0)
+			}
+			sheets = append(sheets, sv)
+		}()
+	}
+	for i := len(sheets); i < len(me.Sheets); i++ { // else taken for the sheets left out, eg. by `genPrintVersion`
+		for _, forprint := range []bool{true, false} {
+			_ = os.Remove(me.sheetSvgPath(i, dirRtl, lang, forprint))
+			_ = os.Remove(me.sheetSvgPath(i, dirRtl, lang, forprint) + ".sh.png")
 		}
 	}
+	if me.Sheets = sheets; len(sheets) == 0 {
+		panic("no usable sheets left for: " + me.Phrase)
+	}
 }
 
 func (me *BookGen) genSheetSvgAndPng(sv *SheetVer, dstPngFilePath string, lang string) {
@@ -187,7 +239,7 @@ func (me *BookGen) genSheetSvg(sv *SheetVer, outFilePath string, dirRtl bool, la
 	svg := `<?xml version="1.0" encoding="UTF-8" standalone="no"?><svg
         xmlns="http://www.w3.org/2000/svg" xmlns:svg="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"
         width="` + itoa(w/2) + `" height="` + itoa(h/2) + `" viewBox="0 0 ` + itoa(w) + ` ` + itoa(h) + `"><!--fill="` + polyBgCol + `"-->
-            <style type="text/css">` + App.Proj.cssFontFaces(bookGenCssRepl) + `
+            <style type="text/css">` + App.Proj.cssFontFaces(me.cssRepl()) + `
 				polygon.pt, polygon.ptb { stroke: black; fill: ` + polyBgCol + `; }
 				tspan.sidetxt { font-size: 177px; stroke-width: 22px !important; }
 				text.sidetxt { transform: rotate(-90deg); }
@@ -208,46 +260,35 @@ func (me *BookGen) genSheetSvg(sv *SheetVer, outFilePath string, dirRtl bool, la
 	}
 	svg += `</style>`
 
-	for i := range sv.Data.PanelsTree.SubRows {
-		if row := &sv.Data.PanelsTree.SubRows[i]; len(row.SubCols) > 1 {
-			row.setTopLevelRowRecenteredX(sv.Data.PanelsTree, w, h)
-		}
-	}
-
-	pidx, qidx := 0, iIf(lores, 0, App.Proj.maxQualiIdx(false))
-	rowmids, ymid := map[int]int{}, -1
-	sv.Data.PanelsTree.each(func(p *ImgPanel) {
-		px, py, pw, ph := p.Rect.Min.X+p.recenteredXOffset, p.Rect.Min.Y-rectinner.Min.Y, p.Rect.Dx(), p.Rect.Dy()
-		if py != ymid && (len(rowmids) == 0 || !me.perRow.firstOnly) {
-			ymid = py
-			rowmids[py+(ph/2)] = px + pw + 128 + 6
-		}
-		tx, gid := px, "pnl"+itoa(pidx)
-		if dirRtl {
-			tx = w - pw - px
+	panels, rowmids := me.sheetPanelsLayout(sv, dirRtl)
+	qidx := iIf(lores, 0, App.Proj.maxQualiIdx(false))
+	for _, p := range panels {
+		pw, ph, gid := p.Rect.Dx(), p.Rect.Dy(), "pnl"+itoa(p.idx)
+		svg += `<g id="` + gid + `" clip-path="url(#c` + gid + `)" transform="translate(` + itoa(p.x) + ` ` + itoa(p.y) + `)">`
+		if len(p.Poly) > 0 {
+			svg += `<defs><clipPath id="c` + gid + `"><polygon points="` + p.svgPolyPoints() + `"></polygon></clipPath></defs>`
+		} else {
+			svg += `<defs><clipPath id="c` + gid + `"><rect x="0" y="0" width="` + itoa(pw) + `" height="` + itoa(ph) + `"></rect></clipPath></defs>`
 		}
-		svg += `<g id="` + gid + `" clip-path="url(#c` + gid + `)" transform="translate(` + itoa(tx) + ` ` + itoa(py) + `)">`
-		svg += `<defs><clipPath id="c` + gid + `"><rect x="0" y="0" width="` + itoa(pw) + `" height="` + itoa(ph) + `"></rect></clipPath></defs>`
-		if panelbgpngsrcfilepath := filepath.Join(sv.Data.DirPath, "bg."+ftoa(App.Proj.Sheets.Panel.BgScale, 2)+"."+itoa(pidx)+".png"); fileStat(panelbgpngsrcfilepath) != nil {
+		if p.bgFilePath != "" {
 			svg += `<image x="0" y="0" width="` + itoa(pw) + `" height="` + itoa(ph) + `"
-						xlink:href="data:image/png;base64,` + base64.StdEncoding.EncodeToString(fileRead(panelbgpngsrcfilepath)) + `" />`
+						xlink:href="` + me.pngHref(sv, p.bgFilePath) + `" />`
 		} else {
 			svg += `<rect x="0" y="0" width="` + itoa(pw) + `" height="` + itoa(ph) + `"
 						fill="#ffffff" stroke-width="0" />`
 		}
 		svg += `<image x="0" y="0" width="` + itoa(pw) + `" height="` + itoa(ph) + `"
-					xlink:href="data:image/png;base64,` + base64.StdEncoding.EncodeToString(fileRead(filepath.Join(sv.Data.PicDirPath(App.Proj.Qualis[qidx].SizeHint), itoa(pidx)+".png"))) + `" />
+					xlink:href="` + me.pngHref(sv, filepath.Join(sv.Data.PicDirPath(App.Proj.Qualis[qidx].SizeHint), itoa(p.idx)+".png")) + `" />
 					`
 		if lang != "" {
-			svg += sv.genTextSvgForPanel(pidx, p, lang, false, true)
+			svg += sv.genTextSvgForPanel(p.idx, p.ImgPanel, lang, false, true)
 		}
 		svg += "\n</g>\n\n"
-		pidx++
-	})
+	}
 
 	if me.perRow.vertText != "" {
-		for y, x := range rowmids {
-			svg += `<g x="0" y="0" transform="translate(` + itoa(x) + ` ` + itoa(y) + `)"><text class="sidetxt"><tspan dx="0" dy="0" class="sidetxt">` + xEsc(me.perRow.vertText) + `</tspan></text></g>`
+		for _, y := range slices.Sorted(maps.Keys(rowmids)) {
+			svg += `<g x="0" y="0" transform="translate(` + itoa(rowmids[y]) + ` ` + itoa(y) + `)"><text class="sidetxt"><tspan dx="0" dy="0" class="sidetxt">` + xEsc(me.perRow.vertText) + `</tspan></text></g>`
 		}
 	}
 
@@ -255,6 +296,60 @@ func (me *BookGen) genSheetSvg(sv *SheetVer, outFilePath string, dirRtl bool, la
 	fileWrite(outFilePath, []byte(svg))
 }
 
+type bookSheetPanel struct {
+	*ImgPanel
+	idx        int    // as for the panel's pics and text areas
+	x, y       int    // within the sheet, already mirrored if right-to-left
+	bgFilePath string // empty if the panel has no bg pic
+}
+
+// the panels of `sv` as placed on book pages (by both genSheetSvg and pdfSheet) in paint order
+// (overlapping panels: higher Z on top), plus the per-row `perRow.vertText` positions (by y)
+func (me *BookGen) sheetPanelsLayout(sv *SheetVer, dirRtl bool) (panels []bookSheetPanel, rowMids map[int]int) {
+	rectinner := sv.Data.pxBounds()
+	w, h := rectinner.Dx(), rectinner.Dy()
+	for i := range sv.Data.PanelsTree.SubRows {
+		if row := &sv.Data.PanelsTree.SubRows[i]; len(row.SubCols) > 1 {
+			row.setTopLevelRowRecenteredX(sv.Data.PanelsTree, w, h)
+		}
+	}
+	pidx, ymid := 0, -1
+	rowMids = map[int]int{}
+	sv.Data.PanelsTree.each(func(p *ImgPanel) {
+		px, py, pw, ph := p.Rect.Min.X+p.recenteredXOffset, p.Rect.Min.Y-rectinner.Min.Y, p.Rect.Dx(), p.Rect.Dy()
+		if py != ymid && (len(rowMids) == 0 || !me.perRow.firstOnly) {
+			ymid = py
+			rowMids[py+(ph/2)] = px + pw + 128 + 6
+		}
+		panel := bookSheetPanel{ImgPanel: p, idx: pidx, x: iIf(dirRtl, w-pw-px, px), y: py}
+		if bgfilepath := filepath.Join(sv.Data.DirPath, "bg."+ftoa(App.Proj.Sheets.Panel.BgScale, 2)+"."+itoa(pidx)+".png"); fileStat(bgfilepath) != nil {
+			panel.bgFilePath = bgfilepath
+		}
+		panels = append(panels, panel)
+		pidx++
+	})
+	slices.SortStableFunc(panels, func(p1 bookSheetPanel, p2 bookSheetPanel) int { return p1.Z - p2.Z })
+	return
+}
+
+// embedded as base64 data, except for epubs where it's a separate file in there
+func (me *BookGen) pngHref(sv *SheetVer, pngFilePath string) string {
+	if me.ebookFiles == nil {
+		return "data:image/png;base64," + base64.StdEncoding.EncodeToString(fileRead(pngFilePath))
+	}
+	name := "img/" + sv.ID + "_" + strings.Replace(filepath.Base(filepath.Dir(pngFilePath)), ".", "_", -1) + "_" + filepath.Base(pngFilePath)
+	me.ebookFiles[name] = pngFilePath
+	return name
+}
+
+// font files are referenced in-place, except for epubs which bundle them
+func (me *BookGen) cssRepl() *strings.Replacer {
+	if me.ebookFiles != nil {
+		return nil
+	}
+	return bookGenCssRepl
+}
+
 func (me *BookGen) sheetSvgPath(idx int, dirRtl bool, lang string, forPrint bool) string {
 	return me.ShmDirPath + "/" + sIf(dirRtl, "r", "l") + sIf(forPrint, "p", "s") + itoa0pref(idx, 3) + lang + sIf(os.Getenv("LORES") == "", "", "_lq") + ".svg"
 }
@@ -375,14 +470,7 @@ func (me *BookGen) genScreenVersion(dirRtl bool, lang string) {
 	}
 
 	if os.Getenv("NOPDF") == "" {
-		outfilepathpdf := me.OutDirPath + "/" + bookFileName(me.Phrase, "screen", lang, dirRtl, ".pdf")
-		printLn(outfilepathpdf, "...")
-		cmdArgs := []string{"--pillow-limit-break", "--nodate",
-			"--pagesize", "A5^T"}
-		cmdArgs = append(cmdArgs, pgfilepaths...)
-		if s := osExec(false, nil, "img2pdf", append(cmdArgs, "-o", outfilepathpdf)...); strings.Contains(s, "error:") {
-			panic(s)
-		}
+		me.genScreenPdf(pgfilepaths, lang, me.OutDirPath+"/"+bookFileName(me.Phrase, "screen", lang, dirRtl, ".pdf"))
 	}
 }
 
@@ -414,24 +502,11 @@ func (me *BookGen) genPrintVersion(dirRtl bool, lang string) (numPages int) {
 			return
 		}
 		svgpgstart()
-		x, y := -55, -20
-		for {
-			if x > pgwmm {
-				x, y = -(11 + rand.Intn(22)), y+33
-			} else {
-				x += 46
-			}
-			if x > pgwmm && y > pghmm {
-				break
-			}
-			if dpbwidx++; dpbwidx == len(dpbwfilepaths) {
-				dpbwidx = 0
-			}
-			even := ((dpbwidx % 2) == 0)
-			svg += `<image width="44mm" x="` + itoa(x+iIf(even, 0, 0)) + `mm" y="` + itoa(y) + `mm"
+		me.printEndPaperTiles(pgwmm, pghmm, &dpbwidx, len(dpbwfilepaths), rand.Intn, func(x int, y int, rotDeg int) {
+			svg += `<image width="44mm" x="` + itoa(x) + `mm" y="` + itoa(y) + `mm"
 						xlink:href="file://` + dpbwfilepaths[dpbwidx] + `"
-						opacity="` + sIf(closeTag, "0.22", "0.11") + `" transform="rotate(` + itoa(iIf(even, 2, -2)) + `)" />`
-		}
+						opacity="` + sIf(closeTag, "0.22", "0.11") + `" transform="rotate(` + itoa(rotDeg) + `)" />`
+		})
 		if closeTag {
 			svg += "</svg>"
 		}
@@ -483,17 +558,12 @@ func (me *BookGen) genPrintVersion(dirRtl bool, lang string) (numPages int) {
 		sheetsvgfilepath0 := me.sheetSvgPath(i*2, dirRtl, lang, true)
 		sheetsvgfilepath1 := me.sheetSvgPath((i*2)+1, dirRtl, lang, true)
 		svg += `<text x="50%" y="97%"><tspan>` + itoa(pgidx+1) + `</tspan></text>`
-		topborder := bookPrintBorderMmBig
-		if me.Sheets[i*2].parentSheet.parentChapter.Name == "half-pagers" {
-			topborder = bookPrintBorderMmLil
-		}
-		x := iIf(isoddpage, bookPrintBorderMmBig+bookPrintBorderMmShift, bookPrintBorderMmLil-bookPrintBorderMmShift)
-		w := pgwmm - (bookPrintBorderMmBig + bookPrintBorderMmLil)
-		svg += `<image x="` + itoa(x) + `mm" y="` + itoa(topborder) + `mm" width="` + itoa(w) + `mm" xlink:href="data:image/svg+xml;base64,` + svg2base64(sheetsvgfilepath0, false) + `"/>`
+		x, w, y0, y1, ycollage := me.printPageLayout(i, isoddpage, pgwmm, pghmm)
+		svg += `<image x="` + itoa(x) + `mm" y="` + itoa(y0) + `mm" width="` + itoa(w) + `mm" xlink:href="data:image/svg+xml;base64,` + svg2base64(sheetsvgfilepath0, false) + `"/>`
 		if fileStat(sheetsvgfilepath1) != nil {
-			svg += `<image x="` + itoa(x) + `mm" y="` + ftoa(fIf(strings.HasPrefix(me.Sheets[i*2].parentSheet.name, "01FROGF"), 47, 50.2), 1) + `%" width="` + itoa(w) + `mm" xlink:href="data:image/svg+xml;base64,` + svg2base64(sheetsvgfilepath1, false) + `"/>`
+			svg += `<image x="` + itoa(x) + `mm" y="` + ftoa(y1, -1) + `mm" width="` + itoa(w) + `mm" xlink:href="data:image/svg+xml;base64,` + svg2base64(sheetsvgfilepath1, false) + `"/>`
 		} else if altsvgfilepath := "stuff/" + me.Phrase + "/collage.svg"; fileStat(altsvgfilepath) != nil {
-			svg += `<image x="` + itoa(x) + `mm" y="51%" width="` + itoa(w) + `mm" xlink:href="data:image/svg+xml;base64,` + svg2base64(altsvgfilepath, true) + `"/>`
+			svg += `<image x="` + itoa(x) + `mm" y="` + ftoa(ycollage, -1) + `mm" width="` + itoa(w) + `mm" xlink:href="data:image/svg+xml;base64,` + svg2base64(altsvgfilepath, true) + `"/>`
 		}
 		svg += "</svg>"
 	}
@@ -548,18 +618,55 @@ func (me *BookGen) genPrintVersion(dirRtl bool, lang string) (numPages int) {
 	outfilepathsvg := me.ShmDirPath + "/print_" + lang + sIf(dirRtl, "_rtl", "_ltr") + ".svg"
 	fileWrite(outfilepathsvg, []byte(svgfull))
 	if os.Getenv("NOPDF") == "" {
-		me.printSvgToPdf(outfilepathsvg, me.OutDirPath+"/"+bookFileName(me.Phrase, "print", lang, dirRtl, ".pdf"))
+		me.genPrintPdf(dirRtl, lang, numPages, me.OutDirPath+"/"+bookFileName(me.Phrase, "print", lang, dirRtl, ".pdf"))
 	}
 	return
 }
 
-func (me *BookGen) tocSvg(lang string, pgW int, pgH int) (s string) {
-	var tocs []int
+// where on its print page (by both genPrintVersion and genPrintPdf) the sheet pair `pairIdx` goes, in mm:
+// left edge and width of both sheets, top of the first, and top of the second sheet or else of the collage
+func (me *BookGen) printPageLayout(pairIdx int, isOddPage bool, pgWMm int, pgHMm int) (x int, w int, y0 int, y1 float64, yCollage float64) {
+	sheet := me.Sheets[pairIdx*2].parentSheet
+	x, w, y0 = iIf(isOddPage, bookPrintBorderMmBig+bookPrintBorderMmShift, bookPrintBorderMmLil-bookPrintBorderMmShift), pgWMm-(bookPrintBorderMmBig+bookPrintBorderMmLil), bookPrintBorderMmBig
+	if sheet.parentChapter.Name == "half-pagers" {
+		y0 = bookPrintBorderMmLil
+	}
+	y1, yCollage = float64(pgHMm)*fIf(strings.HasPrefix(sheet.name, "01FROGF"), 0.47, 0.502), float64(pgHMm)*0.51
+	return
+}
+
+// the end-paper tiling (by both genPrintVersion and genPrintPdf) of a print page: `each` gets the mm position
+// and tilt of every 44mm-wide b&w sheet pic, as `picIdx` cycles through all `numPics`
+func (*BookGen) printEndPaperTiles(pgWMm int, pgHMm int, picIdx *int, numPics int, randIntn func(int) int, each func(x int, y int, rotDeg int)) {
+	x, y := -55, -20
+	for {
+		if x > pgWMm {
+			x, y = -(11 + randIntn(22)), y+33
+		} else {
+			x += 46
+		}
+		if x > pgWMm && y > pgHMm {
+			break
+		}
+		if *picIdx++; *picIdx == numPics {
+			*picIdx = 0
+		}
+		each(x, y, iIf((*picIdx%2) == 0, 2, -2))
+	}
+}
+
+// indices into `me.Sheets` of each chapter's first sheet
+func (me *BookGen) tocSheetIdxs() (tocs []int) {
 	for i, sv := range me.Sheets {
 		if len(tocs) == 0 || sv.parentSheet.parentChapter != me.Sheets[tocs[len(tocs)-1]].parentSheet.parentChapter {
 			tocs = append(tocs, i)
 		}
 	}
+	return
+}
+
+func (me *BookGen) tocSvg(lang string, pgW int, pgH int) (s string) {
+	tocs := me.tocSheetIdxs()
 
 	isforprint := (pgW == 0) && (pgH == 0)
 	if !isforprint {
@@ -580,35 +687,8 @@ func (me *BookGen) tocSvg(lang string, pgW int, pgH int) (s string) {
 			chap := sv.parentSheet.parentChapter
 			pgnr := iIf(isforprint, 5, 2) + idx/iIf(isforprint, 2, 1)
 			s += `<text class="toc" x="8.88%" y="` + ftoa(ypc, -1) + `%"><tspan>` + itoa0pref(pgnr, 2) + sIf((pgnr >= 10 && pgnr < 20) || (((pgnr-1)%10) == 0), " ", "") + strings.Repeat("&#009;", iIf(pgnr >= 100, 3, 4)) + locStr(chap.Title, lang) + `</tspan></text>`
-			if chap.author != nil {
-				subtext, titleorig := "Story: ", chap.TitleOrig
-				if prependWhen := false; prependWhen {
-					_, dt := chap.dateRangeOfSheets(false, me.year)
-					month1, month2 := "", dt.Month().String()
-					if month := atoi(chap.Name[2:4], 0, 9999); month < 1 || month > 12 {
-						panic(chap.Name[2:4])
-					} else {
-						month1 = time.Month(month).String()
-					}
-					if lang != App.Proj.Langs[0] {
-						month1, month2 = App.Proj.textStr(lang, "Month_"+month1), App.Proj.textStr(lang, "Month_"+month2)
-					}
-					dtstr := month1[:3] + " 20" + chap.Name[:2] + " - " + month2[:3] + " " + itoa(me.year)
-					if idx := strings.IndexByte(dtstr, '-'); idx > 0 && dtstr[:idx-1] == dtstr[idx+2:] {
-						dtstr = dtstr[:idx-1]
-					}
-					subtext = "(" + dtstr + ")&#xA0;&#xA0;&#8212;&#xA0;&#xA0;" + subtext
-				}
-				if chap.TitleOrig == locStr(chap.Title, lang) {
-					titleorig = ""
-				} else if titleorig == "" && lang != App.Proj.Langs[0] {
-					titleorig = locStr(chap.Title, App.Proj.Langs[0])
-				}
-				if titleorig != "" {
-					subtext += "&quot;" + xEsc(titleorig) + "&quot;, "
-				}
-				subtext += xEsc("©") + itoa(chap.Year) + " " + chap.author.str(false, false)
-				s += `<text class="tocsub" x="24%" y="` + ftoa(ypc+2.22, -1) + `%"><tspan>` + subtext + `</tspan></text>`
+			if subtext := me.tocSubText(chap, lang); subtext != "" {
+				s += `<text class="tocsub" x="24%" y="` + ftoa(ypc+2.22, -1) + `%"><tspan>` + xEsc(subtext) + `</tspan></text>`
 			}
 			ypc += pstep
 		}
@@ -617,6 +697,40 @@ func (me *BookGen) tocSvg(lang string, pgW int, pgH int) (s string) {
 	return
 }
 
+// the (unescaped) line under a chapter's TOC entry: original title, year and author
+func (me *BookGen) tocSubText(chap *Chapter, lang string) (subtext string) {
+	if chap.author == nil {
+		return
+	}
+	subtext, titleorig := "Story: ", chap.TitleOrig
+	if prependWhen := false; prependWhen {
+		_, dt := chap.dateRangeOfSheets(false, me.year)
+		month1, month2 := "", dt.Month().String()
+		if month := atoi(chap.Name[2:4], 0, 9999); month < 1 || month > 12 {
+			panic(chap.Name[2:4])
+		} else {
+			month1 = time.Month(month).String()
+		}
+		if lang != App.Proj.Langs[0] {
+			month1, month2 = App.Proj.textStr(lang, "Month_"+month1), App.Proj.textStr(lang, "Month_"+month2)
+		}
+		dtstr := month1[:3] + " 20" + chap.Name[:2] + " - " + month2[:3] + " " + itoa(me.year)
+		if idx := strings.IndexByte(dtstr, '-'); idx > 0 && dtstr[:idx-1] == dtstr[idx+2:] {
+			dtstr = dtstr[:idx-1]
+		}
+		subtext = "(" + dtstr + ")\u00a0\u00a0\u2014\u00a0\u00a0" + subtext
+	}
+	if chap.TitleOrig == locStr(chap.Title, lang) {
+		titleorig = ""
+	} else if titleorig == "" && lang != App.Proj.Langs[0] {
+		titleorig = locStr(chap.Title, App.Proj.Langs[0])
+	}
+	if titleorig != "" {
+		subtext += "\"" + titleorig + "\", "
+	}
+	return subtext + "©" + itoa(chap.Year) + " " + chap.author.str(false, false)
+}
+
 func (me *BookGen) facesPicPaths() []string {
 	if me.facesFilePaths == nil {
 		me.facesFilePaths = make([]string, 0, len(me.Sheets))
@@ -672,6 +786,15 @@ func (me *BookGen) facesDistr(numFaces int, w float64, h float64, double bool) (
 }
 
 func (me *BookGen) facesDraw(faces []string, perRow int, perCol int, areaWidth float64, areaHeight float64, svgWidth float64, svgHeight float64, spine float64, margin float64, svgUnit string) (svg string) {
+	me.facesLayout(faces, perRow, perCol, areaWidth, areaHeight, svgWidth, svgHeight, spine, margin, svgUnit == "px", func(x float64, y float64, wh float64, face string) {
+		svg += `<image x="` + ftoa(x, -1) + svgUnit + `" y="` + ftoa(y, -1) + svgUnit + `"
+					width="` + ftoa(wh, -1) + svgUnit + `"  height="` + ftoa(wh, -1) + svgUnit + `"
+					xlink:href="file://` + face + `" />`
+	})
+	return
+}
+
+func (me *BookGen) facesLayout(faces []string, perRow int, perCol int, areaWidth float64, areaHeight float64, svgWidth float64, svgHeight float64, spine float64, margin float64, isForScreen bool, onFace func(x float64, y float64, wh float64, face string)) {
 	fpad, fwh, fy0 := (areaWidth/float64(perRow))/9.0, 0.0, 0.0
 	for i := 0.0; fy0 < margin; i += 1.11 {
 		fwh = ((areaWidth / float64(perRow)) - fpad) - i
@@ -680,8 +803,7 @@ func (me *BookGen) facesDraw(faces []string, perRow int, perCol int, areaWidth f
 	}
 	faceswidth := (float64(perRow) * (fwh + fpad))
 	fx, fy, fidx := margin+(0.5*fpad)+(0.5*(areaWidth-faceswidth)), fy0, 0
-	isforscreen := (svgUnit == "px")
-	if isforscreen {
+	if isForScreen {
 		fx = 0.5 * (svgWidth - (faceswidth - fpad))
 	}
 	for first, doneincol := true, 0; true; first = false {
@@ -693,22 +815,28 @@ func (me *BookGen) facesDraw(faces []string, perRow int, perCol int, areaWidth f
 		} else if !first {
 			fy += fwh + fpad
 		}
-		if bIf(isforscreen, (fx+fwh) > svgWidth, (fx+fwh+fpad) > (svgWidth-margin)) {
+		if bIf(isForScreen, (fx+fwh) > svgWidth, (fx+fwh+fpad) > (svgWidth-margin)) {
 			break
 		}
-		svg += `<image x="` + ftoa(fx, -1) + svgUnit + `" y="` + ftoa(fy, -1) + svgUnit + `"
-					width="` + ftoa(fwh, -1) + svgUnit + `"  height="` + ftoa(fwh, -1) + svgUnit + `"
-					xlink:href="file://` + faces[fidx] + `" />`
+		onFace(fx, fy, fwh, faces[fidx])
 		if fidx++; fidx >= len(faces) {
 			fidx = 0
 		}
 		doneincol++
 	}
-	return
 }
 
 func (me *BookGen) genPrintCover(title string, numPages int) {
-	marginmm := 22.0
+	outfilepathsvg := me.ShmDirPath + "/printcover.svg"
+	printLn(outfilepathsvg, "...")
+	fileWrite(outfilepathsvg, []byte(me.printCoverSvg(title, numPages, false)))
+	if os.Getenv("NOPDF") == "" {
+		me.genPrintCoverPdf(title, numPages, me.OutDirPath+"/"+bookFileName(me.Phrase, "", "", false, ".pdf"))
+	}
+}
+
+// in mm: the cover's full width (grows with the page count for the spine) and height
+func (*BookGen) printCoverSize(numPages int) (w float64, h float64) {
 	knownsizes := []struct {
 		numPgs int
 		mm     float64
@@ -724,19 +852,29 @@ func (me *BookGen) genPrintCover(title string, numPages int) {
 		{204, 483.5},
 		{228, 485},
 	}
-
-	outfilepathsvg := me.ShmDirPath + "/printcover.svg"
-	printLn(outfilepathsvg, "...")
-
-	faces := me.facesPicPaths()
-	svgw, svgh := knownsizes[0].mm, 340.0
+	w, h = knownsizes[0].mm, 340.0
 	for _, knownsize := range knownsizes[1:] {
 		if numPages >= knownsize.numPgs {
-			svgw = knownsize.mm
+			w = knownsize.mm
 		}
 	}
-	svg := `<?xml version="1.0" encoding="UTF-8" standalone="no"?><svg xmlns="http://www.w3.org/2000/svg" xmlns:svg="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"
-				width="` + ftoa(svgw-1, -1) + `mm" height="` + ftoa(svgh-1, -1) + `mm" style="background-color: #ffffff">
+	return
+}
+
+// the full wrap-around print cover, or with `frontOnly` just its front (right of the spine)
+func (me *BookGen) printCoverSvg(title string, numPages int, frontOnly bool) (svg string) {
+	marginmm, spinemm := bookPrintCoverMarginMm, bookPrintCoverSpineMm
+	faces := me.facesPicPaths()
+	svgw, svgh := me.printCoverSize(numPages)
+	spinex := (svgw * 0.5) - (float64(spinemm) * 0.5)
+	svgsize := `width="` + ftoa(svgw-1, -1) + `mm" height="` + ftoa(svgh-1, -1) + `mm"`
+	if frontOnly {
+		const pxmm = 96.0 / 25.4 // user units in the viewBox are css px
+		frontx := spinex + float64(spinemm)
+		svgsize = `width="` + ftoa(svgw-frontx, -1) + `mm" height="` + ftoa(svgh, -1) + `mm" viewBox="` + ftoa(frontx*pxmm, 2) + ` 0 ` + ftoa((svgw-frontx)*pxmm, 2) + ` ` + ftoa(svgh*pxmm, 2) + `"`
+	}
+	svg = `<?xml version="1.0" encoding="UTF-8" standalone="no"?><svg xmlns="http://www.w3.org/2000/svg" xmlns:svg="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"
+				` + svgsize + ` style="background-color: #ffffff">
 				<style type="text/css">
 					@page { margin: 0; padding: 0; line-height: unset; size: ` + ftoa(svgw, -1) + `mm ` + ftoa(svgh, -1) + `mm; }
 					* { margin: 0; padding: 0; line-height: unset; }
@@ -750,10 +888,8 @@ func (me *BookGen) genPrintCover(title string, numPages int) {
 					}
 				</style>`
 
-	const spinemm = 22
-	spinex := (svgw * 0.5) - (float64(spinemm) * 0.5)
 	svg += `<rect fill="#000000" width="` + itoa(spinemm) + `mm" height="100%" y="0mm" x="` + ftoa(spinex, -1) + `mm" />`
-	svg += `<text x="` + ftoa(0.5+(svgw*0.5), -1) + `mm" y="` + ftoa(svgh/3.0, -1) + `mm"><tspan>` + title + `</tspan></text>`
+	svg += `<text x="` + ftoa(0.5+(svgw*0.5), -1) + `mm" y="` + ftoa(svgh/3.0, -1) + `mm"><tspan>` + xEsc(title) + `</tspan></text>`
 
 	areawidth, areaheight := spinex-marginmm, svgh-(marginmm*2.0)
 	fperrow, fpercol := me.facesDistr(len(faces), areawidth, areaheight, true)
@@ -765,22 +901,7 @@ func (me *BookGen) genPrintCover(title string, numPages int) {
 				<rect opacity="0.5" fill="#cccccc" width="` + ftoa(marginmm, -1) + `mm" height="` + ftoa(svgh, -1) + `mm" y="0" x="` + ftoa(svgw-marginmm, -1) + `mm" />`
 	}
 	svg += "</svg>"
-
-	fileWrite(outfilepathsvg, []byte(svg))
-	if os.Getenv("NOPDF") == "" {
-		me.printSvgToPdf(outfilepathsvg, me.OutDirPath+"/"+bookFileName(me.Phrase, "", "", false, ".pdf"))
-	}
-}
-
-func (*BookGen) printSvgToPdf(svgFilePath string, pdfOutFilePath string) {
-	printLn(pdfOutFilePath, "...")
-	s := osExec(false, nil, browserCmd[0], append(browserCmd[2:],
-		// "--headless",
-		"--no-pdf-header-footer", "--disable-hang-monitor", // "--print-to-pdf="+pdfOutFilePath,
-		svgFilePath)...)
-	if fstat := fileStat(pdfOutFilePath); fstat == nil || fstat.Size() == 0 {
-		panic(s)
-	}
+	return
 }
 
 func bookFileName(bookName string, pref string, lang string, dirRtl bool, ext string) string {
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var bookEpubFontUrl = regexp.MustCompile(`url\(['"]?\./([^'")]+)`)
+
+// fixed-layout EPUB3: one XHTML page per sheet, each inlining its sheet SVG so
+// that the lettering stays real SVG text (rather than pixels baked into a PNG)
+func (me *BookGen) genEbookVersion(dirRtl bool, lang string) {
+	me.ebookFiles = map[string]string{}
+	defer func() { me.ebookFiles = nil }()
+	outfilepath := me.OutDirPath + "/" + bookFileName(me.Phrase, "screen", lang, dirRtl, ".epub")
+	printLn(outfilepath, "...")
+	title := me.title(lang)
+
+	files, pages := map[string][]byte{}, []string{} // beyond me.ebookFiles: generated files, and the page order
+	bgcol := "#" + itoh(bookScreenPgBgCol[0]) + itoh(bookScreenPgBgCol[1]) + itoh(bookScreenPgBgCol[2])
+	var pgw, pgh int
+	for i, sv := range me.Sheets {
+		svgfilepath := strings.TrimSuffix(me.sheetSvgPath(i, dirRtl, lang, false), ".svg") + ".epub.svg"
+		me.genSheetSvg(sv, svgfilepath, dirRtl, lang, false, bgcol)
+		svg := string(fileRead(svgfilepath))
+		rect, name := sv.Data.pxBounds(), "p"+itoa0pref(i, 3)+".xhtml"
+		if i == 0 {
+			pgw, pgh = rect.Dx()/2, rect.Dy()/2
+		}
+		files[name] = me.ebookXhtml(lang, sv.parentSheet.name, rect.Dx()/2, rect.Dy()/2, svg[strings.Index(svg, "<svg"):])
+		pages = append(pages, name)
+	}
+	if pgw <= 0 || pgh <= 0 {
+		panic(outfilepath + ": no sheets (or a zero-size first sheet), so no page size for the fixed layout")
+	}
+	for _, fontface := range App.Proj.Sheets.Panel.CssFontFaces {
+		for _, match := range bookEpubFontUrl.FindAllStringSubmatch(fontface, -1) {
+			me.ebookFiles[match[1]] = "site/files/" + match[1]
+		}
+	}
+
+	covsvg := me.printCoverSvg(title, len(me.Sheets), true) // the front of the print cover
+	for i, facefilepath := range me.facesPicPaths() {
+		if href := `"file://` + facefilepath + `"`; strings.Contains(covsvg, href) {
+			name := "img/face" + itoa0pref(i, 3) + ".png"
+			me.ebookFiles[name], covsvg = facefilepath, strings.Replace(covsvg, href, `"`+name+`"`, -1)
+		}
+	}
+	files["cover.svg"] = []byte(covsvg)
+	files["cover.xhtml"] = me.ebookXhtml(lang, title, pgw, pgh, `<img src="cover.svg" alt="" style="width: 100%; height: 100%; object-fit: contain"/>`)
+	pages = append([]string{"cover.xhtml"}, pages...)
+
+	nav := `<nav epub:type="toc" id="toc"><h1>` + xEsc(title) + `</h1><ol>`
+	for _, idx := range me.tocSheetIdxs() {
+		nav += `<li><a href="p` + itoa0pref(idx, 3) + `.xhtml">` + xEsc(locStr(me.Sheets[idx].parentSheet.parentChapter.Title, lang)) + `</a></li>`
+	}
+	files["nav.xhtml"] = me.ebookXhtml(lang, title, 0, 0, nav+`</ol></nav>`)
+
+	names := append(sortedMapKeys(files), sortedMapKeys(me.ebookFiles)...)
+	opf := `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid" xml:lang="` + lang + `" prefix="rendition: http://www.idpf.org/vocab/rendition/#">
+	<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+		<dc:identifier id="bookid">urn:cositegen:` + xEsc(bookFileName(me.Phrase, "screen", lang, dirRtl, "")) + `</dc:identifier>
+		<dc:title>` + xEsc(title) + `</dc:title>
+		<dc:language>` + lang + `</dc:language>
+		<meta property="dcterms:modified">` + time.Now().UTC().Format("2006-01-02T15:04:05Z") + `</meta>
+		<meta property="rendition:layout">pre-paginated</meta>
+		<meta property="rendition:orientation">auto</meta>
+		<meta property="rendition:spread">landscape</meta>
+	</metadata>
+	<manifest>
+`
+	for i, name := range names {
+		var props string
+		switch {
+		case name == "nav.xhtml":
+			props = "nav"
+		case name == "cover.svg":
+			props = "cover-image"
+		case name != "cover.xhtml" && strings.HasSuffix(name, ".xhtml"):
+			props = "svg"
+		}
+		opf += `		<item id="i` + itoa(i) + `" href="` + xEsc(name) + `" media-type="` + bookEpubMediaType(name) + `"` + sIf(props == "", "", ` properties="`+props+`"`) + "/>\n"
+	}
+	opf += `	</manifest>
+	<spine page-progression-direction="` + sIf(dirRtl, "rtl", "ltr") + `">
+`
+	for _, page := range pages {
+		opf += `		<itemref idref="i` + itoa(indexOf(names, page)) + `"/>` + "\n"
+	}
+	opf += "	</spine>\n</package>\n"
+	files["content.opf"] = []byte(opf)
+
+	outfile, err := os.Create(outfilepath)
+	if err != nil {
+		panic(err)
+	}
+	defer outfile.Close()
+	zw := zip.NewWriter(outfile)
+	write := func(name string, data []byte, compress bool) {
+		method := zip.Store
+		if compress {
+			method = zip.Deflate
+		}
+		if fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method}); err != nil {
+			panic(err)
+		} else if _, err = fw.Write(data); err != nil {
+			panic(err)
+		}
+	}
+	write("mimetype", []byte("application/epub+zip"), false) // must come first & uncompressed
+	write("META-INF/container.xml", []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+	<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>
+`), true)
+	for _, name := range sortedMapKeys(files) {
+		write("OEBPS/"+name, files[name], true)
+	}
+	for _, name := range sortedMapKeys(me.ebookFiles) {
+		write("OEBPS/"+name, fileRead(me.ebookFiles[name]), !strings.HasSuffix(name, ".png"))
+	}
+	if err := zw.Close(); err != nil {
+		panic(err)
+	} else if err = outfile.Sync(); err != nil {
+		panic(err)
+	}
+}
+
+func (*BookGen) ebookXhtml(lang string, title string, pgW int, pgH int, body string) []byte {
+	s := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="` + lang + `" lang="` + lang + `"><head><meta charset="UTF-8"/><title>` + xEsc(title) + `</title>`
+	if pgW > 0 && pgH > 0 { // fixed-layout page
+		s += `<meta name="viewport" content="width=` + itoa(pgW) + `, height=` + itoa(pgH) + `"/>
+		<style type="text/css">html, body { margin: 0; padding: 0; width: ` + itoa(pgW) + `px; height: ` + itoa(pgH) + `px; overflow: hidden; }</style>`
+	}
+	return []byte(s + "</head><body>" + body + "</body></html>\n")
+}
+
+func bookEpubMediaType(fileName string) string {
+	switch ext := filepath.Ext(fileName); ext {
+	case ".xhtml":
+		return "application/xhtml+xml"
+	case ".svg":
+		return "image/svg+xml"
+	case ".png":
+		return "image/png"
+	case ".opf":
+		return "application/oebps-package+xml"
+	default: // fonts
+		return "font/" + ext[1:]
+	}
+}
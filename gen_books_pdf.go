@@ -0,0 +1,348 @@
+package main
+
+import (
+	"maps"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type bookPdfTextSeg struct {
+	text   string
+	family string
+	bold   bool
+	italic bool
+}
+
+func (me *BookGen) pdfInfo(lang string) map[string]string {
+	return map[string]string{
+		"Title":    me.title(lang),
+		"Author":   App.Proj.Site.Host,
+		"Keywords": lang,
+	}
+}
+
+// for the random end-paper layouts: fixed by `SOURCE_DATE_EPOCH` for reproducible PDFs
+func (*BookGen) pdfRand() *rand.Rand {
+	seed := time.Now().UnixNano()
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		seed = epoch
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// screen PDF: each page PNG fit into a landscape A5 page
+func (me *BookGen) genScreenPdf(pgFilePaths []string, lang string, outFilePath string) {
+	printLn(outFilePath, "...")
+	const pgwmm, pghmm = 210.0, 148.0
+	doc := pdfNew(me.pdfInfo(lang))
+	for _, pgfilepath := range pgFilePaths {
+		pg := doc.page(pgwmm, pghmm, 0)
+		iw, ih := doc.imageSize(pgfilepath)
+		w, h := pgwmm, pgwmm*(float64(ih)/float64(iw))
+		if h > pghmm {
+			w, h = pghmm*(float64(iw)/float64(ih)), pghmm
+		}
+		pg.image(pgfilepath, 0.5*(pgwmm-w), 0.5*(pghmm-h), w, h)
+		doc.pageEnd(pg)
+	}
+	doc.writeFile(outFilePath)
+}
+
+// print PDF: the same page sequence as the print SVG of genPrintVersion, A4 plus bleed
+func (me *BookGen) genPrintPdf(dirRtl bool, lang string, numPages int, outFilePath string) {
+	printLn(outFilePath, "...")
+	const pgwmm, pghmm = 210.0, 297.0
+	doc, rnd, dpnope := pdfNew(me.pdfInfo(lang)), me.pdfRand(), os.Getenv("NOTOC") != "" && os.Getenv("NOCOV") != ""
+	var pg *PdfPage
+	isoddpage, dpbwidx, dpbwfilepaths := false, 0, make([]string, 0, len(me.Sheets))
+	for _, sv := range me.Sheets {
+		dpbwfilepaths = append(dpbwfilepaths, sv.Data.BwSmallFilePath)
+	}
+	rnd.Shuffle(len(dpbwfilepaths), func(i int, j int) {
+		dpbwfilepaths[i], dpbwfilepaths[j] = dpbwfilepaths[j], dpbwfilepaths[i]
+	})
+	pgstart := func() {
+		isoddpage, pg = !isoddpage, doc.page(pgwmm, pghmm, bookPrintBleedMm)
+	}
+	dpadd := func(closePage bool) {
+		if dpnope {
+			return
+		}
+		pgstart()
+		pg.op("q")
+		pg.opacity(fIf(closePage, 0.22, 0.11))
+		me.printEndPaperTiles(pgwmm, pghmm, &dpbwidx, len(dpbwfilepaths), rnd.Intn, func(x int, y int, rotDeg int) {
+			iw, ih := doc.imageSize(dpbwfilepaths[dpbwidx])
+			w, h := 44.0, 44.0*(float64(ih)/float64(iw))
+			cx, cy, rad := float64(x)+(w/2), float64(y)+(h/2), float64(rotDeg)*math.Pi/180
+			m := pdfMatMul(pdfMatMul([6]float64{1, 0, 0, 1, -cx, -cy}, [6]float64{math.Cos(rad), math.Sin(rad), -math.Sin(rad), math.Cos(rad), 0, 0}), [6]float64{1, 0, 0, 1, cx, cy})
+			pg.push(m[0], m[1], m[2], m[3], m[4], m[5])
+			pg.image(dpbwfilepaths[dpbwidx], float64(x), float64(y), w, h)
+			pg.pop()
+		})
+		if pg.pop(); closePage {
+			doc.pageEnd(pg)
+		}
+	}
+
+	dpadd(true)
+	dpadd(true)
+	if os.Getenv("NOTOC") == "" {
+		if dpadd(false); dpnope {
+			pgstart()
+		}
+		me.pdfToc(pg, lang, pgwmm, pghmm)
+		doc.pageEnd(pg)
+		dpadd(true)
+	}
+	fontpgnr := doc.font(me.pdfTextFontFamily(App.Proj.Sheets.Panel.SvgText[""]))
+	for i, l := 0, (len(me.Sheets)/2)+(len(me.Sheets)%2); i < l; i++ {
+		pgstart()
+		pgnr := itoa(len(doc.pages) + 1)
+		pg.text(fontpgnr, 4.4, nil, 0.5*pgwmm, 0.97*pghmm, pgnr, PdfTextStyle{})
+		x, w, y0, y1, ycollage := me.printPageLayout(i, isoddpage, pgwmm, pghmm)
+		pg.box("ArtBox", float64(x), float64(y0), float64(w), pghmm-float64(y0+bookPrintBorderMmLil))
+		me.pdfSheet(pg, me.Sheets[i*2], float64(x), float64(y0), float64(w), dirRtl, lang)
+		if (i*2)+1 < len(me.Sheets) {
+			me.pdfSheet(pg, me.Sheets[(i*2)+1], float64(x), y1, float64(w), dirRtl, lang)
+		} else if altsvgfilepath := "stuff/" + me.Phrase + "/collage.svg"; fileStat(altsvgfilepath) != nil {
+			altpngfilepath := me.ShmDirPath + "/collage.print.png"
+			imgAnyToPng(altsvgfilepath, altpngfilepath, 0, true, "", 0)
+			pg.image(altpngfilepath, float64(x), ycollage, float64(w), 0)
+		}
+		doc.pageEnd(pg)
+	}
+	dpadd(true)
+	for !dpnope && len(doc.pages) < numPages {
+		dpadd(true)
+	}
+	doc.writeFile(outFilePath)
+}
+
+func (me *BookGen) pdfToc(pg *PdfPage, lang string, pgWMm float64, pgHMm float64) {
+	tocs := me.tocSheetIdxs()
+	hastoclist := os.Getenv("NOTOC") == "" && len(tocs) > 1
+	fonttitle, fontsub := pg.doc.font("Shark Heavy ABC"), pg.doc.font("Gloria Hallelujah")
+	pg.text(fonttitle, 28.8, nil, pgWMm*0.1818, pgHMm*fIf(hastoclist, 0.1234, 0.5432), os.Getenv("TITLE"),
+		PdfTextStyle{FillGray: 1, StrokeGray: 0, StrokeWidth: 2.88})
+	if hastoclist {
+		ypc, pstep := 22.0, (94.0-22.0)/float64(len(tocs)-1)
+		for _, idx := range tocs {
+			chap, pgnr := me.Sheets[idx].parentSheet.parentChapter, 5+idx/2
+			style := PdfTextStyle{StrokeGray: 1, StrokeWidth: 1}
+			pg.text(fonttitle, 11.1, nil, pgWMm*0.0888, pgHMm*ypc/100, itoa0pref(pgnr, 2), style)
+			pg.text(fonttitle, 11.1, nil, pgWMm*0.0888+22, pgHMm*ypc/100, locStr(chap.Title, lang), style)
+			if subtext := me.tocSubText(chap, lang); subtext != "" {
+				pg.text(fontsub, 4.2, nil, pgWMm*0.24, pgHMm*(ypc+2.22)/100, subtext, PdfTextStyle{StrokeGray: 1, StrokeWidth: 0.5})
+			}
+			ypc += pstep
+		}
+	}
+}
+
+// the sheet (like genSheetSvg does) at x,y in mm and scaled to the given width in mm
+func (me *BookGen) pdfSheet(pg *PdfPage, sv *SheetVer, xMm float64, yMm float64, wMm float64, dirRtl bool, lang string) {
+	lores := (os.Getenv("LORES") != "")
+	scale := wMm / float64(sv.Data.pxBounds().Dx())
+	pg.push(scale, 0, 0, scale, xMm, yMm)
+	defer pg.pop()
+
+	panels, rowmids := me.sheetPanelsLayout(sv, dirRtl)
+	qidx := iIf(lores, 0, App.Proj.maxQualiIdx(false))
+	for _, p := range panels {
+		pidx, pw, ph := p.idx, float64(p.Rect.Dx()), float64(p.Rect.Dy())
+		pg.push(1, 0, 0, 1, float64(p.x), float64(p.y))
+		if len(p.Poly) > 0 {
+			pts := make([][2]float64, len(p.Poly))
+			for i, pt := range p.Poly {
+				pts[i] = [2]float64{float64(pt.X - p.Rect.Min.X), float64(pt.Y - p.Rect.Min.Y)}
+			}
+			pg.path(pts)
+		} else {
+			pg.rectPath(0, 0, pw, ph)
+		}
+		pg.clip()
+		if p.bgFilePath != "" {
+			pg.image(p.bgFilePath, 0, 0, pw, ph)
+		} else {
+			pg.rectPath(0, 0, pw, ph)
+			pg.paint(1, -1, 0)
+		}
+		var d string // the traced line art, crisp at any print resolution
+		if !lores && App.Proj.hasSvgQuali() {
+			d = imgTraceSvgPathDataFrom(fileRead(filepath.Join(sv.Data.PicDirPath(0), itoa(pidx)+".svg")))
+		}
+		if d != "" {
+			pg.svgPath(d)
+			pg.op("0 g f*")
+		} else {
+			pg.image(filepath.Join(sv.Data.PicDirPath(App.Proj.Qualis[qidx].SizeHint), itoa(pidx)+".png"), 0, 0, pw, ph)
+		}
+		if lang != "" {
+			me.pdfPanelText(pg, sv, pidx, p.ImgPanel, lang)
+		}
+		pg.pop()
+	}
+
+	if me.perRow.vertText != "" {
+		svgtxt := sv.parentSheet.parentChapter.GenPanelSvgText
+		fnt := pg.doc.font(me.pdfTextFontFamily(svgtxt))
+		rot := [6]float64{0, -1, 1, 0, 0, 0} // -90deg
+		for _, y := range slices.Sorted(maps.Keys(rowmids)) {
+			mat := pdfMatMul(rot, [6]float64{1, 0, 0, 1, float64(rowmids[y]), float64(y)})
+			pg.text(fnt, 177, &mat, 0, 0, me.perRow.vertText, PdfTextStyle{StrokeGray: 1, StrokeWidth: 22})
+		}
+	}
+}
+
+// the lettering of the panel (like genTextSvgForPanel does), as vector text
+func (me *BookGen) pdfPanelText(pg *PdfPage, sv *SheetVer, pidx int, panel *ImgPanel, lang string) {
+	svgtxt := sv.parentSheet.parentChapter.GenPanelSvgText
+	family, style := me.pdfTextFontFamily(svgtxt), PdfTextStyle{StrokeGray: pdfCssGray(svgtxt.Css[""]["stroke"], -1)}
+	if style.StrokeGray >= 0 {
+		style.StrokeWidth, _ = strconv.ParseFloat(strings.TrimSuffix(trim(svgtxt.Css[""]["stroke-width"]), "px"), 64)
+	}
+	style.FillGray = pdfCssGray(svgtxt.Css[""]["fill"], 0)
+	for _, pta := range sv.panelAreas(pidx) {
+		rx, ry := float64(pta.Rect.Min.X-panel.Rect.Min.X), float64(pta.Rect.Min.Y-panel.Rect.Min.Y)
+		if pta.PointTo != nil {
+			poly, strokewidth, _ := sv.panelAreaBoxPoly(panel, &pta)
+			pts := make([][2]float64, len(poly))
+			for i, pt := range poly {
+				pts[i] = [2]float64{float64(pt[0]), float64(pt[1])}
+			}
+			pg.path(pts)
+			pg.paint(1, 0, float64(strokewidth))
+		}
+		linex, fontsizecma4, perlinedycma4 := sv.panelAreaTextSizes(&pta)
+		pxfont, pxline := float64(int(sv.Data.PxCm*fontsizecma4*0.995)), float64(int(sv.Data.PxCm*perlinedycma4))
+		y0 := float64(iIf(pta.PointTo != nil, svgtxt.BoxPolyTopPx, 0))
+		mat := pdfMatMul(svgTransformMatrix(DeNewlineRepl.Replace(pta.SvgTextTransformAttr)), [6]float64{1, 0, 0, 1, rx, ry})
+		areafamily := family
+		if m := pdfCssFontFamily.FindStringSubmatch(pta.SvgTextTspanStyleAttr); len(m) > 1 {
+			areafamily = trim(m[1])
+		}
+		for i, ln := range strings.Split(pta.text(lang), "\n") {
+			x := linex
+			for _, seg := range bookPdfTextSegments(ln, svgtxt.TspanSubTagStyles) {
+				segstyle := style
+				segstyle.Bold, segstyle.Italic = seg.bold, seg.italic
+				x += pg.text(pg.doc.font(sIf(seg.family != "", seg.family, areafamily)), pxfont, &mat, x, y0+float64(i+1)*pxline, seg.text, segstyle)
+			}
+		}
+	}
+}
+
+func (*BookGen) pdfTextFontFamily(svgTxt *PanelSvgTextGen) string {
+	if svgTxt == nil {
+		return ""
+	} else if m := pdfCssFontFamily.FindStringSubmatch("font-family: " + svgTxt.Css[""]["font-family"]); len(m) > 1 {
+		return trim(m[1])
+	}
+	return ""
+}
+
+// splits a lettering line by its `<b>`, `<i>`, `<u>` and `TspanSubTagStyles` tags
+func bookPdfTextSegments(line string, tagStyles map[string]string) (ret []bookPdfTextSeg) {
+	var stack []string
+	var text string
+	flush := func() {
+		if text != "" {
+			seg := bookPdfTextSeg{text: text}
+			for _, tag := range stack {
+				switch tag {
+				case "b":
+					seg.bold = true
+				case "i":
+					seg.italic = true
+				case "u":
+				default:
+					css := tagStyles[tag]
+					if m := pdfCssFontFamily.FindStringSubmatch(css); len(m) > 1 {
+						seg.family = trim(m[1])
+					}
+					seg.bold, seg.italic = seg.bold || strings.Contains(css, "bold"), seg.italic || strings.Contains(css, "italic")
+				}
+			}
+			ret, text = append(ret, seg), ""
+		}
+	}
+	for len(line) > 0 {
+		idx := strings.IndexByte(line, '<')
+		if idx < 0 {
+			text += line
+			break
+		}
+		text, line = text+line[:idx], line[idx:]
+		end := strings.IndexByte(line, '>')
+		tag := ""
+		if end > 0 {
+			tag = line[1:end]
+		}
+		if name := strings.TrimPrefix(tag, "/"); name != "" && (name == "b" || name == "i" || name == "u" || tagStyles[name] != "") {
+			flush()
+			if tag[0] == '/' {
+				if i := slices.Index(stack, name); i >= 0 {
+					stack = slices.Delete(stack, i, i+1)
+				}
+			} else {
+				stack = append(stack, name)
+			}
+			line = line[end+1:]
+		} else {
+			text, line = text+"<", line[1:]
+		}
+	}
+	flush()
+	return
+}
+
+// 0 for black .. 1 for white, from a CSS color
+func pdfCssGray(cssColor string, defaultGray float64) float64 {
+	switch cssColor = strings.ToLower(trim(strings.TrimSuffix(trim(cssColor), "!important"))); cssColor {
+	case "":
+		return defaultGray
+	case "none", "transparent":
+		return -1
+	case "black":
+		return 0
+	case "white":
+		return 1
+	}
+	if hex := strings.TrimPrefix(cssColor, "#"); len(hex) == 3 || len(hex) == 6 {
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if rgb, err := strconv.ParseUint(hex, 16, 32); err == nil {
+			return (0.299*float64(rgb>>16) + 0.587*float64((rgb>>8)&0xff) + 0.114*float64(rgb&0xff)) / 255
+		}
+	}
+	return defaultGray
+}
+
+func (me *BookGen) genPrintCoverPdf(title string, numPages int, outFilePath string) {
+	printLn(outFilePath, "...")
+	svgw, svgh := me.printCoverSize(numPages)
+	spinex, marginmm := (svgw*0.5)-(float64(bookPrintCoverSpineMm)*0.5), bookPrintCoverMarginMm
+	doc := pdfNew(me.pdfInfo(""))
+	pg := doc.page(svgw, svgh, 0)
+	pg.rectPath(spinex, 0, bookPrintCoverSpineMm, svgh)
+	pg.paint(0, -1, 0)
+	mat := [6]float64{0, 1, -1, 0, 0.5 + (svgw * 0.5), svgh / 3.0} // vertical, top to bottom
+	pg.text(doc.font("Shark Heavy ABC"), 8.88, &mat, 0, -0.35*8.88, title, PdfTextStyle{FillGray: 1})
+
+	faces := me.facesPicPaths()
+	areawidth, areaheight := spinex-marginmm, svgh-(marginmm*2.0)
+	fperrow, fpercol := me.facesDistr(len(faces), areawidth, areaheight, true)
+	me.facesLayout(faces, fperrow, fpercol, areawidth, areaheight, svgw, svgh, spinex+float64(bookPrintCoverSpineMm), marginmm, false, func(x float64, y float64, wh float64, face string) {
+		pg.image(face, x, y, wh, wh)
+	})
+	doc.pageEnd(pg)
+	doc.writeFile(outFilePath)
+}
@@ -27,6 +27,12 @@ type siteGen struct {
 	maxPicSize uint32
 	sheetPgNrs map[*SheetVer]int
 	dummy      bool
+	manifest   *siteGenManifest
+	inputs     struct {
+		base     string
+		all      string
+		chapters map[*Chapter]string
+	}
 }
 
 type PageGen struct {
@@ -63,21 +69,23 @@ type PageGen struct {
 	SvgTextIdent   string
 }
 
-func (me siteGen) genSite(fromGui bool, _ map[string]bool) {
+func (me siteGen) genSite(fromGui bool, flags map[string]bool) {
 	var err error
 	tstart := time.Now()
 	me.series, me.sheetPgNrs, me.dummy = App.Proj.Series, map[*SheetVer]int{}, (os.Getenv("DUMMY") != "")
 	printLn("SiteGen started. When done, result will open in new window.")
+	App.Report.reset("gen")
 	if fromGui {
-		defer func() {
-			if err := recover(); err != nil {
-				printLn("SiteGen Error: ", err)
-			}
-		}()
+		defer App.Report.catch("gen", nil, nil)
+	}
+	fullregen := flags["full"] || os.Getenv("FULLREGEN") != ""
+	if fullregen {
+		rmDir(".build")
 	}
-	rmDir(".build")
 	mkDir(".build")
 	mkDir(".build/" + App.Proj.Site.Gen.PicDirName)
+	me.manifest = &siteGenManifest{}
+	me.manifest.load(fullregen)
 
 	timedLogged("SiteGen: copying static files to .build...", func() string {
 		numfilescopied := me.copyStaticFiles("")
@@ -176,7 +184,7 @@ func (me siteGen) genSite(fromGui bool, _ map[string]bool) {
 						for _, chapter := range series.Chapters {
 							if chapter.isTransl(me.lang) {
 								numfileswritten++
-								totalsize += uint64(len(me.genSvgTextsFile(chapter)))
+								totalsize += me.genSvgTextsFile(chapter)
 							}
 						}
 					}
@@ -189,7 +197,16 @@ func (me siteGen) genSite(fromGui bool, _ map[string]bool) {
 		return "for " + itoa(numfileswritten) + " files (~" + strSize(totalsize) + ")"
 	})
 
+	timedLogged("SiteGen: removing orphaned files from .build...", func() string {
+		numremoved := me.manifest.removeOrphans()
+		me.manifest.save()
+		return "for " + itoa(numremoved) + " files"
+	})
+
 	printLn("SiteGen: " + App.Proj.Site.Host + " DONE after " + time.Now().Sub(tstart).String())
+	if flags["nobrowser"] {
+		return
+	}
 	cmd := exec.Command(browserCmd[0], append(browserCmd[1:], "--app=file://"+os.Getenv("PWD")+"/.build/index.html")...)
 	if err := cmd.Start(); err != nil {
 		printLn("[ERR]\tcmd.Start of " + cmd.String() + ":\t" + err.Error())
@@ -236,8 +253,9 @@ func (me *siteGen) copyStaticFiles(relDirPath string) (numFilesWritten int) {
 					data = append(data, css...)
 				}
 			}
-			fileWrite(dstpath, data)
-			numFilesWritten++
+			if me.writeIfChanged(dstpath, data) {
+				numFilesWritten++
+			}
 		}
 		for _, fileinfo := range fileinfos {
 			fn := fileinfo.Name()
@@ -247,9 +265,9 @@ func (me *siteGen) copyStaticFiles(relDirPath string) (numFilesWritten int) {
 				mkDir(dstpath)
 				numFilesWritten += me.copyStaticFiles(relpath)
 			} else if fn != siteTmplFileName {
-				data := fileRead(filepath.Join(srcdirpath, fn))
-				fileWrite(dstpath, data)
-				numFilesWritten++
+				if data := fileRead(filepath.Join(srcdirpath, fn)); me.writeIfChanged(dstpath, data) {
+					numFilesWritten++
+				}
 			}
 		}
 	}
@@ -270,12 +288,15 @@ func (me *siteGen) genOrCopyPanelPics() (numSvgs uint32, numPngs uint32, numShee
 					work.Add(1)
 					go func(chapter *Chapter, sheet *Sheet) {
 						for _, sv := range sheet.versions {
-							nsvgs, npngs, npnls, totalsize := me.genOrCopyPanelPicsOf(sv)
-							atomic.AddUint32(&numSheets, 1)
-							atomic.AddUint32(&numPngs, npngs)
-							atomic.AddUint32(&numPanels, npnls)
-							atomic.AddUint32(&numSvgs, nsvgs)
-							atomic.AddUint64(&totalSize, totalsize)
+							func() {
+								defer App.Report.catch("gen", sv, nil)
+								nsvgs, npngs, npnls, totalsize := me.genOrCopyPanelPicsOf(sv)
+								atomic.AddUint32(&numSheets, 1)
+								atomic.AddUint32(&numPngs, npngs)
+								atomic.AddUint32(&numPanels, npnls)
+								atomic.AddUint32(&numSvgs, nsvgs)
+								atomic.AddUint64(&totalSize, totalsize)
+							}()
 						}
 						work.Done()
 					}(chapter, sheet)
@@ -286,8 +307,10 @@ func (me *siteGen) genOrCopyPanelPics() (numSvgs uint32, numPngs uint32, numShee
 						splits := strings.Split(num, "_")
 						for i, num := range splits {
 							outfilepath := ".build/" + App.Proj.Site.Gen.PicDirName + "/" + sv.parentSheet.parentChapter.parentSeries.Name + "-" + year + "-" + num + ".png"
-							fileLinkOrCopy(strings.ReplaceAll(pngfilepath, ".1.", "."+itoa(i+1)+"."), outfilepath)
-							atomic.AddUint32(&numPngs, 1)
+							if srcfilepath := strings.ReplaceAll(pngfilepath, ".1.", "."+itoa(i+1)+"."); fileStat(srcfilepath) != nil {
+								me.linkOrCopyIfChanged(srcfilepath, outfilepath, nil)
+								atomic.AddUint32(&numPngs, 1)
+							}
 						}
 					}
 				}
@@ -324,7 +347,7 @@ func (me *siteGen) genOrCopyPanelPicsOf(sv *SheetVer) (numSvgs uint32, numPngs u
 					}
 					atomic.AddUint64(&totalSize, uint64(fileinfo.Size()))
 					dstpath := filepath.Join(".build", App.Proj.Site.Gen.PicDirName, me.namePanelPic(sv, pidx, quali.SizeHint)+fext)
-					fileLinkOrCopy(srcpath, dstpath)
+					me.linkOrCopyIfChanged(srcpath, dstpath, fileinfo)
 					if me.onPicSize != nil {
 						me.onPicSize(sv.parentSheet.parentChapter, sv.ID+itoa(pidx), qidx, fileinfo.Size())
 					}
@@ -339,7 +362,7 @@ func (me *siteGen) genOrCopyPanelPicsOf(sv *SheetVer) (numSvgs uint32, numPngs u
 				if fileinfo := fileStat(srcpath); fileinfo != nil {
 					atomic.AddUint64(&totalSize, uint64(fileinfo.Size()))
 					dstpath := filepath.Join(".build", App.Proj.Site.Gen.PicDirName, sv.DtStr()+sv.ID+itoa(pidx)+"bg.png")
-					fileLinkOrCopy(srcpath, dstpath)
+					me.linkOrCopyIfChanged(srcpath, dstpath, fileinfo)
 					atomic.AddUint32(&numPngs, 1)
 				}
 			}
@@ -349,7 +372,7 @@ func (me *siteGen) genOrCopyPanelPicsOf(sv *SheetVer) (numSvgs uint32, numPngs u
 	})
 
 	if homepicname := sv.homePicName(); homepicname != "" && fileStat(sv.Data.HomePic) != nil {
-		fileLinkOrCopy(sv.Data.HomePic, filepath.Join(".build", App.Proj.Site.Gen.PicDirName, homepicname))
+		me.linkOrCopyIfChanged(sv.Data.HomePic, filepath.Join(".build", App.Proj.Site.Gen.PicDirName, homepicname), nil)
 		atomic.AddUint32(&numPngs, 1)
 	}
 	work.Wait()
@@ -357,9 +380,22 @@ func (me *siteGen) genOrCopyPanelPicsOf(sv *SheetVer) (numSvgs uint32, numPngs u
 }
 
 func (me *siteGen) genPages(chapter *Chapter, pageNr int, totalSizeRec *uint64) (numFilesWritten int) {
+	perctransl := itoa(int(App.Proj.percentTranslated(me.lang, nil, nil, nil, -1)))
 	homename, repl := me.namePage(nil, 0, 0, "", "", "", 0, false), strings.NewReplacer(
-		"%LANG"+me.lang+"%", itoa(int(App.Proj.percentTranslated(me.lang, nil, nil, nil, -1))),
+		"%LANG"+me.lang+"%", perctransl,
 	)
+
+	unitname, inputs := "pages."+me.lang+sIf(me.dirRtl, ".rtl", ".ltr")+sIf(me.bgCol, ".col", ".bw"), siteGenInputsHash(me.inputsHashAll(), perctransl)
+	if chapter != nil {
+		unitname, inputs = unitname+"."+chapter.parentSeries.Name+"."+chapter.Name+"."+itoa(pageNr), siteGenInputsHash(me.inputsHashChapter(chapter), perctransl)
+	}
+	if uptodate, size := me.manifest.unitUpToDate(unitname, inputs); uptodate {
+		me.noteSheetPgNrs(chapter, pageNr)
+		*totalSizeRec = *totalSizeRec + size
+		return
+	}
+	sizebefore := *totalSizeRec
+	defer func() { me.manifest.unitDone(*totalSizeRec - sizebefore) }()
 	me.page = PageGen{
 		SiteTitle:  sIf(me.dummy, "Site", App.Proj.Site.Title),
 		SiteHost:   sIf(me.dummy, " site.host", App.Proj.Site.Host),
@@ -486,7 +522,9 @@ func (me *siteGen) genPages(chapter *Chapter, pageNr int, totalSizeRec *uint64)
 					numFilesWritten += me.genPageExecAndWrite(pagename, chapter, totalSizeRec)
 					if chapter.UrlJumpName != "" && viewmode == viewModes[0] && qidx == 1 &&
 						pageNr <= 1 && (me.bgCol || !chapter.hasBgCol()) && !me.dirRtl {
-						fileLinkOrCopy(".build/"+pagename+".html", ".build/"+chapter.UrlJumpName+sIf(me.lang == App.Proj.Langs[0], "", "."+me.lang)+".html")
+						jumpfilepath := ".build/" + chapter.UrlJumpName + sIf(me.lang == App.Proj.Langs[0], "", "."+me.lang) + ".html"
+						fileLinkOrCopy(".build/"+pagename+".html", jumpfilepath)
+						me.manifest.wrote(jumpfilepath)
 						numFilesWritten++
 					}
 				}
@@ -496,6 +534,21 @@ func (me *siteGen) genPages(chapter *Chapter, pageNr int, totalSizeRec *uint64)
 	return
 }
 
+// records the page numbers of the sheets on the specified chapter page, for when
+// `genPages` skips (via the manifest) the `prepSheetPage` that would normally do it
+func (me *siteGen) noteSheetPgNrs(chapter *Chapter, pageNr int) {
+	if chapter == nil {
+		return
+	}
+	for i, sheet := range chapter.sheets {
+		if chapter.isSheetOnPgNr(pageNr, i) {
+			for _, sv := range sheet.versions {
+				me.sheetPgNrs[sv] = pageNr
+			}
+		}
+	}
+}
+
 const noice = true
 
 func (me *siteGen) prepHomePage() {
@@ -758,7 +811,9 @@ func (me *siteGen) prepSheetPage(qIdx int, viewMode string, chapter *Chapter, sv
 			}
 
 			s += "<div id='" + firstpanel + App.Proj.Site.Gen.ClsPanel + "p" + sv.ID + itoa(pidx) + "' class='" + App.Proj.Site.Gen.ClsPanel + "'"
-			firstpanel = ""
+			if firstpanel = ""; len(panel.Poly) > 0 || panel.Z != 0 {
+				s += " style='" + panel.cssClipPath() + sIf(panel.Z == 0, "", "position: relative; z-index: "+itoa(panel.Z)+";") + "'"
+			}
 			s += ">" + sv.genTextSvgForPanel(pidx, panel, me.lang, true, false)
 			me.sheetPgNrs[sv] = pageNr
 			s += "<img src='./" + sIf(os.Getenv("NOPICS") != "", "files/white.png", App.Proj.Site.Gen.PicDirName+"/"+imgfilename) + "'"
@@ -863,6 +918,7 @@ func (me *siteGen) genPageExecAndWrite(name string, chapter *Chapter, totalSizeR
 	outfilepath := ".build/" + strings.ToLower(name) + ".html"
 	*totalSizeRec = *totalSizeRec + uint64(buf.Len())
 	fileWrite(outfilepath, buf.Bytes())
+	me.manifest.wrote(outfilepath)
 	numFilesWritten++
 	return
 }
@@ -871,7 +927,11 @@ func (me *siteGen) textStr(key string) string {
 	return App.Proj.textStr(me.lang, key)
 }
 
-func (me *siteGen) genSvgTextsFile(chapter *Chapter) string {
+func (me *siteGen) genSvgTextsFile(chapter *Chapter) (numBytes uint64) {
+	outfilepath := ".build/t." + chapter.parentSeries.Name + "." + chapter.Name + "." + me.lang + ".svg"
+	if uptodate, size := me.manifest.unitUpToDate("svgtexts."+me.lang+"."+chapter.parentSeries.Name+"."+chapter.Name, me.inputsHashChapter(chapter)); uptodate {
+		return size
+	}
 	svg := `<?xml version="1.0" encoding="UTF-8" standalone="no"?><svg
 				xmlns="http://www.w3.org/2000/svg" xmlns:svg="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">`
 	for _, sheet := range chapter.sheets {
@@ -887,8 +947,11 @@ func (me *siteGen) genSvgTextsFile(chapter *Chapter) string {
 		}
 	}
 	svg += `</svg>`
-	fileWrite(".build/t."+chapter.parentSeries.Name+"."+chapter.Name+"."+me.lang+".svg", []byte(svg))
-	return svg
+	fileWrite(outfilepath, []byte(svg))
+	me.manifest.wrote(outfilepath)
+	numBytes = uint64(len(svg))
+	me.manifest.unitDone(numBytes)
+	return
 }
 
 func (me *siteGen) genAtomXml(totalSizeRec *uint64) (numFilesWritten int) {
@@ -972,8 +1035,9 @@ func (me *siteGen) genAtomXml(totalSizeRec *uint64) (numFilesWritten int) {
 		s += `<updated>` + tlatest + `Z</updated><title>` + hEsc(App.Proj.Site.Title) + `</title><link href="https://` + App.Proj.Site.Host + `"/><link rel="self" href="https://` + App.Proj.Site.Host + `/` + filename + `"/><id>http://` + App.Proj.Site.Host + "/</id>"
 		s += "\n" + strings.Join(xmls, "\n") + "\n</feed>"
 		*totalSizeRec = *totalSizeRec + uint64(len(s))
-		fileWrite(".build/"+af.Name+"."+me.lang+".atom", []byte(s))
-		numFilesWritten++
+		if me.writeIfChanged(".build/"+filename, []byte(s)) {
+			numFilesWritten++
+		}
 	}
 	return
 }
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const siteGenManifestFilePath = ".build/.manifest.json"
+
+// records, per `.build` output, a hash of whatever went into producing it, so
+// that subsequent `gen` runs can skip re-writing any outputs whose inputs are unchanged
+type siteGenManifest struct {
+	Outs  map[string]string               // output file path -> inputs (or content) hash
+	Units map[string]*siteGenManifestUnit // multi-output jobs (eg. all pages of a chapter-page) by name
+
+	mu      sync.Mutex
+	touched map[string]bool
+	cur     *siteGenManifestUnit
+}
+
+type siteGenManifestUnit struct {
+	Inputs string
+	Outs   []string
+	Size   uint64
+}
+
+func siteGenInputsHash(parts ...string) string {
+	return contentHashStr([]byte(strings.Join(parts, "\x00")))
+}
+
+func (me *siteGenManifest) load(fresh bool) {
+	me.Outs, me.Units, me.touched = map[string]string{}, map[string]*siteGenManifestUnit{}, map[string]bool{}
+	if !fresh && fileStat(siteGenManifestFilePath) != nil {
+		jsonLoad(siteGenManifestFilePath, nil, me)
+		if me.Outs == nil {
+			me.Outs = map[string]string{}
+		}
+		if me.Units == nil {
+			me.Units = map[string]*siteGenManifestUnit{}
+		}
+	}
+}
+
+func (me *siteGenManifest) save() {
+	jsonSave(siteGenManifestFilePath, me)
+}
+
+// reports whether outFilePath exists and was last produced from inputsHash.
+// Either way, outFilePath counts as a current output (not an orphan) afterwards.
+func (me *siteGenManifest) upToDate(outFilePath string, inputsHash string) bool {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.touched[outFilePath] = true
+	return me.Outs[outFilePath] == inputsHash && fileStat(outFilePath) != nil
+}
+
+func (me *siteGenManifest) did(outFilePath string, inputsHash string) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.touched[outFilePath], me.Outs[outFilePath] = true, inputsHash
+}
+
+// records outFilePath as (re)written for the currently ongoing unit
+func (me *siteGenManifest) wrote(outFilePath string) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.touched[outFilePath] = true
+	if me.cur != nil {
+		me.cur.Outs, me.Outs[outFilePath] = append(me.cur.Outs, outFilePath), me.cur.Inputs
+	}
+}
+
+// reports whether all outputs of the named unit exist and were last produced from inputsHash.
+// If not, the unit is (re)started and subsequent `wrote` calls record into it until `unitDone`.
+func (me *siteGenManifest) unitUpToDate(name string, inputsHash string) (upToDate bool, size uint64) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if unit := me.Units[name]; unit != nil && unit.Inputs == inputsHash {
+		upToDate = true
+		for _, outfilepath := range unit.Outs {
+			if upToDate = (fileStat(outfilepath) != nil) && me.Outs[outfilepath] == inputsHash; !upToDate {
+				break
+			}
+		}
+		if upToDate {
+			for _, outfilepath := range unit.Outs {
+				me.touched[outfilepath] = true
+			}
+			return true, unit.Size
+		}
+	}
+	me.cur = &siteGenManifestUnit{Inputs: inputsHash}
+	me.Units[name] = me.cur
+	return
+}
+
+func (me *siteGenManifest) unitDone(size uint64) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.cur != nil {
+		me.cur.Size, me.cur = size, nil
+	}
+}
+
+// removes all files in `.build` not produced or confirmed during the current run
+func (me *siteGenManifest) removeOrphans() (numRemoved int) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if err := filepath.WalkDir(".build", func(fsPath string, dirEntry fs.DirEntry, err error) error {
+		if err == nil && !(dirEntry.IsDir() || fsPath == siteGenManifestFilePath || me.touched[fsPath]) {
+			if err = os.Remove(fsPath); err == nil {
+				numRemoved++
+			}
+		}
+		return err
+	}); err != nil {
+		panic(err)
+	}
+	for outfilepath := range me.Outs {
+		if !me.touched[outfilepath] {
+			delete(me.Outs, outfilepath)
+		}
+	}
+	for name, unit := range me.Units {
+		if len(unit.Outs) == 0 || !me.touched[unit.Outs[0]] {
+			delete(me.Units, name)
+		}
+	}
+	return
+}
+
+// the inputs hash of all non-page-specific inputs: config, template, env switches
+func (me *siteGen) inputsHashBase() string {
+	if me.inputs.base == "" {
+		me.inputs.base = siteGenInputsHash(
+			contentHashStr(fileRead("cx.json")),
+			contentHashStr(fileRead(filepath.Join(siteTmplDirName, siteTmplFileName))),
+			os.Getenv("NOPICS"), os.Getenv("NOLINKS"), strconv.FormatBool(me.dummy),
+		)
+	}
+	return me.inputs.base
+}
+
+// the inputs hash of everything a chapter's outputs derive from: sheet-version IDs
+// and prep data, its `_txt.json` slices and its `PanelSvgTextGen`, plus the cross-chapter
+// navigation inputs (its neighbouring chapters' names, titles and sheet counts)
+func (me *siteGen) inputsHashChapter(chapter *Chapter) string {
+	if me.inputs.chapters == nil {
+		me.inputs.chapters = map[*Chapter]string{}
+	}
+	if s := me.inputs.chapters[chapter]; s != "" {
+		return s
+	}
+	parts := []string{me.inputsHashBase(), chapter.parentSeries.Name, chapter.Name,
+		toJsonStr(chapter.GenPanelSvgText), itoa(chapter.parentSeries.numNonPrivChaptersWithSheets())}
+	if idx := indexOf(chapter.parentSeries.Chapters, chapter); idx >= 0 {
+		for _, i := range []int{idx - 1, idx + 1} {
+			if i >= 0 && i < len(chapter.parentSeries.Chapters) {
+				neighbour := chapter.parentSeries.Chapters[i]
+				parts = append(parts, neighbour.Name, neighbour.UrlName, toJsonStr(neighbour.Title),
+					strconv.FormatBool(neighbour.Priv), itoa(len(neighbour.sheets)))
+			}
+		}
+	}
+	for _, sheet := range chapter.sheets {
+		for _, sv := range sheet.versions {
+			parts = append(parts, sv.ID, sv.DtName(), toJsonStr(App.Proj.data.Sv.textRects[sv.ID]))
+			if sv.Data != nil {
+				parts = append(parts, toJsonStr(sv.Data), sv.Data.hasBgCol)
+			}
+		}
+	}
+	me.inputs.chapters[chapter] = siteGenInputsHash(parts...)
+	return me.inputs.chapters[chapter]
+}
+
+// the inputs hash of outputs (such as home pages) that derive from all chapters
+func (me *siteGen) inputsHashAll() string {
+	if me.inputs.all == "" {
+		parts := []string{me.inputsHashBase()}
+		for _, series := range App.Proj.Series {
+			for _, chapter := range series.Chapters {
+				parts = append(parts, me.inputsHashChapter(chapter))
+			}
+		}
+		me.inputs.all = siteGenInputsHash(parts...)
+	}
+	return me.inputs.all
+}
+
+// the inputs hash of a copied or linked-to source file
+func (me *siteGen) inputsHashSrcFile(srcFilePath string, fileInfo os.FileInfo) string {
+	if fileInfo == nil {
+		fileInfo = fileStat(srcFilePath)
+	}
+	return siteGenInputsHash(srcFilePath, strconv.FormatInt(fileInfo.Size(), 10),
+		strconv.FormatInt(fileInfo.ModTime().UnixNano(), 10), os.Getenv("NOLINKS"))
+}
+
+func (me *siteGen) linkOrCopyIfChanged(srcFilePath string, dstFilePath string, srcFileInfo os.FileInfo) bool {
+	if inputs := me.inputsHashSrcFile(srcFilePath, srcFileInfo); !me.manifest.upToDate(dstFilePath, inputs) {
+		fileLinkOrCopy(srcFilePath, dstFilePath)
+		me.manifest.did(dstFilePath, inputs)
+		return true
+	}
+	return false
+}
+
+func (me *siteGen) writeIfChanged(dstFilePath string, data []byte) bool {
+	if chash := contentHashStr(append([]byte{0}, data...)); !me.manifest.upToDate(dstFilePath, chash) {
+		fileWrite(dstFilePath, data)
+		me.manifest.did(dstFilePath, chash)
+		return true
+	}
+	return false
+}
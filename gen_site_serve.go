@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const siteServeReloadScript = `<script>(function(){var rev=null;setInterval(function(){fetch('/.serve.rev',{cache:'no-store'}).then(function(r){return r.text();}).then(function(t){if(rev!==null&&t!==rev)location.reload();rev=t;}).catch(function(){});},1234);})();</script>`
+
+var siteServeRev int64
+
+// serves `.build` headlessly (no kiosk GUI, no browser) on $PORT (default 4322),
+// polling the project inputs for changes and re-running the (incremental) site gen
+// on each, while served pages auto-reload whenever such a re-gen completes.
+// Command-line only (see appMainAction), as it blocks and swaps out `App.Proj`.
+func siteServe(flags map[string]bool) {
+	addr := ":" + sIf(os.Getenv("PORT") == "", "4322", os.Getenv("PORT"))
+	App.Gui.Exiting.Store(false)
+	sigint := make(chan os.Signal, 1)
+	signal.Notify(sigint, os.Interrupt)
+	go func() { <-sigint; App.Gui.Exiting.Store(true) }()
+
+	fingerprints := siteServeFingerprints()
+	siteServeRegen(flags)
+	delete(flags, "full") // only ever for the initial gen
+	go httpListenAndServe(addr, httpHandleSiteServe)
+	printLn("Serving .build on http://localhost" + addr + " and watching for changes, Ctrl+C to stop.")
+
+	for ; !App.Gui.Exiting.Load(); time.Sleep(time.Second) {
+		cur := siteServeFingerprints()
+		if cur["proj"] != fingerprints["proj"] {
+			printLn("Change detected in cx.json, scans or storyboards: reloading project...")
+			App.Proj = Project{}
+			timedLogged("Loading project (cx.json  &  _txt.json  &  _data.json)...", func() string {
+				return "for " + itoa(App.Proj.load()) + " sheets"
+			})
+			appPrepWork(false)
+		} else if cur["txt"] != fingerprints["txt"] {
+			printLn("Change detected in _txt.json: reloading texts...")
+			App.Proj.txtLoad()
+		} else if cur["site"] == fingerprints["site"] {
+			continue
+		}
+		fingerprints = cur
+		siteServeRegen(flags)
+	}
+}
+
+// re-gens without a full rebuild, so that only outputs with changed inputs get rewritten
+func siteServeRegen(flags map[string]bool) {
+	defer App.Report.catch("gen", nil, nil)
+	genflags := map[string]bool{"nobrowser": true}
+	for k, v := range flags {
+		genflags[k] = v
+	}
+	siteGen{}.genSite(false, genflags)
+	atomic.AddInt64(&siteServeRev, 1)
+}
+
+// a cheap (names, sizes, mod-times) fingerprint per category of watched inputs
+func siteServeFingerprints() map[string]string {
+	fingerprint := func(fsPaths ...string) string {
+		var buf strings.Builder
+		for _, fspath := range fsPaths {
+			if fspath == "" {
+				continue
+			}
+			_ = filepath.WalkDir(fspath, func(fsPath string, dirEntry fs.DirEntry, err error) error {
+				if err != nil || !dirEntry.Type().IsRegular() { // skips the symlinks that project loading (re)creates in scans/
+					return nil
+				}
+				if fileinfo, err := dirEntry.Info(); err == nil {
+					buf.WriteString(fsPath + "\t" + strconv.FormatInt(fileinfo.Size(), 10) + "\t" + strconv.FormatInt(fileinfo.ModTime().UnixNano(), 10) + "\n")
+				}
+				return nil
+			})
+		}
+		return buf.String()
+	}
+	return map[string]string{
+		"proj": fingerprint("cx.json", "scans", App.Proj.Site.StoryboardsDir),
+		"txt":  fingerprint(storeTxtFileName, storeTxtJournalPath),
+		"site": fingerprint(siteTmplDirName),
+	}
+}
+
+func httpHandleSiteServe(httpResp http.ResponseWriter, httpReq *http.Request) {
+	atomic.AddInt32(&numBusyRequests, 1)
+	defer func() { atomic.AddInt32(&numBusyRequests, -1) }()
+
+	urlpath := httpReq.URL.Path
+	if urlpath == "/.serve.rev" {
+		httpResp.Header().Add("Content-Type", "text/plain")
+		httpResp.Header().Add("Cache-Control", "no-store")
+		_, _ = httpResp.Write([]byte(strconv.FormatInt(atomic.LoadInt64(&siteServeRev), 10)))
+		return
+	}
+	if strings.HasSuffix(urlpath, "/") {
+		urlpath += "index.html"
+	}
+	filename := filepath.Join(".build", path.Clean("/"+urlpath))
+	if path.Ext(filename) != ".html" {
+		http.ServeFile(httpResp, httpReq, filename)
+		return
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		http.NotFound(httpResp, httpReq)
+		return
+	}
+	if idx := bytes.LastIndex(data, []byte("</body>")); idx >= 0 {
+		data = append(data[:idx:idx], append([]byte(siteServeReloadScript), data[idx:]...)...)
+	} else {
+		data = append(data, siteServeReloadScript...)
+	}
+	httpResp.Header().Add("Content-Type", "text/html")
+	httpResp.Header().Add("Cache-Control", "no-store")
+	_, _ = httpResp.Write(data)
+}
@@ -4,6 +4,7 @@ go 1.24.4
 
 require (
 	github.com/AllenDang/giu v0.14.1
+	github.com/anthonynsimon/bild v0.14.0
 	github.com/go-forks/gopnm v0.0.0-20210619140034-9b41b71b5588
 	golang.org/x/image v0.29.0
 )
@@ -11,7 +12,6 @@ require (
 require (
 	github.com/AllenDang/cimgui-go v1.3.2-0.20250409185506-6b2ff1aa26b5 // indirect
 	github.com/AllenDang/go-findfont v0.0.0-20200702051237-9f180485aeb8 // indirect
-	github.com/anthonynsimon/bild v0.14.0 // indirect
 	github.com/faiface/mainthread v0.0.0-20171120011319-8b78f0a41ae3 // indirect
 	github.com/gucio321/glm-go v0.0.0-20241029220517-e1b5a3e011c8 // indirect
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
@@ -24,5 +24,6 @@ require (
 	golang.design/x/hotkey v0.4.1 // indirect
 	golang.design/x/mainthread v0.3.0 // indirect
 	golang.org/x/sys v0.25.0 // indirect
+	golang.org/x/text v0.27.0 // indirect
 	gopkg.in/eapache/queue.v1 v1.1.0 // indirect
 )
@@ -2,12 +2,14 @@ package main
 
 import (
 	"image"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -19,6 +21,9 @@ func fV(r *http.Request) func(string) string {
 }
 
 func guiMain(r *http.Request, notice string) []byte {
+	if inboxnotice := inboxApply(); inboxnotice != "" {
+		notice = strings.TrimSpace(notice + "  " + inboxnotice)
+	}
 	svgtxt, fv, dirpref, s := App.Proj.Sheets.Panel.SvgText[""], fV(r), "", "<!DOCTYPE html><html lang='en'><head><meta charset='utf-8'><link rel='stylesheet' type='text/css' href='/main.css'/><style type='text/css'>"+App.Proj.cssFontFaces(strings.NewReplacer("./", "/files/"))
 	App.Gui.State.Sel.Series, _ = guiGetFormSel(fv("series"), &App.Proj).(*Series)
 	if series := App.Gui.State.Sel.Series; series != nil {
@@ -47,9 +52,14 @@ func guiMain(r *http.Request, notice string) []byte {
 	if notice != "" {
 		s += "<div class='notice'>" + hEsc(notice) + "</div>"
 	}
-	if scanJobNotice != "" && fv("scannow") == "" {
-		s += "<div class='notice'>Most recent scan job: <b>" + hEsc(scanJobNotice) + "</b> (details if any in stdio)</div>"
-		scanJobNotice = ""
+	if jobs := scanQueueJobs(nil); len(jobs) > 0 {
+		var numbusy, numfailed int
+		for _, sj := range jobs {
+			numbusy, numfailed = numbusy+iIf(sj.State != scanJobDone && sj.State != scanJobFailed, 1, 0), numfailed+iIf(sj.State == scanJobFailed, 1, 0)
+		}
+		if numbusy > 0 || numfailed > 0 {
+			s += "<div class='notice'>Scan queue: <b>" + itoa(numbusy) + "</b> job(s) in progress, <b>" + itoa(numfailed) + "</b> failed (details in the chapters' scan panes)</div>"
+		}
 	}
 
 	var numseries, numchapters, numsheets int
@@ -120,6 +130,20 @@ func guiMain(r *http.Request, notice string) []byte {
 }
 
 func guiStartView() (s string) {
+	if counts, running := prepCounts(); !prepAllDone() && counts[PrepQueued]+counts[PrepRunning] > 0 {
+		s += "<div class='notice prep'><b>Prepping sheets:</b> " + itoa(counts[PrepQueued]) + " queued, " + itoa(counts[PrepRunning]) + " running, " + itoa(counts[PrepDone]) + " done, " + itoa(counts[PrepFailed]) + " failed<ul>"
+		for _, job := range running {
+			s += "<li>" + hEsc(job.Sv.parentSheet.name) + " (" + hEsc(job.Sv.FileName) + "): <b>" + sIf(job.Stage == "", "starting", job.Stage) + "</b> since " + time.Since(job.started).Round(time.Second).String() + "</li>"
+		}
+		s += "</ul></div>"
+	}
+	if entries := App.Report.of(App.Gui.State.Sel.Series, App.Gui.State.Sel.Chapter); len(entries) > 0 {
+		s += "<div class='notice report'><b>" + itoa(len(entries)) + " problem(s) reported</b> (affected sheets are skipped):<ul>"
+		for _, entry := range entries {
+			s += "<li title='" + hEsc(entry.Dt.Format("15:04:05")) + "'>" + hEsc(entry.String()) + "</li>"
+		}
+		s += "</ul></div>"
+	}
 	for _, series := range App.Proj.Series {
 		if App.Gui.State.Sel.Series == nil || App.Gui.State.Sel.Series == series {
 			for _, chapter := range series.Chapters {
@@ -154,11 +178,18 @@ func guiStartView() (s string) {
 								s += " style='visibility:hidden'"
 							}
 							s += ">p" + itoa(pgnr) + "</span>&nbsp;&nbsp;&horbar;&nbsp;&nbsp;" + a + hEsc(sheet.name) + "</a>"
+							if job, ok := prepJobOf(sv); ok && job.State != PrepDone {
+								s += "<small>&nbsp;&nbsp;&horbar;&nbsp;&nbsp;prep: <b>" + job.State.String() + "</b>" + sIf(job.Stage == "", "", " ("+job.Stage+")") + "</small>"
+							}
 							if numpanels > 0 {
 								s += "<small>&nbsp;&nbsp;&horbar;&nbsp;&nbsp;<b>" + itoa(numpanelareas) + " </b> data-rect" + sIf(numpanelareas == 1, "", "s") + " in " + itoa(numpanels) + " panel/s"
 								if numpanelareas > 0 {
 									for _, langid := range App.Proj.Langs[1:] {
-										s += "&nbsp;(<b>" + langid + "</b>: " + ftoa(App.Proj.percentTranslated(langid, nil, nil, sv, -1), 1) + "%)"
+										s += "&nbsp;(<b>" + langid + "</b>: " + ftoa(App.Proj.percentTranslated(langid, nil, nil, sv, -1), 1) + "%"
+										if percdrafts := App.Proj.percentDrafted(langid, nil, nil, sv, -1); percdrafts > 0 {
+											s += " + " + ftoa(percdrafts, 1) + "% drafts"
+										}
+										s += ")"
 									}
 								}
 								s += "</small>"
@@ -167,6 +198,9 @@ func guiStartView() (s string) {
 								s += "<small>&nbsp;&horbar;&nbsp;&nbsp;<b>" + itoa(sv.Data.PanelsTree.Rect.Max.X) + "&times;" + itoa(sv.Data.PanelsTree.Rect.Max.Y) + "</b>px (" + ftoa(sv.Data.PxCm, 1) + "px/cm)&nbsp;&horbar;&nbsp;&nbsp;" + itoa(int(sv.Data.ColDarkestLightest[0])) + "-" + itoa(int(sv.Data.ColDarkestLightest[1])) + "</small>"
 							}
 							s += "<small>&nbsp;&nbsp;&horbar;&nbsp;&nbsp;from <b>" + time.Unix(0, sv.DateTimeUnixNano).Format("02 Jan 2006") + "</b></small>"
+							if sv.Data != nil && sv.Data.Scan != nil {
+								s += "<small>&nbsp;&nbsp;&horbar;&nbsp;&nbsp;scanned via <b title='" + hEsc(toJsonStr(sv.Data.Scan.Opts)) + "'>" + hEsc(sIf(sv.Data.Scan.Profile == "", sv.Data.Scan.Dev, sv.Data.Scan.Profile)) + "</b></small>"
+							}
 							s += "&nbsp;&nbsp;&horbar;&nbsp;&nbsp;<a href='" + svhref + "&colr=1'>Colorize</a> <small>(" + sIf(sv.Data != nil && sv.Data.hasBgCol != "", "started", "monochrome") + ")</small>"
 							s += "</h4>" + guiHtmlGrayDistrs(sv.grayDistrs()) + "</td></tr>"
 						}
@@ -183,15 +217,20 @@ func guiStartView() (s string) {
 
 func guiSheetScan(chapter *Chapter, fv func(string) string) (s string) {
 	series := chapter.parentSeries
-	if fv("scannow") != "" && scanJob == nil {
-		sheetname, sheetvername, sj := trim(fv("sheetname")), time.Now().Format("20060102"), ScanJob{
+	if fv("scannow") != "" || fv("scanpreview") != "" {
+		sj := ScanJob{
 			Id:     strconv.FormatInt(time.Now().UnixNano(), 36),
 			Series: series, Chapter: chapter, Opts: map[string]string{},
+			Profile:   sIf(fv("scanprofile") == "-", "", fv("scanprofile")),
+			SheetName: trim(fv("sheetname")), SheetVerName: time.Now().Format("20060102"),
+			Batch: fv("scanbatch") != "", BatchCount: atoi(trim(fv("scanbatchcount")), 0, 9999),
 		}
 		if svn := trim(fv("sheetvername")); svn != "" {
-			sheetvername = svn
+			sj.SheetVerName = svn
+		}
+		if sj.Batch && strings.IndexByte(sj.SheetName, '#') < 0 { // else all sheets of the batch would get the same name
+			sj.SheetName += "##"
 		}
-		sj.PnmFileName, sj.PngFileName = "/dev/shm/csg"+sj.Id+".pnm", "scans/"+series.Name+"/"+chapter.Name+"/"+sheetname+"."+sheetvername+".png"
 		for _, sd := range scanDevices {
 			if sd.Ident == fv("scandev") {
 				sj.Dev = sd
@@ -207,44 +246,65 @@ func guiSheetScan(chapter *Chapter, fv func(string) string) (s string) {
 					sj.Opts[opt.Name] = formval
 				}
 			}
-			scanJob, scanJobNotice = &sj, ""
-			go scanJobDo()
+			if fv("scanpreview") != "" {
+				sj.toPreview()
+			} else if crop := fv("scancrop"); crop != "" {
+				sj.applyCrop(crop)
+			}
+			scanJobEnqueue(&sj)
 		}
+	} else if fv("main_focus_id") == "scandismiss" {
+		scanQueueDismiss(chapter)
 	}
 	if len(scanDevices) == 0 {
 		return "<div>(Scanner device detection still ongoing)</div>"
-	} else if scanJob != nil {
-		s = "<div>Scan job in <a href='/?series=" + url.QueryEscape(scanJob.Series.Name) + "&chapter=" + url.QueryEscape(scanJob.Chapter.Name) + "&t=" + itoa(int(time.Now().UnixNano())) + "'>progress</a> on device <b>" + scanJob.Dev.String() + "</b>:<br/>"
-		if scanJob.Series == series && scanJob.Chapter == chapter {
-			return s + "first into <code>" + scanJob.PnmFileName + "</code>, then <code>" + hEsc(scanJob.PngFileName) + "</code></div>"
-		}
-		return s + "for other chapter <code>" + scanJob.Series.Name + "/" + scanJob.Chapter.Name + "</code>)</div>"
 	}
+	s += guiSheetScanQueue(chapter)
+	s += guiSheetScanPreview(chapter, fv)
 
+	profname := fv("scanprofile")
+	if profname == "" {
+		profname = chapter.ScanProfile
+	}
+	profile := App.Proj.Scan.Profiles[profname]
+	if profile == nil {
+		profname = ""
+	}
 	s += "<h3>New Sheet Version Scan</h3>"
-	s += guiHtmlInput("text", "sheetname", "", A{"placeholder": "Unlock! Unlock! Unlock!"}) +
+	if len(App.Proj.Scan.Profiles) > 0 {
+		s += "<div>Profile: <select name='scanprofile' id='scanprofile' onchange='doPostBack(\"scanprofile\")'><option value='-'>(none)</option>"
+		for _, name := range sortedMapKeys(App.Proj.Scan.Profiles) {
+			s += "<option value='" + hEsc(name) + "'" + sIf(name == profname, " selected='selected'", "") + ">" + hEsc(name) + sIf(name == chapter.ScanProfile, " (chapter default)", "") + "</option>"
+		}
+		s += "</select></div>"
+	}
+	s += guiHtmlInput("text", "sheetname", "", A{"placeholder": "Unlock! Unlock! Unlock!", "title": "a run of # (as in p##) stands for the next free sheet number in this chapter"}) +
 		"." + guiHtmlInput("text", "sheetvername", time.Now().Format("20060102"), nil) + ".png"
+	batchattrs, batchcount := A{}, ""
+	if profile != nil && profile.Batch {
+		batchattrs["checked"] = "checked"
+	}
+	if profile != nil && profile.BatchCount > 0 {
+		batchcount = itoa(profile.BatchCount)
+	}
+	s += "<div>" + guiHtmlInput("checkbox", "scanbatch", "yes", batchattrs) + "&nbsp;<label for='scanbatch'>Batch via document feeder, numbering sheets via the # run (else appended), stopping after</label>&nbsp;" +
+		guiHtmlInput("number", "scanbatchcount", batchcount, A{"min": "0", "placeholder": "(all)"}) + "&nbsp;sheets</div>"
 	s += "<h3>Scanner to use, remember to <u><i>unlock</i></u>:</h3>"
 
-	s += "<div><select name='scandev' id='scandev' onchange='toggleScanOptsPane(this.options[this.selectedIndex].value)'>"
+	devidx := len(scanDevices) - 1
 	for i, sd := range scanDevices {
-		htmlsel := " selected='selected'"
-		if i != len(scanDevices)-1 {
-			htmlsel = ""
+		if profile != nil && sd.Ident == profile.Dev {
+			devidx = i
 		}
-		s += "<option value='" + sd.Ident + "'" + htmlsel + ">" + hEsc(sd.String()) + "</option>"
+	}
+	s += "<div><select name='scandev' id='scandev' onchange='toggleScanOptsPane(this.options[this.selectedIndex].value)'>"
+	for i, sd := range scanDevices {
+		s += "<option value='" + sd.Ident + "'" + sIf(i == devidx, " selected='selected'", "") + ">" + hEsc(sd.String()) + "</option>"
 	}
 	s += "</select></div><div class='scandevoptsbox'>"
 	for i, sd := range scanDevices {
-		cssdisplay := "block"
-		if i != len(scanDevices)-1 {
-			cssdisplay = "none"
-		}
-		s += "<div class='scandevopts' id='scandevopts_" + sd.Ident + "' style='display: " + cssdisplay + "'>"
-		defvals, dontshow := saneDevDefaults[sd.Ident], append(saneDevDontShow[sd.Ident], saneDevDontShow[""]...)
-		if defvals == nil {
-			defvals = map[string]string{}
-		}
+		s += "<div class='scandevopts' id='scandevopts_" + sd.Ident + "' style='display: " + sIf(i == devidx, "block", "none") + "'>"
+		defvals, dontshow := scanDevOptDefaults(sd.Ident, profile), scanDevOptsDontShow(sd.Ident)
 		var cat string
 		for _, opt := range sd.Options {
 			var hide bool
@@ -272,9 +332,6 @@ func guiSheetScan(chapter *Chapter, fv func(string) string) (s string) {
 			htmlid := sd.Ident + "_opt_" + opt.Name
 			s += "<div class='scandevopt'><div class='scandevoptheader'>"
 			defval := defvals[opt.Name]
-			if defval == "" {
-				defval = saneDevDefaults[""][opt.Name]
-			}
 			httitle := hEsc(strings.Replace(strings.Replace(strings.Join(opt.Description, "\n"), "\"", "`", -1), "'", "`", -1))
 			attrs := A{"title": httitle}
 			if opt.Inactive {
@@ -308,13 +365,114 @@ func guiSheetScan(chapter *Chapter, fv func(string) string) (s string) {
 		}
 		s += "</div>"
 	}
-	s += "<input type='hidden' name='scannow' id='scannow' value=''/><button type='button' id='scanbtn' onclick='kickOffScanJob()'>Begin Scan Now</button>"
+	s += "<input type='hidden' name='scannow' id='scannow' value=''/><button type='button' id='scanbtn' onclick='kickOffScanJob()'>Queue Scan</button>"
+	s += "&nbsp;<input type='hidden' name='scanpreview' id='scanpreview' value=''/><button type='button' id='scanpreviewbtn' onclick='kickOffScanPreview()'>Preview Scan (" + itoa(iIf(App.Proj.Scan.PreviewDpi > 0, App.Proj.Scan.PreviewDpi, 75)) + "dpi)</button>"
 	s += "</div>"
 	return
 }
 
+// the most recent finished preview scan of `chapter`, on which dragging a rectangle sets the
+// `scancrop` (in mm) that `ScanJob.applyCrop` turns into the geometry options of the next scan
+func guiSheetScanPreview(chapter *Chapter, fv func(string) string) (s string) {
+	crop := fv("scancrop")
+	if fv("main_focus_id") == "scancropclear" {
+		crop = ""
+	}
+	s = guiHtmlInput("hidden", "scancrop", crop, nil)
+	var preview *ScanJob
+	for _, sj := range scanQueueJobs(chapter) {
+		if sj.Preview && sj.State == scanJobDone && len(sj.Sheets) > 0 {
+			preview = &sj
+		}
+	}
+	if preview == nil {
+		return s + sIf(crop == "", "", "<div>Crop: <b>"+hEsc(crop)+"</b>mm "+guiHtmlButton("scancropclear", "Clear", A{"onclick": "doPostBack('scancropclear')"})+"</div>")
+	}
+	dpi := atoi(strings.TrimSuffix(preview.Opts["resolution"], "dpi"), 1, 9600)
+	s += "<h3>Preview (" + hEsc(preview.Dev.String()) + ", " + itoa(dpi) + "dpi), drag to crop the next scan:</h3>"
+	s += "<div class='scanpreview' id='scanpreviewbox'>" + guiHtmlImg("/"+preview.Sheets[0].PngFileName, A{"id": "scanpreviewimg", "draggable": "false",
+		"onmousedown": "scanPreviewCropStart(event, " + itoa(dpi) + ")", "onload": "scanPreviewCropShow(" + itoa(dpi) + ")"}) +
+		"<div id='scanpreviewcrop'></div></div>"
+	s += "<div>Crop: <b id='scancroptext'>" + sIf(crop == "", "(none, whole bed)", hEsc(crop)) + "</b>mm (left, top, width, height) " +
+		guiHtmlButton("scancropclear", "Clear", A{"onclick": "doPostBack('scancropclear')"}) + "</div>"
+	return
+}
+
+// the status of `chapter`'s scan jobs, each with its sheets & errors (see `scanQueueJobs`)
+func guiSheetScanQueue(chapter *Chapter) (s string) {
+	jobs := scanQueueJobs(chapter)
+	if len(jobs) == 0 {
+		return
+	}
+	var numfinished int
+	s = "<h3>Scan Queue</h3><ul class='scanqueue'>"
+	for _, sj := range jobs {
+		if sj.State == scanJobDone || sj.State == scanJobFailed {
+			numfinished++
+		}
+		s += "<li class='" + sj.State + "'><b>" + sj.State + "</b>: <code>" + sIf(sj.Preview, "(preview)", hEsc(sj.SheetName)+"."+hEsc(sj.SheetVerName)) + "</code>" +
+			sIf(sj.Batch, " (batch"+sIf(sj.BatchCount > 0, " of "+itoa(sj.BatchCount), "")+")", "") + " on <i>" + hEsc(sj.Dev.String()) + "</i>"
+		if sj.Err != "" {
+			s += "<div class='err'>" + hEsc(sj.Err) + "</div>"
+		}
+		if len(sj.Sheets) > 0 {
+			s += "<ul>"
+			for _, sheet := range sj.Sheets {
+				s += "<li><code>" + hEsc(sheet.PngFileName) + "</code> " + sIf(sheet.Done, "&check;", sIf(sheet.Err == "", "&hellip;", "<span class='err'>"+hEsc(sheet.Err)+"</span>")) + "</li>"
+			}
+			s += "</ul>"
+		}
+		s += "</li>"
+	}
+	s += "</ul>"
+	if numfinished > 0 {
+		s += guiHtmlButton("scandismiss", "Dismiss "+itoa(numfinished)+" finished job(s)", A{"onclick": "doPostBack('scandismiss')"})
+	}
+	return s + " (new sheets get picked up on the next project load)"
+}
+
+// applies the manual panels-tree edit requested via the `ptree*` form fields
+func guiSheetEditPanelsTree(sv *SheetVer, fv func(string) string) {
+	pidx, _ := strconv.Atoi(fv("ptreepidx"))
+	x, _ := strconv.Atoi(fv("ptreex"))
+	y, _ := strconv.Atoi(fv("ptreey"))
+	switch op := fv("ptreeop"); op {
+	case "unpin":
+		sv.editPanelsTree(nil)
+	case "splith", "splitv":
+		sv.editPanelsTree(func(root *ImgPanel) bool { return root.splitPanel(pidx, image.Pt(x, y), op == "splitv") })
+	case "merge":
+		sv.editPanelsTree(func(root *ImgPanel) bool { return root.mergePanelWithNext(pidx) })
+	case "earlier", "later":
+		sv.editPanelsTree(func(root *ImgPanel) bool { return root.movePanel(pidx, iIf(op == "earlier", -1, 1)) })
+	case "resize":
+		var xyxy []int
+		for _, str := range strings.Split(fv("ptreerect"+itoa(pidx)), ",") {
+			if i, err := strconv.Atoi(trim(str)); err == nil {
+				xyxy = append(xyxy, i)
+			}
+		}
+		if len(xyxy) == 4 {
+			sv.editPanelsTree(func(root *ImgPanel) bool {
+				return root.resizePanel(pidx, image.Rect(xyxy[0], xyxy[1], xyxy[2], xyxy[3]))
+			})
+		}
+	}
+}
+
 func guiSheetEdit(sv *SheetVer, fv func(string) string, shouldSaveMeta *bool) (s string) {
+	if fv("main_focus_id") == "bwauto" {
+		if autobwt := sv.bwThresholdAuto(); autobwt != 0 && autobwt != sv.bwThreshold() {
+			sv.prep.Lock()
+			sv.Data.BwThreshold, sv.prep.done = autobwt, false // so that `ensurePrep` re-does the b&w pngs & all that depends on them
+			sv.prep.Unlock()
+			*shouldSaveMeta = true
+		}
+	}
 	_ = sv.ensurePrep(false, false)
+	if fv("main_focus_id") == "ptreeop" {
+		guiSheetEditPanelsTree(sv, fv)
+	}
 	numpanels, maxpanelwidth, bwsrc, chap := 0, 0, fv("srcpx"), sv.parentSheet.parentChapter
 	sv.Data.PanelsTree.each(func(panel *ImgPanel) {
 		numpanels++
@@ -362,7 +520,10 @@ func guiSheetEdit(sv *SheetVer, fv func(string) string, shouldSaveMeta *bool) (s
 		s += " disabled='disabled'"
 	}
 	s += ">"
-	bwthresholds, idx, svbwt := App.Proj.Sheets.Bw.Thresholds.Previewable, -1, sv.bwThreshold()
+	bwthresholds, idx, svbwt, autobwt := App.Proj.Sheets.Bw.Thresholds.Previewable, -1, sv.bwThreshold(), sv.bwThresholdAuto()
+	if autobwt != 0 && autobwt != svbwt && !slices.Contains(bwthresholds, autobwt) {
+		bwthresholds = append([]uint8{autobwt}, bwthresholds...)
+	}
 	for i, bwt := range bwthresholds {
 		if bwt == svbwt {
 			idx = i
@@ -379,9 +540,9 @@ func guiSheetEdit(sv *SheetVer, fv func(string) string, shouldSaveMeta *bool) (s
 		if i != 0 && isbwlores {
 			break
 		}
-		s += "<option value='" + href + "' style='background-image: url(\"" + sIf(isbwlores, "", href) + "\");'>&lt; " + itoa(int(bwt)) + " (" + sIf(i == 0, "current", "preview") + ")" + "</option>"
+		s += "<option value='" + href + "' style='background-image: url(\"" + sIf(isbwlores, "", href) + "\");'>&lt; " + itoa(int(bwt)) + " (" + sIf(i == 0, "current", "preview") + sIf(bwt == autobwt, ", auto", "") + ")" + "</option>"
 	}
-	s += "</select></div>"
+	s += "</select>" + guiSheetEditBwAuto(sv, svbwt, autobwt) + "</div>" + guiSheetEditDeskew(sv, fv)
 	s += "<div id='fullsheet'>" + guiHtmlImg("/"+bwsrc, A{"id": "fsimg", "style": "background-image: none"})
 	if len(sv.parentSheet.parentChapter.storyboard.pages) > 0 {
 		sw, sh := sv.sizeCm()
@@ -414,10 +575,29 @@ func guiSheetEdit(sv *SheetVer, fv func(string) string, shouldSaveMeta *bool) (s
 			}
 			if doimport {
 				*shouldSaveMeta, App.Proj.data.Sv.textRects[sv.ID] = true, pareas
+				App.Proj.txtJournal(sv.ID)
 			}
 			s += "</div>"
 		}
 	}
+	ptreeop := sIf(fv("main_focus_id") == "ptreeop" && fv("ptreeop") != "resize" && fv("ptreeop") != "unpin", fv("ptreeop"), "")
+	s += "<div id='ptreeedit' class='ptreeedit' style='display: " + sIf(ptreeop == "", "none", "block") + "'>"
+	ptidx, sw, sh := 0, float64(sv.Data.PanelsTree.Rect.Max.X), float64(sv.Data.PanelsTree.Rect.Max.Y)
+	sv.Data.PanelsTree.each(func(panel *ImgPanel) {
+		r := panel.Rect
+		s += "<div class='ptreepanel' style='left: " + ftoa(100.0*float64(r.Min.X)/sw, 2) + "%; top: " + ftoa(100.0*float64(r.Min.Y)/sh, 2) + "%; width: " + ftoa(100.0*float64(r.Dx())/sw, 2) + "%; height: " + ftoa(100.0*float64(r.Dy())/sh, 2) + "%;'"
+		s += " onclick='onPanelsTreeEditClick(event, this, " + itoa(ptidx) + ", " + itoa(r.Min.X) + ", " + itoa(r.Min.Y) + ", " + itoa(r.Dx()) + ", " + itoa(r.Dy()) + ")'><b>" + itoa(ptidx+1) + "</b></div>"
+		ptidx++
+	})
+	s += "</div>"
+	s += "</div><div>Edit panels: <select name='ptreeop' id='ptreeop' onchange='$.ptreeedit.style.display = (this.value ? \"block\" : \"none\");'>"
+	for _, op := range [][2]string{{"", "(off)"}, {"splith", "split horizontally at click"}, {"splitv", "split vertically at click"}, {"merge", "merge clicked panel with next"}, {"earlier", "move clicked panel earlier"}, {"later", "move clicked panel later"}} {
+		s += "<option value='" + op[0] + "'" + sIf(op[0] == ptreeop, " selected='selected'", "") + ">" + op[1] + "</option>"
+	}
+	s += "</select>" + guiHtmlInput("hidden", "ptreepidx", "", nil) + guiHtmlInput("hidden", "ptreex", "", nil) + guiHtmlInput("hidden", "ptreey", "", nil)
+	if sv.Data.PanelsTreePinned {
+		s += "&nbsp;&nbsp;(manually edited, so not re-detected)&nbsp;" + guiHtmlButton("ptreeunpin", "Discard edits & re-detect", A{"onclick": "if(confirm(\"Discard all manual panel edits of this sheet and re-detect its panels?\")){$.ptreeop.innerHTML+=\"<option value='unpin'></option>\";$.ptreeop.value=\"unpin\";doPostBack(\"ptreeop\");}"})
+	}
 	s += "</div><div>Preview other B&amp;W thresholds: <input type='text' id='previewbwt' onchange='addBwtPreviewLinks(\"" + sv.FileName + "\");'/><div id='previewbwtlinks'></div></div><div>"
 	if len(sv.parentSheet.parentChapter.storyboard.pages) > 0 {
 		s += "<select name='txtimpsel' id='txtimpsel' onchange='txtPrev(this.value);'><option value=''>(Preview story-board text import...)</option>"
@@ -445,7 +625,11 @@ func guiSheetEdit(sv *SheetVer, fv func(string) string, shouldSaveMeta *bool) (s
 			}
 			s += "</ul>"
 		} else {
-			s += "<ul><li><div><b><a href='#pa" + sv.ID + itoa(pidx) + "'>Panel #" + itoa(pidx+1) + "</a></b>: " + panel.Rect.String() + "</div></li></ul>"
+			r := panel.Rect
+			s += "<ul><li><div><b><a href='#pa" + sv.ID + itoa(pidx) + "'>Panel #" + itoa(pidx+1) + "</a></b>: " + r.String()
+			s += "&nbsp;&horbar; resize to " + guiHtmlInput("text", "ptreerect"+itoa(pidx), itoa(r.Min.X)+","+itoa(r.Min.Y)+","+itoa(r.Max.X)+","+itoa(r.Max.Y), A{"class": "ptreerect"})
+			s += guiHtmlButton("ptreeresize"+itoa(pidx), "Apply", A{"onclick": "$.ptreeop.innerHTML+=\"<option value='resize'></option>\";$.ptreeop.value=\"resize\";$.ptreepidx.value=\"" + itoa(pidx) + "\";doPostBack(\"ptreeop\");"})
+			s += "</div></li></ul>"
 			pidx++
 		}
 		return
@@ -473,11 +657,31 @@ func guiSheetEdit(sv *SheetVer, fv func(string) string, shouldSaveMeta *bool) (s
 			}
 		}
 	}
-	s += "</div><h4>Panel editors:</h4><div><ul><li>" + guiHtmlListFrom("importpaneltexts", "(Import panel text areas from another sheet where panel indices match)", true, importlist)
+	s += "</div>" + guiSheetEditTextCarry(sv, fv, shouldSaveMeta)
+	s += "<h4>Panel editors:</h4><div><ul><li>" + guiHtmlListFrom("importpaneltexts", "(Import panel text areas from another sheet where panel indices match)", true, importlist)
 	var importfrom string
 	if fv("main_focus_id") == "importpaneltexts" {
 		*shouldSaveMeta, importfrom = true, fv("importpaneltexts")
 	}
+	if len(App.Proj.translators()) > 0 {
+		s += "<li>Machine-translate missing texts (as drafts to be reviewed) into:"
+		for _, lang := range App.Proj.Langs[1:] {
+			s += " " + guiHtmlButton("mt_"+lang, lang, A{"onclick": "doPostBack('mt_" + lang + "')"})
+			if fv("main_focus_id") == "mt_"+lang {
+				if !translateBusy.TryLock() {
+					s += " (still busy translating, try again in a bit)"
+				} else {
+					s += " (translating in the background, drafts show on reload)"
+					go func(lang string) { // not holding up the GUI on the translators' network round-trips
+						defer translateBusy.Unlock()
+						defer App.Report.catch("translate", sv, nil)
+						App.Proj.translateMissing(lang, sv)
+					}(lang)
+				}
+			}
+		}
+		s += "</li>"
+	}
 	s += "<li>Default to "
 	numtextrects := fv("numtextrects")
 	if ui, err := strconv.ParseUint(numtextrects, 10, 64); err != nil {
@@ -497,6 +701,7 @@ func guiSheetEdit(sv *SheetVer, fv func(string) string, shouldSaveMeta *bool) (s
 	if rfv := fv("main_focus_id"); rfv != "" && rfv[0] == 'p' && strings.HasSuffix(rfv, "save") {
 		*shouldSaveMeta, savebtnpressed, App.Proj.data.Sv.textRects[sv.ID] = true, true, nil
 	}
+	suggs := sv.textAreaSuggestions()
 	pidx = 0
 	sv.Data.PanelsTree.each(func(panel *ImgPanel) {
 		rect, pid := panel.Rect, "p"+itoa(pidx)
@@ -513,6 +718,12 @@ func guiSheetEdit(sv *SheetVer, fv func(string) string, shouldSaveMeta *bool) (s
 					tid := pid + "t" + itoa(i) + lang
 					if tval := fv(tid); trim(tval) != "" {
 						area.Data[lang] = strings.TrimRight(tval, "\n \t\r\v\b")
+						if draft := fv(tid + "_draft"); draft != "" && fv(tid+"_ok") == "" && strings.TrimRight(draft, "\n \t\r\v\b") == area.Data[lang] {
+							if area.Drafts == nil {
+								area.Drafts = map[string]bool{}
+							}
+							area.Drafts[lang] = true // unchanged & not yet marked as reviewed
+						}
 					}
 				}
 
@@ -582,6 +793,11 @@ func guiSheetEdit(sv *SheetVer, fv func(string) string, shouldSaveMeta *bool) (s
 		style += `background-size: ` + itoa(sv.Data.PanelsTree.Rect.Dx()) + `px ` + itoa(sv.Data.PanelsTree.Rect.Dy()) + `px;`
 		style += `background-position: -` + itoa(rect.Min.X) + `px -` + itoa(rect.Min.Y) + `px;`
 		s += "<div class='panelpic' style='" + style + "'></div><span id='" + pid + "rects'></span>"
+		if pidx < len(suggs) {
+			for _, sugg := range suggs[pidx] {
+				s += "<div class='textareasugg' title='Suggested text area: click to accept' onclick='event.stopPropagation(); acceptTextAreaSugg(" + itoa(pidx) + ", " + itoa(sugg.Min.X) + ", " + itoa(sugg.Min.Y) + ", " + itoa(sugg.Dx()) + ", " + itoa(sugg.Dy()) + ")' style='left: " + itoa(sugg.Min.X-rect.Min.X) + "px; top: " + itoa(sugg.Min.Y-rect.Min.Y) + "px; width: " + itoa(sugg.Dx()) + "px; height: " + itoa(sugg.Dy()) + "px;'></div>"
+			}
+		}
 		s += "</div></div></td><td>"
 
 		s += "<div class='panelcfg' id='" + pid + "cfg' style='text-align: center;display:" + cfgdisplay + ";'>"
@@ -609,7 +825,11 @@ func guiSheetEdit(sv *SheetVer, fv func(string) string, shouldSaveMeta *bool) (s
 					"placeholder": lang,
 					"onfocus":     jsrefr, "onblur": jsrefr, "onchange": jsrefr, "onkeydown": jsrefr, "onkeyup": jsrefr, "onkeypress": jsrefr,
 					"style": "background-image: url(\"/" + path.Join("site", strings.Replace(App.Proj.Site.Gen.ImgSrcLang, "%LANG%", lang, -1)) + "\");" + css,
-					"class": "panelcfgtext col" + itoa(i%8)}) + "</div>"
+					"class": "panelcfgtext col" + itoa(i%8) + sIf(area.Drafts[lang], " draft", "")}) + "</div>"
+				if area.Drafts[lang] {
+					tid := pid + "t" + itoa(i) + lang
+					s += "<div class='draft'>" + guiHtmlInput("hidden", tid+"_draft", area.Data[lang], nil) + guiHtmlInput("checkbox", tid+"_ok", "1", nil) + "<label for='" + tid + "_ok'>" + lang + " machine-translated: mark as reviewed (or edit) &amp; save</label></div>"
+				}
 			}
 
 			s += "<div style='text-align: center; white-space: nowrap;'>xy"
@@ -638,6 +858,90 @@ func guiSheetEdit(sv *SheetVer, fv func(string) string, shouldSaveMeta *bool) (s
 
 		pidx++
 	})
+	if savebtnpressed {
+		App.Proj.txtJournal(sv.ID)
+	}
+	return
+}
+
+// the histogram-derived threshold next to the current one, with side-by-side previews
+// of both and a button (handled in `guiSheetEdit`) to pin it as the sheet's own `BwThreshold`
+func guiSheetEditBwAuto(sv *SheetVer, svBwt uint8, autoBwt uint8) (s string) {
+	if autoBwt == 0 {
+		return
+	}
+	s = "&nbsp;&mdash; auto: <b>" + itoa(int(autoBwt)) + "</b>"
+	if autoBwt == svBwt {
+		return s + " (in use)"
+	}
+	s += "&nbsp;" + guiHtmlButton("bwauto", "Use "+itoa(int(autoBwt))+" for this sheet", A{"onclick": "doPostBack('bwauto')"})
+	s += "<div class='bwauto'>"
+	for _, bwt := range []uint8{svBwt, autoBwt} {
+		href := "/" + sv.FileName + "/" + itoa(int(bwt))
+		s += "<a href='" + href + "' target='_blank'><figure><img src='" + href + "/" + itoa(int(App.Proj.Sheets.Bw.SmallWidth)/2) + "'/><figcaption>" + itoa(int(bwt)) + sIf(bwt == svBwt, " (current)", " (auto)") + "</figcaption></figure></a>"
+	}
+	return s + "</div>"
+}
+
+// re-runs the post-scan deskew & crop (see `DeskewOpts`) on this version's scan, writing the
+// result as a new version of today's date, so that this one and its lettering remain untouched
+func guiSheetEditDeskew(sv *SheetVer, fv func(string) string) (s string) {
+	dstfilepath := filepath.Join(filepath.Dir(sv.FileName), sv.parentSheet.name+"."+time.Now().Format("20060102")+".png")
+	inplace := (dstfilepath == sv.FileName) // scanned (or deskewed) today already: then replaced, keeping its original as `.orig`
+	s = "<div>" + guiHtmlButton("deskew", sIf(inplace, "Deskew & crop in place: ", "Deskew & crop into new version ")+filepath.Base(dstfilepath), A{"onclick": "doPostBack('deskew')"})
+	if fv("main_focus_id") == "deskew" {
+		var srcdata []byte
+		if inplace {
+			srcdata = fileRead(sv.FileName)
+		}
+		if _, numareas := sv.panelCount(); inplace && numareas > 0 {
+			s += "&nbsp;This version already has text areas, which would no longer fit: rescan instead, or remove them first."
+		} else if fileStat(dstfilepath) != nil && !inplace {
+			s += "&nbsp;<b>" + hEsc(dstfilepath) + "</b> already exists: deskew that version instead, to have it replaced."
+		} else if deg, crop, ok := imgDeskewPngFile(sv.FileName, dstfilepath, sv.Data.PxCm, &App.Proj.Sheets.Deskew); !ok {
+			s += "&nbsp;No outer panel borders found (or rotated beyond " + ftoa(App.Proj.Sheets.Deskew.maxDeg(), 1) + "&deg;), nothing written."
+		} else {
+			if origfilepath := sv.FileName + ".orig"; inplace && fileStat(origfilepath) == nil { // but never over the very first original
+				fileWrite(origfilepath, srcdata)
+			}
+			s += "&nbsp;Rotated by <b>" + ftoa(deg, 2) + "&deg;</b> and cropped to <b>" + itoa(crop.Dx()) + "&times;" + itoa(crop.Dy()) + "</b>px into <code>" + hEsc(dstfilepath) + "</code>" + sIf(inplace, " (the original kept as <code>.orig</code>)", "") + ", to be picked up on the next project load."
+		}
+	}
+	return s + "</div>"
+}
+
+func guiSheetEditTextCarry(sv *SheetVer, fv func(string) string, shouldSaveMeta *bool) (s string) {
+	if fv("main_focus_id") == "textcarry" {
+		if sv.textCarryApply(fv("textcarryflagged") != "") > 0 {
+			*shouldSaveMeta = true
+		}
+	}
+	carry := sv.textCarry()
+	if carry == nil {
+		return
+	}
+	var numareas, numflagged int
+	for pidx := range carry.Areas {
+		for _, flag := range carry.Flags[pidx] {
+			if numareas++; flag != "" {
+				numflagged++
+			}
+		}
+	}
+	s += "<h4>Lettering carry-over from previous version (" + time.Unix(0, carry.From.DateTimeUnixNano).Format("2006-01-02") + "):</h4><div class='textcarry'>"
+	s += "<div>Registration: " + ftoa(carry.Score*100, 1) + "% ink match" + sIf(carry.Score < 0.5, " &mdash; <b>poor, check carefully</b>", "") + ", scale " + ftoa(carry.Xform.Scale, 4) + ", rotation " + ftoa(carry.Xform.Rot*180/math.Pi, 2) + "&deg;, offset " + itoa(int(carry.Xform.Dx)) + "," + itoa(int(carry.Xform.Dy)) + "px</div>"
+	s += "<table><tr><th>Panel</th><th>Text</th><th>Rect</th><th>Check</th></tr>"
+	for pidx, areas := range carry.Areas {
+		for i, area := range areas {
+			flag := carry.Flags[pidx][i]
+			s += "<tr" + sIf(flag == "", "", " class='flagged'") + "><td>#" + itoa(pidx+1) + "</td><td>" + hEsc(area.Data[App.Proj.Langs[0]]) + "</td><td>" + area.Rect.String() + "</td><td>" + hEsc(flag) + "</td></tr>"
+		}
+	}
+	s += "</table>"
+	if numflagged > 0 {
+		s += guiHtmlInput("checkbox", "textcarryflagged", "1", nil) + "<label for='textcarryflagged'>also take the " + itoa(numflagged) + " flagged area/s</label>&nbsp;&nbsp;"
+	}
+	s += guiHtmlButton("textcarry", "Accept "+itoa(numareas-numflagged)+"/"+itoa(numareas)+" carried-over text area/s", A{"onclick": "doPostBack('textcarry')"}) + "</div>"
 	return
 }
 
@@ -661,13 +965,25 @@ func guiLaunchColorizer(sv *SheetVer) {
 	type PageLayout struct {
 		Page   image.Rectangle
 		Panels []image.Rectangle
+		Polys  [][]image.Point `json:",omitempty"`
+		Zs     []int           `json:",omitempty"`
 	}
 	pagelayout := PageLayout{
 		Page: sv.Data.PanelsTree.Rect,
 	}
+	var haspolys, haszs bool
 	sv.Data.PanelsTree.each(func(p *ImgPanel) {
+		haspolys, haszs = haspolys || len(p.Poly) > 0, haszs || p.Z != 0
 		pagelayout.Panels = append(pagelayout.Panels, p.Rect)
+		pagelayout.Polys = append(pagelayout.Polys, p.Poly)
+		pagelayout.Zs = append(pagelayout.Zs, p.Z)
 	})
+	if !haspolys {
+		pagelayout.Polys = nil
+	}
+	if !haszs {
+		pagelayout.Zs = nil
+	}
 	cmd.Stdin = strings.NewReader(toJsonStr(pagelayout))
 	output, err := cmd.CombinedOutput()
 	os.Stdout.Write(output)
@@ -13,10 +13,10 @@ import (
 
 var numBusyRequests int32
 
-func httpListenAndServe() {
+func httpListenAndServe(addr string, handler http.HandlerFunc) {
 	if err := (&http.Server{
-		Addr:    ":4321",
-		Handler: http.HandlerFunc(httpHandle),
+		Addr:    addr,
+		Handler: handler,
 	}).ListenAndServe(); err != nil {
 		panic(err)
 	}
@@ -48,13 +48,25 @@ func httpHandle(httpResp http.ResponseWriter, httpReq *http.Request) {
 
 func httpServeDynPng(httpResp http.ResponseWriter, httpReq *http.Request) {
 	var pngdata []byte
+	idx := strings.Index(httpReq.URL.Path, ".png/")
+	urlpath, urlargstr := httpReq.URL.Path[:idx+len(".png")], httpReq.URL.Path[idx+len(".png/"):]
+	filename := filepath.Join("." /*looks redundant but isnt!*/, urlpath)
+	var sv *SheetVer // if a sheet scan, its `BwOpts` apply to the preview too
+	App.Proj.dataMu.Lock()
+	for _, svdata := range App.Proj.data.Sv.ById {
+		if svdata.parentSheetVer != nil && filepath.Clean(svdata.parentSheetVer.FileName) == filename {
+			sv = svdata.parentSheetVer
+			break
+		}
+	}
+	App.Proj.dataMu.Unlock()
 	tmpfilename := "/dev/shm/" + strings.Replace(httpReq.URL.Path, "/", "_", -1)
+	if sv != nil {
+		tmpfilename += sv.bwOpts().cacheKey()
+	}
 	pngdata, _ = os.ReadFile(tmpfilename)
 
 	if len(pngdata) == 0 {
-		idx := strings.Index(httpReq.URL.Path, ".png/")
-		urlpath, urlargstr := httpReq.URL.Path[:idx+len(".png")], httpReq.URL.Path[idx+len(".png/"):]
-		filename := filepath.Join("." /*looks redundant but isnt!*/, urlpath)
 		file, err := os.Open(filename)
 		if err != nil {
 			panic(err)
@@ -73,7 +85,11 @@ func httpServeDynPng(httpResp http.ResponseWriter, httpReq *http.Request) {
 		}
 
 		w := 0
-		pngdata = imgToMonochromePng(file, file.Close, t)
+		if sv != nil {
+			pngdata = sv.bwPng(file, file.Close, t)
+		} else {
+			pngdata = imgToMonochromePng(file, file.Close, t)
+		}
 		if len(args) > 1 {
 			if qw := args[1]; qw != "" {
 				if ui, err := strconv.ParseUint(qw, 0, 64); err != nil {
@@ -2,16 +2,15 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
 	"image"
 	"image/color"
 	"image/png"
 	"io"
 	"os"
-	"strconv"
 	"strings"
-	"time"
 
-	pnm "github.com/go-forks/gopnm"
+	_ "github.com/go-forks/gopnm"
 	"golang.org/x/image/draw"
 )
 
@@ -26,16 +25,31 @@ func pngEncode(img image.Image) []byte {
 	return buf.Bytes()
 }
 
-func imgPnmToPng(srcImgData io.ReadCloser, dstImgFile io.WriteCloser, ensureWide bool, snipTop int, snipRight int, snipBottom int, snipLeft int) {
-	srcimg, err := pnm.Decode(srcImgData)
+// converts a raw scanner page (PNM from `scanimage`, PNG or JPEG from eSCL) to PNG: gray stays
+// gray, anything else becomes RGBA. If `ensureWide`, portrait pages get rotated to landscape.
+func imgScanToPng(srcImgData io.ReadCloser, dstImgFile io.WriteCloser, ensureWide bool, snipTop int, snipRight int, snipBottom int, snipLeft int) {
+	decoded, _, err := image.Decode(srcImgData)
 	if err != nil {
 		panic(err)
 	}
 	_ = srcImgData.Close()
 
-	if dstbounds := srcimg.(*image.Gray).Bounds(); ensureWide && dstbounds.Max.X < dstbounds.Max.Y {
+	var srcimg draw.Image
+	switch decoded := decoded.(type) {
+	case *image.Gray:
+		srcimg = decoded
+	default:
+		rgba := image.NewRGBA(image.Rect(0, 0, decoded.Bounds().Dx(), decoded.Bounds().Dy()))
+		draw.Draw(rgba, rgba.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+		srcimg = rgba
+	}
+	if dstbounds := srcimg.Bounds(); ensureWide && dstbounds.Max.X < dstbounds.Max.Y {
 		dstbounds.Max.X, dstbounds.Max.Y = dstbounds.Max.Y, dstbounds.Max.X
-		dstimg, srcbounds := image.NewGray(dstbounds), srcimg.Bounds()
+		var dstimg draw.Image = image.NewGray(dstbounds)
+		if _, isgray := srcimg.(*image.Gray); !isgray {
+			dstimg = image.NewRGBA(dstbounds)
+		}
+		srcbounds := srcimg.Bounds()
 		for dstx := 0; dstx < dstbounds.Max.X; dstx++ {
 			for dsty := 0; dsty < dstbounds.Max.Y; dsty++ {
 				srcx, srcy := dsty, (srcbounds.Max.Y-1)-dstx
@@ -44,10 +58,13 @@ func imgPnmToPng(srcImgData io.ReadCloser, dstImgFile io.WriteCloser, ensureWide
 		}
 		srcimg = dstimg
 	}
+	var dstimg image.Image = srcimg
 	if snipTop > 0 || snipBottom > 0 || snipLeft > 0 || snipRight > 0 {
-		srcimg = srcimg.(*image.Gray).SubImage(image.Rect(snipLeft, snipTop, srcimg.Bounds().Max.X-snipRight, srcimg.Bounds().Max.Y-snipBottom))
+		dstimg = srcimg.(interface {
+			SubImage(image.Rectangle) image.Image
+		}).SubImage(image.Rect(snipLeft, snipTop, srcimg.Bounds().Max.X-snipRight, srcimg.Bounds().Max.Y-snipBottom))
 	}
-	if err := PngEncoder.Encode(dstImgFile, srcimg); err != nil {
+	if err := PngEncoder.Encode(dstImgFile, dstimg); err != nil {
 		panic(err)
 	}
 	_ = dstImgFile.Close()
@@ -160,7 +177,7 @@ func imgFill(img draw.Image, r image.Rectangle, c color.Color) {
 	}
 }
 
-func imgGrayDistrs(srcImgData io.Reader, onDecoded func() error, numClusters int) (grayDistrs []int, colDarkestLightest []uint8) {
+func imgGrayDistrs(srcImgData io.Reader, onDecoded func() error, numClusters int) (grayDistrs []int, colDarkestLightest []uint8, grayHist []int) {
 	imgsrc, _, err := image.Decode(srcImgData)
 	if onDecoded != nil {
 		_ = onDecoded() // allow early file-closing for the caller
@@ -169,21 +186,11 @@ func imgGrayDistrs(srcImgData io.Reader, onDecoded func() error, numClusters int
 		panic(err)
 	}
 
-	grayDistrs, colDarkestLightest = make([]int, numClusters), []uint8{255, 0}
+	grayDistrs, colDarkestLightest, grayHist = make([]int, numClusters), []uint8{255, 0}, make([]int, 256)
 	m := 256.0 / float64(numClusters)
 	for px := 0; px < imgsrc.Bounds().Max.X; px++ {
 		for py := 0; py < imgsrc.Bounds().Max.Y; py++ {
-			var cm uint8 // ensure grayscale
-			switch colsrc := imgsrc.At(px, py).(type) {
-			case color.Gray:
-				cm = colsrc.Y
-			case color.RGBA:
-				cm = uint8((int(colsrc.R) + int(colsrc.G) + int(colsrc.B)) / 3)
-			case color.NRGBA:
-				cm = uint8((int(colsrc.R) + int(colsrc.G) + int(colsrc.B)) / 3)
-			default:
-				panic(colsrc)
-			}
+			cm := imgGrayOf(imgsrc.At(px, py))
 			if cm < colDarkestLightest[0] {
 				colDarkestLightest[0] = cm
 			}
@@ -191,11 +198,70 @@ func imgGrayDistrs(srcImgData io.Reader, onDecoded func() error, numClusters int
 				colDarkestLightest[1] = cm
 			}
 			grayDistrs[int(float64(cm)/m)]++
+			grayHist[cm]++
 		}
 	}
 	return
 }
 
+// proposes a b&w threshold for a 256-bin gray histogram: Otsu's between-class-variance
+// maximum, then moved to the deepest point of the (smoothed) valley near it, as ink
+// and paper peaks of scans are rarely symmetric enough for Otsu alone to hit the gap
+func imgGrayHistThreshold(grayHist []int) uint8 {
+	const valleyradius, smoothradius = 24, 4
+	var numpx, sumall float64
+	for i, n := range grayHist {
+		numpx, sumall = numpx+float64(n), sumall+float64(i*n)
+	}
+	if numpx == 0 {
+		return 0
+	}
+	otsu, bestvar, numdark, sumdark := 0, -1.0, 0.0, 0.0
+	for i := 0; i < 255; i++ {
+		if numdark, sumdark = numdark+float64(grayHist[i]), sumdark+float64(i*grayHist[i]); numdark == 0 || numdark == numpx {
+			continue
+		}
+		meandark, meanlight := sumdark/numdark, (sumall-sumdark)/(numpx-numdark)
+		if v := numdark * (numpx - numdark) * (meandark - meanlight) * (meandark - meanlight); v > bestvar {
+			otsu, bestvar = i+1, v
+		}
+	}
+	smoothed := func(at int) (sum int) {
+		for i := max(0, at-smoothradius); i <= min(255, at+smoothradius); i++ {
+			sum += grayHist[i]
+		}
+		return
+	}
+	ret, minsum := otsu, smoothed(otsu)
+	for i := max(1, otsu-valleyradius); i <= min(254, otsu+valleyradius); i++ {
+		if sum := smoothed(i); sum < minsum || (sum == minsum && max(i-otsu, otsu-i) < max(ret-otsu, otsu-ret)) {
+			ret, minsum = i, sum
+		}
+	}
+	return uint8(max(1, min(254, ret)))
+}
+
+// the 8-bit gray of `col`: channels averaged, for 16-bit scans (`Gray16`, `RGBA64`, `NRGBA64`
+// from TIFFs or PNGs) at full precision and rounded only once at the end
+func imgGrayOf(col color.Color) uint8 {
+	switch col := col.(type) {
+	case color.Gray:
+		return col.Y
+	case color.RGBA:
+		return uint8((int(col.R) + int(col.G) + int(col.B)) / 3)
+	case color.NRGBA:
+		return uint8((int(col.R) + int(col.G) + int(col.B)) / 3)
+	case color.Gray16:
+		return uint8((uint32(col.Y) + 128) / 257)
+	case color.RGBA64:
+		return uint8(((uint32(col.R)+uint32(col.G)+uint32(col.B))/3 + 128) / 257)
+	case color.NRGBA64:
+		return uint8(((uint32(col.R)+uint32(col.G)+uint32(col.B))/3 + 128) / 257)
+	}
+	r, g, b, _ := col.RGBA()
+	return uint8(((r+g+b)/3 + 128) / 257)
+}
+
 func imgToMonochromePng(srcImgData io.Reader, onDecoded func() error, blackIfLessThan uint8) []byte {
 	return pngEncode(imgToMonochrome(srcImgData, onDecoded, blackIfLessThan))
 }
@@ -213,18 +279,7 @@ func imgToMonochrome(srcImgData io.Reader, onDecoded func() error, blackIfLessTh
 	imggray := image.NewGray(image.Rect(0, 0, srcimg.Bounds().Max.X, srcimg.Bounds().Max.Y))
 	for px := 0; px < srcimg.Bounds().Max.X; px++ {
 		for py := 0; py < srcimg.Bounds().Max.Y; py++ {
-			var colbw uint8
-			// ensure grayscale
-			switch colsrc := srcimg.At(px, py).(type) {
-			case color.Gray:
-				colbw = colsrc.Y
-			case color.RGBA:
-				colbw = uint8((int(colsrc.R) + int(colsrc.G) + int(colsrc.B)) / 3)
-			case color.NRGBA:
-				colbw = uint8((int(colsrc.R) + int(colsrc.G) + int(colsrc.B)) / 3)
-			default:
-				panic(colsrc)
-			}
+			colbw := imgGrayOf(srcimg.At(px, py))
 			// threshold
 			if blackIfLessThan > 0 {
 				if colbw < blackIfLessThan {
@@ -272,21 +327,27 @@ func imgBwBorder(imgdst draw.Image, bwColor color.Gray, size int, offset int, tr
 	}
 }
 
+// the vector tracing (see imgTrace) of the b&w sub-image, in its px
 func imgSubRectSvg(srcImg *image.Gray, srcImgRect image.Rectangle, blackBorderSize int) (ret []byte) {
 	if blackBorderSize != 0 {
 		imgDrawRect(srcImg, srcImgRect, blackBorderSize, 0)
 	}
-	var buf bytes.Buffer
-	name := strconv.FormatInt(time.Now().UnixNano(), 36)
-	pnmpath, svgpath := "/dev/shm/"+name+".pbm", "/dev/shm/"+name+".svg"
-	if err := pnm.Encode(&buf, srcImg.SubImage(srcImgRect), pnm.PBM); err != nil {
-		panic(err)
+	w, h := itoa(srcImgRect.Dx()), itoa(srcImgRect.Dy())
+	return []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="` + w + `" height="` + h + `" viewBox="0 0 ` + w + ` ` + h + `">` +
+		`<path fill-rule="evenodd" d="` + imgTraceSvgPathData(imgTrace(srcImg, srcImgRect, &App.Proj.Sheets.Panel.Trace)) + `"/></svg>`)
+}
+
+// the (non-traceable, ie. gray or colour) alternative to imgSubRectSvg: the sub-image as an embedded PNG, same as panel pics
+func imgSubRectSvgEmbed(srcImg image.Image, srcImgRect image.Rectangle, blackBorderSize int) []byte {
+	w, h := srcImgRect.Dx(), srcImgRect.Dy()
+	var pngdata []byte
+	if imggray, _ := srcImg.(*image.Gray); imggray != nil {
+		pngdata = pngEncode(imgSubRect(imggray, srcImgRect, &w, &h, blackBorderSize, true, nil))
+	} else {
+		pngdata = pngEncode(imgSubRectColor(srcImg, srcImgRect, &w, &h, blackBorderSize, nil))
 	}
-	fileWrite(pnmpath, buf.Bytes())
-	osExec(true, nil, "potrace", "-s", pnmpath, "-o", svgpath)
-	ret = fileRead(svgpath)
-	_, _ = os.Remove(pnmpath), os.Remove(svgpath)
-	return
+	return []byte(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="` + itoa(w) + `" height="` + itoa(h) + `" viewBox="0 0 ` + itoa(w) + ` ` + itoa(h) + `">` +
+		`<image x="0" y="0" width="` + itoa(w) + `" height="` + itoa(h) + `" xlink:href="data:image/png;base64,` + base64.StdEncoding.EncodeToString(pngdata) + `"/></svg>`)
 }
 
 func imgSubRectPngFile(srcImgFilePath string, rect image.Rectangle, blackBorderSize int, reWidth int, transparent bool) []byte {
@@ -300,7 +361,10 @@ func imgSubRectPngFile(srcImgFilePath string, rect image.Rectangle, blackBorderS
 		factor := float64(imgsrc.Bounds().Dx()) / float64(reWidth)
 		w, h = int(float64(w)/factor), int(float64(h)/factor)
 	}
-	return pngEncode(imgSubRect(imgsrc.(*image.Gray), rect, &w, &h, blackBorderSize, transparent, &gotsamesizeasorig))
+	if imggray, _ := imgsrc.(*image.Gray); imggray != nil {
+		return pngEncode(imgSubRect(imggray, rect, &w, &h, blackBorderSize, transparent, &gotsamesizeasorig))
+	}
+	return pngEncode(imgSubRectColor(imgsrc, rect, &w, &h, blackBorderSize, &gotsamesizeasorig))
 }
 
 func imgSubRectPng(srcImg *image.Gray, srcImgRect image.Rectangle, width *int, height *int, blackBorderSize int, transparent bool, gotSameSizeAsOrig *bool) []byte {
@@ -351,6 +415,25 @@ func imgSubRect(srcImg *image.Gray, srcImgRect image.Rectangle, width *int, heig
 	return imgdst
 }
 
+// the full-colour counterpart to imgSubRect, always opaque
+func imgSubRectColor(srcImg image.Image, srcImgRect image.Rectangle, width *int, height *int, blackBorderSize int, gotSameSizeAsOrig *bool) image.Image {
+	origwidth, origheight := srcImgRect.Dx(), srcImgRect.Dy()
+	if *width >= origwidth {
+		if gotSameSizeAsOrig != nil {
+			*gotSameSizeAsOrig = true
+		}
+		*width, *height = origwidth, origheight
+	}
+	imgdst := image.NewRGBA(image.Rect(0, 0, *width, *height))
+	if *width == origwidth {
+		draw.Draw(imgdst, imgdst.Bounds(), srcImg, srcImgRect.Min, draw.Src)
+	} else {
+		ImgScaler.Scale(imgdst, imgdst.Bounds(), srcImg, srcImgRect, draw.Src, nil)
+	}
+	imgBwBorder(imgdst, color.Gray{0}, blackBorderSize, 0, false)
+	return imgdst
+}
+
 func imgDrawRect(imgDst *image.Gray, rect image.Rectangle, thickness int, gray uint8) {
 	for x := rect.Min.X; x < rect.Max.X; x++ {
 		for y := rect.Min.Y; y < rect.Max.Y; y++ {
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"image"
+	"math"
+)
+
+// optional refinements of the plain global-threshold b&w conversion, for scans with
+// lamp falloff, paper curl or dust (set per `Chapter` or `Series`, like `BwThreshold`)
+type BwOpts struct {
+	Adaptive    string  `json:",omitempty"` // "sauvola" or "bradley" to threshold each pixel by its neighbourhood
+	AdaptiveCm  float64 `json:",omitempty"` // neighbourhood size, defaults to 1cm
+	AdaptiveK   float64 `json:",omitempty"` // sensitivity, defaults to 0.2 (sauvola) or 0.15 (bradley)
+	DespecklePx int     `json:",omitempty"` // isolated ink specks of at most this many pixels turn white
+}
+
+func (me *BwOpts) adaptiveCm() float64 {
+	if me.AdaptiveCm > 0.01 {
+		return me.AdaptiveCm
+	}
+	return 1
+}
+
+func (me *BwOpts) adaptiveK() float64 {
+	if me.AdaptiveK > 0.001 {
+		return me.AdaptiveK
+	}
+	return fIf(me.Adaptive == "bradley", 0.15, 0.2)
+}
+
+// suffix for file and dir names of everything derived from the b&w sheet, empty for
+// no refinements so that existing `bw.*.png` caches stay valid
+func (me *BwOpts) cacheKey() (s string) {
+	if me == nil {
+		return
+	}
+	if me.Adaptive != "" {
+		s += "." + me.Adaptive + ftoa(me.adaptiveCm(), -1) + "k" + ftoa(me.adaptiveK(), -1)
+	}
+	if me.DespecklePx > 0 {
+		s += ".d" + itoa(me.DespecklePx)
+	}
+	return
+}
+
+// turns the grayscale `img` into b&w in-place: by `blackIfLessThan` globally or, if
+// `Adaptive`, by local thresholds (with `pxCm` for the neighbourhood size), then despeckles
+func (me *BwOpts) apply(img *image.Gray, blackIfLessThan uint8, pxCm float64) {
+	if me.Adaptive == "" {
+		for i, c := range img.Pix {
+			img.Pix[i] = uint8(iIf(c < blackIfLessThan, 0, 255))
+		}
+	} else {
+		imgBwAdaptive(img, int(me.adaptiveCm()*pxCm), me.Adaptive == "sauvola", me.adaptiveK(), blackIfLessThan/2)
+	}
+	if me.DespecklePx > 0 {
+		imgBwDespeckle(img, me.DespecklePx)
+	}
+}
+
+// local-adaptive binarization: Sauvola (mean & deviation) or Bradley (mean only) over a
+// `winPx` neighbourhood. To keep memory flat even for 1200dpi sheets, the neighbourhood
+// stats come from an integral image over blocks of 1/8 the window, and the resulting
+// per-block thresholds are bilinearly interpolated. Pixels darker than `alwaysBlack` stay
+// ink regardless, or large solid-black fills (being their own dark neighbourhood) hollow out.
+func imgBwAdaptive(img *image.Gray, winPx int, sauvola bool, k float64, alwaysBlack uint8) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	bs := max(1, winPx/8)
+	gw, gh, r := (w+bs-1)/bs, (h+bs-1)/bs, max(1, winPx/(2*bs))
+	sum, sumsq, num := make([]float64, (gw+1)*(gh+1)), make([]float64, (gw+1)*(gh+1)), make([]float64, (gw+1)*(gh+1))
+	for gy := 0; gy < gh; gy++ {
+		for gx := 0; gx < gw; gx++ {
+			var bsum, bsumsq, bnum float64
+			for y := gy * bs; y < min(h, (gy+1)*bs); y++ {
+				for x := gx * bs; x < min(w, (gx+1)*bs); x++ {
+					c := float64(img.Pix[y*img.Stride+x])
+					bsum, bsumsq, bnum = bsum+c, bsumsq+c*c, bnum+1
+				}
+			}
+			i, iabove, ileft, iaboveleft := (gy+1)*(gw+1)+gx+1, gy*(gw+1)+gx+1, (gy+1)*(gw+1)+gx, gy*(gw+1)+gx
+			sum[i] = bsum + sum[iabove] + sum[ileft] - sum[iaboveleft]
+			sumsq[i] = bsumsq + sumsq[iabove] + sumsq[ileft] - sumsq[iaboveleft]
+			num[i] = bnum + num[iabove] + num[ileft] - num[iaboveleft]
+		}
+	}
+	thresholds := make([]float64, gw*gh)
+	for gy := 0; gy < gh; gy++ {
+		for gx := 0; gx < gw; gx++ {
+			x0, y0, x1, y1 := max(0, gx-r), max(0, gy-r), min(gw, gx+r+1), min(gh, gy+r+1)
+			at := func(data []float64) float64 {
+				return data[y1*(gw+1)+x1] - data[y0*(gw+1)+x1] - data[y1*(gw+1)+x0] + data[y0*(gw+1)+x0]
+			}
+			n := at(num)
+			mean := at(sum) / n
+			if sauvola {
+				stddev := math.Sqrt(math.Max(0, at(sumsq)/n-mean*mean))
+				thresholds[gy*gw+gx] = mean * (1 + k*(stddev/128-1))
+			} else {
+				thresholds[gy*gw+gx] = mean * (1 - k)
+			}
+		}
+	}
+	// interpolating between block centers
+	thresholdAt := func(x int, y int) float64 {
+		fx, fy := math.Max(0, (float64(x)+0.5)/float64(bs)-0.5), math.Max(0, (float64(y)+0.5)/float64(bs)-0.5)
+		gx0, gy0 := min(gw-1, int(fx)), min(gh-1, int(fy))
+		gx1, gy1 := min(gw-1, gx0+1), min(gh-1, gy0+1)
+		tx, ty := fx-float64(gx0), fy-float64(gy0)
+		top := thresholds[gy0*gw+gx0]*(1-tx) + thresholds[gy0*gw+gx1]*tx
+		bottom := thresholds[gy1*gw+gx0]*(1-tx) + thresholds[gy1*gw+gx1]*tx
+		return top*(1-ty) + bottom*ty
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*img.Stride + x
+			c := img.Pix[i]
+			img.Pix[i] = uint8(iIf(c < alwaysBlack || float64(c) < thresholdAt(x, y), 0, 255))
+		}
+	}
+}
+
+// whitens all 8-connected ink (0) components of at most `maxPx` pixels in the b&w `img`
+func imgBwDespeckle(img *image.Gray, maxPx int) {
+	const visited = 1 // marks ink already flood-filled, reset to 0 at the end
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	var stack, speck []int
+	for start := 0; start < w*h; start++ {
+		if img.Pix[(start/w)*img.Stride+start%w] != 0 {
+			continue
+		}
+		numpx := 0
+		stack, speck = append(stack[:0], start), speck[:0]
+		img.Pix[(start/w)*img.Stride+start%w] = visited
+		for len(stack) > 0 {
+			idx := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if numpx++; numpx <= maxPx {
+				speck = append(speck, idx)
+			}
+			x, y := idx%w, idx/w
+			for ny := max(0, y-1); ny <= min(h-1, y+1); ny++ {
+				for nx := max(0, x-1); nx <= min(w-1, x+1); nx++ {
+					if i := ny*img.Stride + nx; img.Pix[i] == 0 {
+						img.Pix[i], stack = visited, append(stack, ny*w+nx)
+					}
+				}
+			}
+		}
+		if numpx <= maxPx {
+			for _, idx := range speck {
+				img.Pix[(idx/w)*img.Stride+idx%w] = 255
+			}
+		}
+	}
+	for i, c := range img.Pix {
+		if c == visited {
+			img.Pix[i] = 0
+		}
+	}
+}
+
+// a `Chapter`'s grayscale mode for ink washes & screentones: its panel pics (and so its
+// site pages, strips & books) come from an 8-bit gray master instead of the b&w sheet,
+// which still serves panel detection and tracing
+type GrayOpts struct {
+	Levels     int   `json:",omitempty"` // 2..255 for a limited palette, else all 256 gray levels
+	WhitePoint uint8 `json:",omitempty"` // this and lighter becomes paper-white, defaults to just below the histogram's paper peak
+	BlackPoint uint8 `json:",omitempty"` // this and darker becomes solid black, defaults to the darkest gray in the scan
+}
+
+func (me *GrayOpts) levels() int {
+	if me.Levels < 2 || me.Levels > 255 {
+		return 256
+	}
+	return me.Levels
+}
+
+// stretches `img` in-place so that `blackPt` and darker become 0 and `whitePt` and
+// lighter become 255, then posterizes to `levels` (if under 256) evenly spaced grays
+func imgGrayMaster(img *image.Gray, blackPt uint8, whitePt uint8, levels int) {
+	var lut [256]uint8
+	for i := range lut {
+		v := math.Max(0, math.Min(1, (float64(i)-float64(blackPt))/math.Max(1, float64(whitePt)-float64(blackPt))))
+		if levels < 256 {
+			v = math.Round(v*float64(levels-1)) / float64(levels-1)
+		}
+		lut[i] = uint8(math.Round(v * 255))
+	}
+	for i, c := range img.Pix {
+		img.Pix[i] = lut[c]
+	}
+}
+
+// snaps all alpha (for `*image.NRGBA`) or gray (for `*image.Gray`) values to `levels`
+// evenly spaced steps, as downscaling re-introduces in-between tones to limited palettes
+func imgPosterize(img image.Image, levels int) {
+	if levels >= 256 || levels < 2 {
+		return
+	}
+	snap := func(c uint8) uint8 {
+		return uint8(math.Round(math.Round(float64(c)*float64(levels-1)/255) * 255 / float64(levels-1)))
+	}
+	switch img := img.(type) {
+	case *image.Gray:
+		for i, c := range img.Pix {
+			img.Pix[i] = snap(c)
+		}
+	case *image.NRGBA:
+		for i := 3; i < len(img.Pix); i += 4 {
+			img.Pix[i] = snap(img.Pix[i])
+		}
+	}
+}
+
+// the b&w stand-in for a full-colour sheet (see `Chapter.FullColor`), for panel detection & all
+// other b&w-based processing: black where dark (as by imgToMonochrome) or noticeably colourful,
+// so that light but saturated fills don't read as white gutter
+func imgColorMask(srcImg image.Image, blackIfLessThan uint8, minChroma uint8) *image.Gray {
+	bounds := srcImg.Bounds()
+	ret := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := srcImg.At(x, y).RGBA()
+			r, g, b = r>>8, g>>8, b>>8
+			gray, chroma := (r+g+b)/3, max(r, g, b)-min(r, g, b)
+			ret.Pix[(y-bounds.Min.Y)*ret.Stride+(x-bounds.Min.X)] = uint8(iIf(gray < uint32(blackIfLessThan) || chroma >= uint32(minChroma), 0, 255))
+		}
+	}
+	return ret
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"os"
+	"sort"
+)
+
+// straightening & cropping of sheets laid crooked on the scanner glass (cx.json's
+// `Sheets.Deskew`): the outermost panel borders are located, the scan rotated to make
+// them axis-aligned, then cropped to `MarginCm` around them
+type DeskewOpts struct {
+	Auto     bool    `json:",omitempty"` // whether `scanJobDo` applies it to every fresh scan
+	MarginCm float64 `json:",omitempty"` // paper kept around the outer panel borders, defaults to 0.5
+	MaxDeg   float64 `json:",omitempty"` // larger detected rotations are deemed misdetections, defaults to 3
+}
+
+func (me *DeskewOpts) marginCm() float64 {
+	if me.MarginCm > 0.001 {
+		return me.MarginCm
+	}
+	return 0.5
+}
+
+func (me *DeskewOpts) maxDeg() float64 {
+	if me.MaxDeg > 0.001 {
+		return me.MaxDeg
+	}
+	return 3
+}
+
+// deskews & crops the scan at `srcFilePath` into `dstFilePath` (may be the same), returning
+// the rotation applied in degrees and the crop (in rotated-scan px). If no outer border
+// is found, or it seems rotated beyond `MaxDeg`, nothing gets written and `ok` is false.
+func imgDeskewPngFile(srcFilePath string, dstFilePath string, pxCm float64, opts *DeskewOpts) (deg float64, crop image.Rectangle, ok bool) {
+	img := imgDecodeFile(srcFilePath)
+	gray := imgToGray(img)
+	var rad float64
+	if rad, ok = imgDeskewAngle(gray, opts.maxDeg()*math.Pi/180); !ok {
+		return
+	}
+	if deg = rad * 180 / math.Pi; math.Abs(deg) >= 0.02 { // below that, no pixel moves by more than ~half a px even at 1200dpi A4
+		img = imgRotated(img, -rad)
+		gray = imgToGray(img)
+	}
+	var border image.Rectangle
+	if border, ok = imgDeskewBorder(gray); !ok {
+		return
+	}
+	margin := int(opts.marginCm() * pxCm)
+	crop = image.Rect(border.Min.X-margin, border.Min.Y-margin, border.Max.X+margin, border.Max.Y+margin).Intersect(img.Bounds())
+	fileWrite(dstFilePath, pngEncode(img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}).SubImage(crop)))
+	return
+}
+
+// the image at `filePath` as either `*image.Gray` or `*image.RGBA`, as imgRotated & imgResampled
+// expect: this also drops 16-bit depth, but those are for fresh scans more than archived masters
+func imgDecodeFile(filePath string) draw.Image {
+	file, err := os.Open(filePath)
+	if err != nil {
+		panic(err)
+	}
+	srcimg, _, err := image.Decode(file)
+	_ = file.Close()
+	if err != nil {
+		panic(filePath + ": " + err.Error())
+	}
+	if gray, is := srcimg.(*image.Gray); is {
+		return gray
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, srcimg.Bounds().Dx(), srcimg.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), srcimg, srcimg.Bounds().Min, draw.Src)
+	return rgba
+}
+
+// the 8-bit gray of `img`, shared (not copied) if already `*image.Gray`
+func imgToGray(img image.Image) *image.Gray {
+	if gray, is := img.(*image.Gray); is {
+		return gray
+	}
+	bounds := img.Bounds()
+	ret := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			ret.Pix[(y-bounds.Min.Y)*ret.Stride+(x-bounds.Min.X)] = imgGrayOf(img.At(x, y))
+		}
+	}
+	return ret
+}
+
+// for each of the 4 sides, the first ink pixel met when walking inward along every few rows
+// (or columns), within the middle 80% of the sheet so as to stay clear of its corners: as
+// `[4][][2]int` of left, right, top, bottom samples of {position along the side, ink depth}.
+// With `pastSurround` (for photos), ink only counts once some paper has been walked over,
+// as whatever the sheet was lying on may well be darker than the ink threshold.
+func imgDeskewEdgeSamples(img *image.Gray, pastSurround bool) (ret [4][][2]int) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	var hist [256]int
+	for y := 0; y < h; y += 4 {
+		for x := 0; x < w; x += 4 {
+			hist[img.Pix[y*img.Stride+x]]++
+		}
+	}
+	blackiflessthan := imgGrayHistThreshold(hist[:])
+	ink := func(x int, y int) bool { // 3 px in a row, so that single dust specks don't count
+		return img.Pix[y*img.Stride+x] < blackiflessthan && img.Pix[y*img.Stride+min(w-1, x+1)] < blackiflessthan &&
+			img.Pix[y*img.Stride+max(0, x-1)] < blackiflessthan
+	}
+	inkv := func(x int, y int) bool {
+		return img.Pix[y*img.Stride+x] < blackiflessthan && img.Pix[min(h-1, y+1)*img.Stride+x] < blackiflessthan &&
+			img.Pix[max(0, y-1)*img.Stride+x] < blackiflessthan
+	}
+	first := func(num int, isInk func(int) bool) int {
+		i := 0
+		if pastSurround {
+			for run := 0; i < num && run < 8; i++ {
+				run = iIf(isInk(i), 0, run+1)
+			}
+		}
+		for ; i < num; i++ {
+			if isInk(i) {
+				return i
+			}
+		}
+		return -1
+	}
+	for y := h / 10; y < h-h/10; y += max(1, h/400) {
+		if x := first(w/2, func(i int) bool { return ink(i, y) }); x >= 0 {
+			ret[0] = append(ret[0], [2]int{y, x})
+		}
+		if i := first(w-w/2, func(i int) bool { return ink(w-1-i, y) }); i >= 0 {
+			ret[1] = append(ret[1], [2]int{y, w - i})
+		}
+	}
+	for x := w / 10; x < w-w/10; x += max(1, w/400) {
+		if y := first(h/2, func(i int) bool { return inkv(x, i) }); y >= 0 {
+			ret[2] = append(ret[2], [2]int{x, y})
+		}
+		if i := first(h-h/2, func(i int) bool { return inkv(x, h-1-i) }); i >= 0 {
+			ret[3] = append(ret[3], [2]int{x, h - i})
+		}
+	}
+	return
+}
+
+// the Theil-Sen line fit `depth = slope*pos + offset` of edge `samples`: medians of the
+// pairwise slopes and the resulting offsets, robust to the many samples that miss the
+// border (gutters, lettering sticking out, dust), with how many samples lie within 2px of it
+func imgDeskewLineFit(samples [][2]int) (slope float64, offset float64, numInliers int) {
+	if len(samples) < 8 {
+		return
+	}
+	span := samples[len(samples)-1][0] - samples[0][0]
+	slopes := make([]float64, 0, len(samples)*len(samples)/2)
+	for i := range samples {
+		for j := i + 1; j < len(samples); j++ {
+			if dpos := samples[j][0] - samples[i][0]; dpos > span/8 {
+				slopes = append(slopes, float64(samples[j][1]-samples[i][1])/float64(dpos))
+			}
+		}
+	}
+	if len(slopes) == 0 {
+		return
+	}
+	sort.Float64s(slopes)
+	slope = slopes[len(slopes)/2]
+	offsets := make([]float64, len(samples))
+	for i, sample := range samples {
+		offsets[i] = float64(sample[1]) - slope*float64(sample[0])
+	}
+	sort.Float64s(offsets)
+	offset = offsets[len(offsets)/2]
+	for _, sample := range samples {
+		if math.Abs(float64(sample[1])-(slope*float64(sample[0])+offset)) <= 2 {
+			numInliers++
+		}
+	}
+	return
+}
+
+// the rotation (in radians, clockwise in image coords) of `img`'s outer panel borders,
+// averaged over those sides whose fit agrees with at least a third of their samples
+func imgDeskewAngle(img *image.Gray, maxRad float64) (rad float64, ok bool) {
+	var num int
+	for side, samples := range imgDeskewEdgeSamples(img, false) {
+		if slope, _, numinliers := imgDeskewLineFit(samples); numinliers >= 8 && numinliers*3 >= len(samples) {
+			// a vertical line rotated by `rad` runs at x = -tan(rad)*y, a horizontal one at y = tan(rad)*x
+			rad, num = rad+fIf(side < 2, -math.Atan(slope), math.Atan(slope)), num+1
+		}
+	}
+	if num == 0 {
+		return 0, false
+	}
+	rad /= float64(num)
+	return rad, math.Abs(rad) <= maxRad
+}
+
+// the outer panel borders' (by now axis-aligned) bounding rectangle in `img`
+func imgDeskewBorder(img *image.Gray) (ret image.Rectangle, ok bool) {
+	var sides [4]int
+	for side, samples := range imgDeskewEdgeSamples(img, false) {
+		slope, offset, numinliers := imgDeskewLineFit(samples)
+		if numinliers < 8 || numinliers*3 < len(samples) {
+			return
+		}
+		mid := float64(samples[len(samples)/2][0])
+		sides[side] = int(math.Round(slope*mid + offset))
+	}
+	ret = image.Rect(sides[0], sides[2], sides[1], sides[3])
+	return ret, ret.Dx() > img.Rect.Dx()/2 && ret.Dy() > img.Rect.Dy()/2
+}
+
+// `img` rotated by `rad` (clockwise in image coords) around its center, same size
+func imgRotated(img draw.Image, rad float64) draw.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	cx, cy, sin, cos := float64(w)/2, float64(h)/2, math.Sin(rad), math.Cos(rad)
+	return imgResampled(img, w, h, func(x float64, y float64) (float64, float64) {
+		dx, dy := x-cx, y-cy
+		return cos*dx + sin*dy + cx, -sin*dx + cos*dy + cy
+	})
+}
+
+// a `w`x`h` image of `img`'s kind, each px bilinearly sampled from wherever `srcPt` maps its
+// center to in `img` (inverse mapping), with paper-white for points outside of `img`
+func imgResampled(img draw.Image, w int, h int, srcPt func(x float64, y float64) (float64, float64)) draw.Image {
+	var pix, dstpix []uint8
+	var stride, dststride, numch int
+	var ret draw.Image
+	switch img := img.(type) {
+	case *image.Gray:
+		dst := image.NewGray(image.Rect(0, 0, w, h))
+		pix, dstpix, stride, dststride, numch, ret = img.Pix, dst.Pix, img.Stride, dst.Stride, 1, dst
+	case *image.RGBA:
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		pix, dstpix, stride, dststride, numch, ret = img.Pix, dst.Pix, img.Stride, dst.Stride, 4, dst
+	default:
+		panic(img)
+	}
+	srcw, srch := img.Bounds().Dx(), img.Bounds().Dy()
+	at := func(x int, y int, ch int) float64 {
+		if x < 0 || y < 0 || x >= srcw || y >= srch {
+			return 255
+		}
+		return float64(pix[y*stride+x*numch+ch])
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := srcPt(float64(x)+0.5, float64(y)+0.5)
+			sx, sy = sx-0.5, sy-0.5
+			x0, y0 := int(math.Floor(sx)), int(math.Floor(sy))
+			tx, ty := sx-float64(x0), sy-float64(y0)
+			idx := y*dststride + x*numch
+			for ch := 0; ch < numch; ch++ {
+				top := at(x0, y0, ch)*(1-tx) + at(x0+1, y0, ch)*tx
+				bottom := at(x0, y0+1, ch)*(1-tx) + at(x0+1, y0+1, ch)*tx
+				dstpix[idx+ch] = uint8(math.Round(top*(1-ty) + bottom*ty))
+			}
+		}
+	}
+	return ret
+}
+
+// perspective-corrects the photographed (or otherwise not flatly scanned) sheet at `srcFilePath`
+// into `dstFilePath`: the corners of its outer panel borders get mapped onto an upright rectangle,
+// of `borderCm` at 600dpi if known (`pxCm` then being non-zero), else of the borders' own mean px
+// extents, with `marginCm` (or, lacking `borderCm`, 2%) of paper kept around. If no outer border
+// is found, nothing gets written and `ok` is false.
+func imgPerspectivePngFile(srcFilePath string, dstFilePath string, borderCm [2]float64, marginCm float64, grayOnly bool) (corners [4][2]float64, pxCm float64, ok bool) {
+	img := imgDecodeFile(srcFilePath)
+	if grayOnly {
+		img = imgToGray(img)
+	}
+	if corners, ok = imgPerspectiveCorners(imgToGray(img)); !ok {
+		return
+	}
+	dist := func(a [2]float64, b [2]float64) float64 { return math.Hypot(b[0]-a[0], b[1]-a[1]) }
+	bw, bh := 0.5*(dist(corners[0], corners[1])+dist(corners[3], corners[2])), 0.5*(dist(corners[0], corners[3])+dist(corners[1], corners[2]))
+	margin := 0.02 * math.Max(bw, bh)
+	if borderCm[0] > 0.001 && borderCm[1] > 0.001 {
+		pxCm = dpi1200 * 0.5 //600dpi
+		bw, bh, margin = borderCm[0]*pxCm, borderCm[1]*pxCm, marginCm*pxCm
+	}
+	bw, bh, margin = math.Round(bw), math.Round(bh), math.Round(margin)
+	hom := imgHomography([4][2]float64{{margin, margin}, {margin + bw, margin}, {margin + bw, margin + bh}, {margin, margin + bh}}, corners)
+	fileWrite(dstFilePath, pngEncode(imgResampled(img, int(bw+2*margin), int(bh+2*margin), func(x float64, y float64) (float64, float64) {
+		d := hom[6]*x + hom[7]*y + 1
+		return (hom[0]*x + hom[1]*y + hom[2]) / d, (hom[3]*x + hom[4]*y + hom[5]) / d
+	})))
+	return
+}
+
+// the top-left, top-right, bottom-right & bottom-left corners in which the fitted lines of
+// `img`'s outer panel borders meet: unlike in a flatbed scan, those needn't be parallel
+func imgPerspectiveCorners(img *image.Gray) (ret [4][2]float64, ok bool) {
+	var fits [4][2]float64
+	for side, samples := range imgDeskewEdgeSamples(img, true) {
+		slope, offset, numinliers := imgDeskewLineFit(samples)
+		if numinliers < 8 || numinliers*3 < len(samples) {
+			return
+		}
+		fits[side] = [2]float64{slope, offset}
+	}
+	// left & right run at x = a*y + b, top & bottom at y = c*x + d
+	meet := func(vert [2]float64, horiz [2]float64) [2]float64 {
+		a, b, c, d := vert[0], vert[1], horiz[0], horiz[1]
+		x := (a*d + b) / (1 - a*c)
+		return [2]float64{x, c*x + d}
+	}
+	ret = [4][2]float64{meet(fits[0], fits[2]), meet(fits[1], fits[2]), meet(fits[1], fits[3]), meet(fits[0], fits[3])}
+	w, h := float64(img.Rect.Dx()), float64(img.Rect.Dy())
+	for _, pt := range ret {
+		if math.IsNaN(pt[0]) || math.IsNaN(pt[1]) || pt[0] < -0.1*w || pt[1] < -0.1*h || pt[0] > 1.1*w || pt[1] > 1.1*h {
+			return
+		}
+	}
+	return ret, ret[1][0]-ret[0][0] > w/4 && ret[2][0]-ret[3][0] > w/4 && ret[3][1]-ret[0][1] > h/4 && ret[2][1]-ret[1][1] > h/4
+}
+
+// the projective transform taking each of `from` to the corresponding `to` point, as the 8
+// coefficients of x' = (h0*x + h1*y + h2) / (h6*x + h7*y + 1), y' = (h3*x + h4*y + h5) / (same)
+func imgHomography(from [4][2]float64, to [4][2]float64) (ret [8]float64) {
+	var m [8][9]float64
+	for i := range from {
+		x, y, u, v := from[i][0], from[i][1], to[i][0], to[i][1]
+		m[2*i] = [9]float64{x, y, 1, 0, 0, 0, -x * u, -y * u, u}
+		m[2*i+1] = [9]float64{0, 0, 0, x, y, 1, -x * v, -y * v, v}
+	}
+	for col := 0; col < 8; col++ { // Gauss-Jordan elimination, with partial pivoting
+		pivot := col
+		for row := col + 1; row < 8; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if m[col], m[pivot] = m[pivot], m[col]; m[col][col] == 0 {
+			panic("degenerate corners")
+		}
+		for row := 0; row < 8; row++ {
+			if f := m[row][col] / m[col][col]; row != col && f != 0 {
+				for i := col; i < 9; i++ {
+					m[row][i] -= f * m[col][i]
+				}
+			}
+		}
+	}
+	for i := range ret {
+		ret[i] = m[i][8] / m[i][i]
+	}
+	return
+}
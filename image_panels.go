@@ -4,6 +4,7 @@ import (
 	"image"
 	"image/color"
 	"io"
+	"math"
 	"slices"
 	"strings"
 )
@@ -16,21 +17,33 @@ var svgTxtCounter int
 
 type ImgPanel struct {
 	Rect              image.Rectangle
-	SubRows           []ImgPanel `json:",omitempty"`
-	SubCols           []ImgPanel `json:",omitempty"`
-	SbBorderOuter     int        `json:",omitempty"`
-	SbBorderInner     int        `json:",omitempty"`
+	SubRows           []ImgPanel    `json:",omitempty"`
+	SubCols           []ImgPanel    `json:",omitempty"`
+	SbBorderOuter     int           `json:",omitempty"`
+	SbBorderInner     int           `json:",omitempty"`
+	Traced            bool          `json:",omitempty"` // root only: detected by imgPanelsTraced
+	Poly              []image.Point `json:",omitempty"` // non-rectangular panels only: outline in sheet coords, Rect being its bounds
+	Z                 int           `json:",omitempty"` // overlapping panels only: higher draws on top
 	recenteredXOffset int
 }
 
 type ImgPanelArea struct {
 	Data                  map[string]string `json:",omitempty"`
+	Drafts                map[string]bool   `json:",omitempty"` // langs whose `Data` is an unreviewed machine translation
 	SvgTextTransformAttr  string            `json:",omitempty"`
 	SvgTextTspanStyleAttr string            `json:",omitempty"`
 	PointTo               *image.Point      `json:",omitempty"`
 	Rect                  image.Rectangle
 }
 
+// the text to generate for `langId`: unreviewed `Drafts` fall back to the main language, as do missing texts
+func (me *ImgPanelArea) text(langId string) string {
+	if me.Drafts[langId] {
+		langId = App.Proj.Langs[0]
+	}
+	return locStr(me.Data, langId)
+}
+
 func imgPanels(srcImg image.Image) *ImgPanel {
 	ret := ImgPanel{Rect: srcImg.Bounds()}
 	ret.detectSubPanels(srcImg.(*image.Gray))
@@ -38,7 +51,7 @@ func imgPanels(srcImg image.Image) *ImgPanel {
 	return &ret
 }
 
-func imgPanelsFile(srcImgData io.Reader, onDecoded func() error) *ImgPanel {
+func imgPanelsFile(srcImgData io.Reader, onDecoded func() error, traced bool) *ImgPanel {
 	imgsrc, _, err := image.Decode(srcImgData)
 	if onDecoded != nil {
 		_ = onDecoded() // allow early file-closing for the caller
@@ -46,9 +59,183 @@ func imgPanelsFile(srcImgData io.Reader, onDecoded func() error) *ImgPanel {
 	if err != nil {
 		panic(err)
 	}
+	if traced {
+		return imgPanelsTraced(imgToGray(imgsrc)) // eg. paletted after PNG recompression
+	}
 	return imgPanels(imgsrc)
 }
 
+// unlike imgPanels, which needs full-width or full-height gutters, this traces the
+// actual ink borders: every sizable connected non-ink region becomes a panel, so that
+// slanted, inset (overlapping) and irregularly-shaped panels get detected, too
+func imgPanelsTraced(srcImg *image.Gray) *ImgPanel {
+	ret := ImgPanel{Rect: srcImg.Bounds(), Traced: true}
+	panelmin := srcImg.Rect.Max.Y / panelMinDiv // ~1.9cm
+	cell := max(1, srcImg.Rect.Max.Y/600)       // ~0.5mm
+	gw, gh := (srcImg.Rect.Dx()+cell-1)/cell, (srcImg.Rect.Dy()+cell-1)/cell
+
+	// a grid cell counts as border only if all its pixels are ink
+	border := make([]bool, gw*gh)
+	for gy := 0; gy < gh; gy++ {
+		y0, y1 := srcImg.Rect.Min.Y+gy*cell, min(srcImg.Rect.Max.Y, srcImg.Rect.Min.Y+(gy+1)*cell)
+		for gx := 0; gx < gw; gx++ {
+			x0, x1 := srcImg.Rect.Min.X+gx*cell, min(srcImg.Rect.Max.X, srcImg.Rect.Min.X+(gx+1)*cell)
+			isborder := true
+			for py := y0; isborder && py < y1; py++ {
+				for _, col := range srcImg.Pix[srcImg.PixOffset(x0, py):srcImg.PixOffset(x1, py)] {
+					if isborder = (col < 128); !isborder {
+						break
+					}
+				}
+			}
+			border[gy*gw+gx] = isborder
+		}
+	}
+
+	var panels []ImgPanel
+	seen, stack := make([]bool, gw*gh), []int{}
+	for start := range border {
+		if seen[start] || border[start] {
+			continue
+		}
+		var pts []image.Point
+		bounds, numcells := image.Rectangle{Min: image.Pt(gw, gh)}, 0
+		seen[start], stack = true, append(stack[:0], start)
+		for len(stack) > 0 {
+			idx := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			gx, gy := idx%gw, idx/gw
+			numcells++
+			bounds.Min.X, bounds.Min.Y = min(bounds.Min.X, gx), min(bounds.Min.Y, gy)
+			bounds.Max.X, bounds.Max.Y = max(bounds.Max.X, gx+1), max(bounds.Max.Y, gy+1)
+			for _, next := range [4][2]int{{gx - 1, gy}, {gx + 1, gy}, {gx, gy - 1}, {gx, gy + 1}} {
+				if next[0] < 0 || next[1] < 0 || next[0] >= gw || next[1] >= gh || border[next[1]*gw+next[0]] {
+					pts = append(pts, image.Pt(gx, gy), image.Pt(gx+1, gy+1), image.Pt(gx+1, gy), image.Pt(gx, gy+1))
+				} else if nidx := next[1]*gw + next[0]; !seen[nidx] {
+					seen[nidx], stack = true, append(stack, nidx)
+				}
+			}
+		}
+		// skip specks, and the skinny networks of (non-ink) gutters between ink-bordered panels
+		if w, h := bounds.Dx()*cell, bounds.Dy()*cell; w > panelmin && h > panelmin && float64(numcells) >= 0.5*float64(bounds.Dx()*bounds.Dy()) {
+			panel := ImgPanel{Rect: image.Rect(bounds.Min.X*cell, bounds.Min.Y*cell, bounds.Max.X*cell, bounds.Max.Y*cell).Intersect(srcImg.Rect)}
+			if hull := polySimplified(polyConvexHull(pts), 2); len(hull) > 4 || (len(hull) == 4 && !polyIsRect(hull)) {
+				for _, pt := range hull {
+					panel.Poly = append(panel.Poly, image.Pt(pt.X*cell, pt.Y*cell))
+				}
+			}
+			panels = append(panels, panel)
+		}
+	}
+
+	for i := range panels {
+		for j := range panels {
+			if i != j && panels[i].Rect.In(panels[j].Rect) {
+				panels[i].Z++
+			}
+		}
+	}
+	// reading order: top-down, panels bucketed into rows while vertically overlapping the row so
+	// far, then each row left-to-right (a pairwise "same row?" comparison wouldn't be transitive)
+	slices.SortStableFunc(panels, func(p1 ImgPanel, p2 ImgPanel) int {
+		return p1.Rect.Min.Y - p2.Rect.Min.Y
+	})
+	sorted := make([]ImgPanel, 0, len(panels))
+	for start, rowmaxy, i := 0, 0, 0; i <= len(panels); i++ {
+		if i == len(panels) || (i > start && panels[i].Rect.Min.Y >= rowmaxy) {
+			row := panels[start:i]
+			slices.SortStableFunc(row, func(p1 ImgPanel, p2 ImgPanel) int {
+				return p1.Rect.Min.X - p2.Rect.Min.X
+			})
+			sorted, start = append(sorted, row...), i
+		}
+		if i < len(panels) {
+			rowmaxy = iIf(i == start, panels[i].Rect.Max.Y, max(rowmaxy, panels[i].Rect.Max.Y))
+		}
+	}
+	if len(sorted) > 1 {
+		ret.SubRows = sorted
+	}
+	return &ret
+}
+
+func polyConvexHull(pts []image.Point) (ret []image.Point) {
+	if len(pts) < 3 {
+		return pts
+	}
+	pts = slices.Clone(pts)
+	slices.SortFunc(pts, func(p1 image.Point, p2 image.Point) int {
+		return iIf(p1.X != p2.X, p1.X-p2.X, p1.Y-p2.Y)
+	})
+	pts = slices.Compact(pts)
+	cross := func(o image.Point, a image.Point, b image.Point) int {
+		return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+	}
+	for _, pt := range pts { // lower hull
+		for len(ret) >= 2 && cross(ret[len(ret)-2], ret[len(ret)-1], pt) <= 0 {
+			ret = ret[:len(ret)-1]
+		}
+		ret = append(ret, pt)
+	}
+	for i, lower := len(pts)-2, len(ret)+1; i >= 0; i-- { // upper hull
+		for len(ret) >= lower && cross(ret[len(ret)-2], ret[len(ret)-1], pts[i]) <= 0 {
+			ret = ret[:len(ret)-1]
+		}
+		ret = append(ret, pts[i])
+	}
+	return ret[:len(ret)-1]
+}
+
+// drops points closer than maxDist to the line between their neighbours (eg. hull "staircases")
+func polySimplified(poly []image.Point, maxDist float64) []image.Point {
+	for again := true; again && len(poly) > 3; {
+		again = false
+		for i := range poly {
+			prev, next := poly[(i+len(poly)-1)%len(poly)], poly[(i+1)%len(poly)]
+			dx, dy := float64(next.X-prev.X), float64(next.Y-prev.Y)
+			if dist := math.Abs(dy*float64(poly[i].X-prev.X)-dx*float64(poly[i].Y-prev.Y)) / math.Hypot(dx, dy); dist < maxDist {
+				poly, again = slices.Delete(poly, i, i+1), true
+				break
+			}
+		}
+	}
+	return poly
+}
+
+func polyIsRect(poly []image.Point) bool {
+	for i := range poly {
+		if next := poly[(i+1)%len(poly)]; poly[i].X != next.X && poly[i].Y != next.Y {
+			return false
+		}
+	}
+	return true
+}
+
+// the css `clip-path` for a polygonal panel, relative to its Rect
+func (me *ImgPanel) cssClipPath() string {
+	if len(me.Poly) == 0 {
+		return ""
+	}
+	pts := make([]string, 0, len(me.Poly))
+	for _, pt := range me.Poly {
+		pts = append(pts, ftoa(100.0*float64(pt.X-me.Rect.Min.X)/float64(me.Rect.Dx()), 2)+"% "+ftoa(100.0*float64(pt.Y-me.Rect.Min.Y)/float64(me.Rect.Dy()), 2)+"%")
+	}
+	return "clip-path: polygon(" + strings.Join(pts, ", ") + ");"
+}
+
+// the svg `points` of the panel outline (its Poly if any, else its Rect), relative to its Rect
+func (me *ImgPanel) svgPolyPoints() string {
+	poly := me.Poly
+	if len(poly) == 0 {
+		poly = []image.Point{me.Rect.Min, image.Pt(me.Rect.Max.X, me.Rect.Min.Y), me.Rect.Max, image.Pt(me.Rect.Min.X, me.Rect.Max.Y)}
+	}
+	pts := make([]string, 0, len(poly))
+	for _, pt := range poly {
+		pts = append(pts, itoa(pt.X-me.Rect.Min.X)+","+itoa(pt.Y-me.Rect.Min.Y))
+	}
+	return strings.Join(pts, " ")
+}
+
 func (me ImgPanel) flattened() ImgPanel {
 	for i := range me.SubRows {
 		me.SubRows[i] = me.SubRows[i].flattened()
@@ -64,6 +251,18 @@ func (me ImgPanel) flattened() ImgPanel {
 	return me
 }
 
+// a deep copy, unaffected by later in-place edits to `me`'s sub-panels
+func (me ImgPanel) cloned() ImgPanel {
+	me.Poly, me.SubRows, me.SubCols = slices.Clone(me.Poly), slices.Clone(me.SubRows), slices.Clone(me.SubCols)
+	for i := range me.SubRows {
+		me.SubRows[i] = me.SubRows[i].cloned()
+	}
+	for i := range me.SubCols {
+		me.SubCols[i] = me.SubCols[i].cloned()
+	}
+	return me
+}
+
 func (me *ImgPanel) detectSubPanels(srcImg *image.Gray) {
 	panelmin := srcImg.Rect.Max.Y / panelMinDiv // ~1.9cm
 	brborder := int(4.0 * (float64(srcImg.Rect.Max.Y) / 210.0))
@@ -165,6 +364,72 @@ func (me *ImgPanel) detectSubPanels(srcImg *image.Gray) {
 	}
 }
 
+// finds blank regions fully enclosed by ink within the panel (speech balloons,
+// caption boxes) and returns for each a text-area rect fitting inside it
+func (me *ImgPanel) detectTextAreas(srcImg *image.Gray, pxCm float64) (ret []image.Rectangle) {
+	area := me.Rect.Intersect(srcImg.Rect)
+	cell := int(pxCm / 20) // ~0.5mm
+	if cell < 1 {
+		cell = 1
+	}
+	gw, gh := (area.Dx()+cell-1)/cell, (area.Dy()+cell-1)/cell
+	if gw < 3 || gh < 3 {
+		return
+	}
+
+	// a grid cell counts as blank only if none of its pixels are ink
+	blank := make([]bool, gw*gh)
+	for gy := 0; gy < gh; gy++ {
+		y0, y1 := area.Min.Y+gy*cell, min(area.Max.Y, area.Min.Y+(gy+1)*cell)
+		for gx := 0; gx < gw; gx++ {
+			x0, x1 := area.Min.X+gx*cell, min(area.Max.X, area.Min.X+(gx+1)*cell)
+			isblank := true
+			for py := y0; isblank && py < y1; py++ {
+				for _, col := range srcImg.Pix[srcImg.PixOffset(x0, py):srcImg.PixOffset(x1, py)] {
+					if isblank = (col >= 128); !isblank {
+						break
+					}
+				}
+			}
+			blank[gy*gw+gx] = isblank
+		}
+	}
+
+	mincellsw, mincellsh, maxcells := int(1.2*pxCm)/cell, int(0.6*pxCm)/cell, (gw*gh)/2
+	seen, stack := make([]bool, gw*gh), []int{}
+	for start := range blank {
+		if seen[start] || !blank[start] {
+			continue
+		}
+		bounds, numcells, touchesedge := image.Rectangle{Min: image.Pt(gw, gh)}, 0, false
+		seen[start], stack = true, append(stack[:0], start)
+		for len(stack) > 0 {
+			idx := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			gx, gy := idx%gw, idx/gw
+			numcells++
+			bounds.Min.X, bounds.Min.Y = min(bounds.Min.X, gx), min(bounds.Min.Y, gy)
+			bounds.Max.X, bounds.Max.Y = max(bounds.Max.X, gx+1), max(bounds.Max.Y, gy+1)
+			touchesedge = touchesedge || gx == 0 || gy == 0 || gx == gw-1 || gy == gh-1
+			for _, next := range [4][2]int{{gx - 1, gy}, {gx + 1, gy}, {gx, gy - 1}, {gx, gy + 1}} {
+				if next[0] >= 0 && next[1] >= 0 && next[0] < gw && next[1] < gh {
+					if nidx := next[1]*gw + next[0]; blank[nidx] && !seen[nidx] {
+						seen[nidx], stack = true, append(stack, nidx)
+					}
+				}
+			}
+		}
+		// balloons are roughly elliptical (~78% filled), caption boxes rectangular (~100% filled)
+		if w, h := bounds.Dx(), bounds.Dy(); (!touchesedge) && w >= mincellsw && h >= mincellsh &&
+			numcells <= maxcells && float64(numcells) >= 0.6*float64(w*h) {
+			rect := image.Rect(area.Min.X+bounds.Min.X*cell, area.Min.Y+bounds.Min.Y*cell, area.Min.X+bounds.Max.X*cell, area.Min.Y+bounds.Max.Y*cell)
+			dx, dy := int(0.15*float64(rect.Dx())), int(0.15*float64(rect.Dy())) // ellipse-inscribed rects are ~70% the size of its bounds
+			ret = append(ret, image.Rect(rect.Min.X+dx, rect.Min.Y+dy, rect.Max.X-dx, rect.Max.Y-dy))
+		}
+	}
+	return
+}
+
 func (me *ImgPanel) each(onPanel func(*ImgPanel)) {
 	me.forEach(false, onPanel)
 }
@@ -201,6 +466,116 @@ func (me *ImgPanel) removePanels(sub_panels ...*ImgPanel) {
 	}
 }
 
+// like flattened, but keeps the root itself (with its Rect and its root-only fields) in place
+func (me *ImgPanel) flattenSubs() {
+	for i := range me.SubRows {
+		me.SubRows[i] = me.SubRows[i].flattened()
+	}
+	for i := range me.SubCols {
+		me.SubCols[i] = me.SubCols[i].flattened()
+	}
+	if subs := append(append([]ImgPanel{}, me.SubRows...), me.SubCols...); len(subs) == 1 {
+		me.SubRows, me.SubCols = subs[0].SubRows, subs[0].SubCols
+	}
+}
+
+// for manual panels-tree editing: the leaf panel at `pIdx` (in `each` order), its
+// parent (nil if the root is the only panel) and its index in the parent's subs
+func (me *ImgPanel) leaf(pIdx int) (leaf *ImgPanel, parent *ImgPanel, idx int) {
+	if len(me.SubRows) == 0 && len(me.SubCols) == 0 {
+		if pIdx == 0 {
+			leaf = me
+		}
+		return
+	}
+	var pidx int
+	var find func(*ImgPanel)
+	find = func(panel *ImgPanel) {
+		subs := panel.subs()
+		for i := 0; i < len(*subs) && leaf == nil; i++ {
+			if sub := &(*subs)[i]; len(sub.SubRows) > 0 || len(sub.SubCols) > 0 {
+				find(sub)
+			} else if pidx == pIdx {
+				leaf, parent, idx = sub, panel, i
+			} else {
+				pidx++
+			}
+		}
+	}
+	find(me)
+	return
+}
+
+func (me *ImgPanel) subs() *[]ImgPanel {
+	if len(me.SubCols) > 0 {
+		return &me.SubCols
+	}
+	return &me.SubRows
+}
+
+// splits leaf panel `pIdx` at `at` into 2 sub-cols (if `vertical`) or else 2 sub-rows
+func (me *ImgPanel) splitPanel(pIdx int, at image.Point, vertical bool) bool {
+	leaf, _, _ := me.leaf(pIdx)
+	if leaf == nil || !at.In(leaf.Rect) {
+		return false
+	}
+	one, two := leaf.Rect, leaf.Rect
+	if vertical {
+		one.Max.X, two.Min.X = at.X, at.X
+	} else {
+		one.Max.Y, two.Min.Y = at.Y, at.Y
+	}
+	if one.Empty() || two.Empty() {
+		return false
+	}
+	subs := []ImgPanel{{Rect: one, Z: leaf.Z}, {Rect: two, Z: leaf.Z}}
+	if leaf.Poly = nil; vertical {
+		leaf.SubCols = subs
+	} else {
+		leaf.SubRows = subs
+	}
+	return true
+}
+
+// merges leaf panel `pIdx` with its next sibling (if that's a leaf, too) into their union
+func (me *ImgPanel) mergePanelWithNext(pIdx int) bool {
+	leaf, parent, idx := me.leaf(pIdx)
+	if parent == nil {
+		return false
+	}
+	subs := parent.subs()
+	if idx+1 >= len(*subs) || len((*subs)[idx+1].SubRows) > 0 || len((*subs)[idx+1].SubCols) > 0 {
+		return false
+	}
+	leaf.Rect, leaf.Poly, leaf.Z = leaf.Rect.Union((*subs)[idx+1].Rect), nil, max(leaf.Z, (*subs)[idx+1].Z)
+	*subs = slices.Delete(*subs, idx+1, idx+2)
+	return true
+}
+
+// swaps leaf panel `pIdx` with its previous (`delta` < 0) or next (`delta` > 0) sibling
+func (me *ImgPanel) movePanel(pIdx int, delta int) bool {
+	_, parent, idx := me.leaf(pIdx)
+	if parent == nil || delta == 0 {
+		return false
+	}
+	subs, other := parent.subs(), idx+iIf(delta < 0, -1, 1)
+	if other < 0 || other >= len(*subs) {
+		return false
+	}
+	(*subs)[idx], (*subs)[other] = (*subs)[other], (*subs)[idx]
+	return true
+}
+
+// sets the bounds of leaf panel `pIdx`, clipped to the whole sheet
+func (me *ImgPanel) resizePanel(pIdx int, rect image.Rectangle) bool {
+	leaf, _, _ := me.leaf(pIdx)
+	if rect = rect.Canon().Intersect(me.Rect); leaf == nil || rect.Empty() || rect == leaf.Rect {
+		return false
+	}
+	leaf.Rect, leaf.Poly = rect, nil
+	return true
+}
+
 func (me *ImgPanel) setTopLevelRowRecenteredX(root *ImgPanel, w int, h int) {
 	padding := bookPanelsHPadding
 start:
@@ -303,7 +678,7 @@ func (me *SheetVer) imgSvgText(pidx int, tidx int, pta *ImgPanelArea, langId str
 		}
 		s += "<text " + sIf(isBorderAndFill, "y='"+itoa(svgtext.BoxPolyTopPx)+"px'", "") + " style='font-size: " + itoa(pxfont) + "px;' transform='" + trim(DeNewlineRepl.Replace(pta.SvgTextTransformAttr)) + "'>"
 		ts := "<tspan style='" + trim(DeNewlineRepl.Replace(tspanstyle)) + "' class='" + sIf(isstorytitle || strings.Contains(tspanstyle, "font-family"), "", "std") + "'>"
-		for _, ln := range strings.Split(svgRepl.Replace(hEsc(locStr(pta.Data, langId))), hEscs['\n']) {
+		for _, ln := range strings.Split(svgRepl.Replace(hEsc(pta.text(langId))), hEscs['\n']) {
 			if ln == "" {
 				ln = "&nbsp;"
 			}
@@ -324,7 +699,9 @@ func (me *SheetVer) imgSvgText(pidx int, tidx int, pta *ImgPanelArea, langId str
 		if mozscale {
 			s += "</svg>"
 		}
-		s = htmlEscdToXmlEsc(s)
+		if s = htmlEscdToXmlEsc(s); forEbook { // XHTML (unlike HTML) knows no `&nbsp;`
+			s = strings.Replace(s, "&nbsp;", "&#160;", -1)
+		}
 	}
 	return
 }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"image"
+	"math"
+)
+
+// a similarity transform: scaling & rotating (radians) about the origin, then offsetting
+type ImgXform struct {
+	Scale float64
+	Rot   float64
+	Dx    float64
+	Dy    float64
+}
+
+func (me ImgXform) apply(x float64, y float64) (float64, float64) {
+	sin, cos := math.Sincos(me.Rot)
+	return me.Dx + me.Scale*(cos*x-sin*y), me.Dy + me.Scale*(sin*x+cos*y)
+}
+
+func (me ImgXform) applyPt(pt image.Point) image.Point {
+	x, y := me.apply(float64(pt.X), float64(pt.Y))
+	return image.Pt(int(math.Round(x)), int(math.Round(y)))
+}
+
+// the bounding box of all 4 transformed corners
+func (me ImgXform) applyRect(r image.Rectangle) (ret image.Rectangle) {
+	for i, pt := range []image.Point{r.Min, {r.Max.X, r.Min.Y}, r.Max, {r.Min.X, r.Max.Y}} {
+		if pt = me.applyPt(pt); i == 0 {
+			ret = image.Rectangle{Min: pt, Max: pt}
+		} else {
+			ret.Min.X, ret.Min.Y, ret.Max.X, ret.Max.Y = min(ret.Min.X, pt.X), min(ret.Min.Y, pt.Y), max(ret.Max.X, pt.X), max(ret.Max.Y, pt.Y)
+		}
+	}
+	return
+}
+
+// `srcScale` and `dstScale` being the factors from "full" to "registered" size of each image
+func (me ImgXform) rescaled(srcScale float64, dstScale float64) ImgXform {
+	return ImgXform{Scale: me.Scale * srcScale / dstScale, Rot: me.Rot, Dx: me.Dx / dstScale, Dy: me.Dy / dstScale}
+}
+
+// estimates how `src` (b&w) maps onto `dst` (b&w, eg. a rescan of the same sheet): ink
+// centroids and spreads give the first guess, then a coarse-to-fine local search over
+// offset, scale and rotation maximizes `score`, the share of `src` ink landing on `dst` ink
+func imgRegister(src *image.Gray, dst *image.Gray) (xform ImgXform, score float64) {
+	const maxsamples = 22222
+	srcink, dstink := imgRegisterInk(src), imgRegisterInk(dst)
+	if len(srcink) == 0 || len(dstink) == 0 {
+		return ImgXform{Scale: 1}, 0
+	}
+	if stride := 1 + len(srcink)/maxsamples; stride > 1 {
+		samples := make([][2]float64, 0, maxsamples+1)
+		for i := 0; i < len(srcink); i += stride {
+			samples = append(samples, srcink[i])
+		}
+		srcink = samples
+	}
+	sx, sy, sspread := imgRegisterSpread(srcink)
+	dx, dy, dspread := imgRegisterSpread(dstink)
+	dstbounds, dstmask := dst.Bounds(), imgRegisterMask(dst)
+
+	// params: scale, rotation about the src centroid, then the offset of that centroid
+	param := [4]float64{dspread / sspread, 0, dx, dy}
+	eval := func(p [4]float64) float64 {
+		sin, cos := math.Sincos(p[1])
+		var numhits int
+		for _, pt := range srcink {
+			x, y := pt[0]-sx, pt[1]-sy
+			tx, ty := int(p[2]+p[0]*(cos*x-sin*y)), int(p[3]+p[0]*(sin*x+cos*y))
+			if tx >= dstbounds.Min.X && ty >= dstbounds.Min.Y && tx < dstbounds.Max.X && ty < dstbounds.Max.Y && dstmask[(ty-dstbounds.Min.Y)*dstbounds.Dx()+(tx-dstbounds.Min.X)] {
+				numhits++
+			}
+		}
+		return float64(numhits) / float64(len(srcink))
+	}
+	score = eval(param)
+	for _, rot := range []float64{-1.5, -0.75, 0.75, 1.5} { // rescans are rarely rotated by more
+		p := [4]float64{param[0], rot * math.Pi / 180, param[2], param[3]}
+		if sc := eval(p); sc > score {
+			param, score = p, sc
+		}
+	}
+	for steps := [4]float64{0.02, 0.5 * math.Pi / 180, 8, 8}; steps[2] >= 0.25; steps = [4]float64{steps[0] * 0.5, steps[1] * 0.5, steps[2] * 0.5, steps[3] * 0.5} {
+		for improved := true; improved; {
+			improved = false
+			for i := range param {
+				for _, sign := range []float64{-1, 1} {
+					p := param
+					if p[i] += sign * steps[i]; i != 0 || p[i] > 0 {
+						if sc := eval(p); sc > score {
+							param, score, improved = p, sc, true
+						}
+					}
+				}
+			}
+		}
+	}
+
+	xform = ImgXform{Scale: param[0], Rot: param[1]}
+	ox, oy := xform.apply(sx, sy)
+	xform.Dx, xform.Dy = param[2]-ox, param[3]-oy
+	return
+}
+
+// the coordinates of all ink (non-white) pixels
+func imgRegisterInk(img *image.Gray) (ret [][2]float64) {
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			if img.GrayAt(x, y).Y < 128 {
+				ret = append(ret, [2]float64{float64(x), float64(y)})
+			}
+		}
+	}
+	return
+}
+
+// centroid and root-mean-square distance from it
+func imgRegisterSpread(pts [][2]float64) (cx float64, cy float64, spread float64) {
+	for _, pt := range pts {
+		cx, cy = cx+pt[0], cy+pt[1]
+	}
+	cx, cy = cx/float64(len(pts)), cy/float64(len(pts))
+	for _, pt := range pts {
+		spread += (pt[0]-cx)*(pt[0]-cx) + (pt[1]-cy)*(pt[1]-cy)
+	}
+	return cx, cy, math.Max(1, math.Sqrt(spread/float64(len(pts))))
+}
+
+// the ink of `img`, dilated by 1px so that near-misses (rescans never align to the pixel) still count
+func imgRegisterMask(img *image.Gray) []bool {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	mask := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if img.Pix[y*img.Stride+x] < 128 {
+				for yy := max(0, y-1); yy <= min(h-1, y+1); yy++ {
+					for xx := max(0, x-1); xx <= min(w-1, x+1); xx++ {
+						mask[yy*w+xx] = true
+					}
+				}
+			}
+		}
+	}
+	return mask
+}
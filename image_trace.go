@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"strings"
+)
+
+// tuning of imgTrace, akin to potrace's `-t` & `-a` (cx.json's `Sheets.Panel.Trace`)
+type TraceOpts struct {
+	TurdSize  int     `json:",omitempty"` // ink specks & holes of at most this many pixels get dropped, defaults to 2
+	AlphaMax  float64 `json:",omitempty"` // corner threshold from 0 (all sharp, use eg. 0.01) to 1.3334 (all smooth), defaults to 1
+	Tolerance float64 `json:",omitempty"` // max px the polygon may stray from the pixel outline, defaults to 0.5
+}
+
+func (me *TraceOpts) turdSize() int {
+	if me.TurdSize > 0 {
+		return me.TurdSize
+	}
+	return 2
+}
+
+func (me *TraceOpts) alphaMax() float64 {
+	if me.AlphaMax > 0 {
+		return me.AlphaMax
+	}
+	return 1
+}
+
+func (me *TraceOpts) tolerance() float64 {
+	if me.Tolerance > 0 {
+		return me.Tolerance
+	}
+	return 0.5
+}
+
+// for the SVG quali's `PicDirPath`, so re-tuning re-traces
+func (me *TraceOpts) cacheKey() string {
+	return ".t" + itoa(me.turdSize()) + "-" + ftoa(me.alphaMax(), -1) + "-" + ftoa(me.tolerance(), -1)
+}
+
+// one segment of a traced closed curve, starting where the previous one ended:
+// either a corner (straight to `Vertex`, then straight to `End`) or a cubic Bezier
+type TraceSeg struct {
+	Corner bool
+	C1     [2]float64 // Bezier only
+	C2     [2]float64 // Bezier only
+	Vertex [2]float64 // corner only
+	End    [2]float64
+}
+
+// traces the ink (< 128) of `rect` in `img` into closed curves, in px relative to `rect.Min`,
+// much like potrace: outlines get decomposed (and their insides XOR-flipped, so that holes
+// and islands in holes become further curves, for an even-odd fill), then simplified into
+// polygons, then smoothed into Beziers wherever a polygon vertex isn't sharp enough a corner
+func imgTrace(img *image.Gray, rect image.Rectangle, opts *TraceOpts) (ret [][]TraceSeg) {
+	w, h := rect.Dx(), rect.Dy()
+	bm := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			bm[y*w+x] = img.Pix[img.PixOffset(rect.Min.X+x, rect.Min.Y+y)] < 128
+		}
+	}
+	ink := func(x int, y int) bool {
+		return x >= 0 && y >= 0 && x < w && y < h && bm[y*w+x]
+	}
+	for start := 0; start < w*h; start++ {
+		if !bm[start] {
+			continue
+		}
+		x0, y0 := start%w, start/w
+		outline := imgTraceOutline(ink, x0, y0)
+		var area int
+		for i, pt := range outline {
+			next := outline[(i+1)%len(outline)]
+			if area += pt[0]*next[1] - next[0]*pt[1]; pt[1] != next[1] {
+				y := min(pt[1], next[1])
+				for x := min(pt[0], x0); x < max(pt[0], x0); x++ {
+					bm[y*w+x] = !bm[y*w+x]
+				}
+			}
+		}
+		if max(area, -area)/2 > opts.turdSize() {
+			ret = append(ret, imgTraceSmooth(imgTracePolygon(outline, opts.tolerance()), opts.alphaMax()))
+		}
+	}
+	return
+}
+
+// the pixel-corner vertices around the ink region whose top-left pixel is at `x0,y0`, walked
+// with the ink on the left, diagonally touching ink counting as connected
+func imgTraceOutline(ink func(int, int) bool, x0 int, y0 int) (ret [][2]int) {
+	x, y, dx, dy := x0, y0, 0, 1
+	for {
+		ret = append(ret, [2]int{x, y})
+		x, y = x+dx, y+dy
+		lx, ly := dy, -dx // to the left of the walking direction
+		inkleft, inkright := ink((2*x+dx+lx-1)/2, (2*y+dy+ly-1)/2), ink((2*x+dx-lx-1)/2, (2*y+dy-ly-1)/2)
+		if inkright { // turn right
+			dx, dy = -lx, -ly
+		} else if !inkleft { // turn left
+			dx, dy = lx, ly
+		}
+		if x == x0 && y == y0 && dx == 0 && dy == 1 {
+			return
+		}
+	}
+}
+
+// simplifies the closed `outline` to the vertices of a polygon staying within `tolerance` of
+// its edges' midpoints (Douglas-Peucker, split at the point farthest from the first)
+func imgTracePolygon(outline [][2]int, tolerance float64) (ret [][2]float64) {
+	pt := func(i int) [2]float64 { // the midpoint of the unit edge, halving the pixel stairs' amplitude
+		p, next := outline[i%len(outline)], outline[(i+1)%len(outline)]
+		return [2]float64{0.5 * float64(p[0]+next[0]), 0.5 * float64(p[1]+next[1])}
+	}
+	far, fardist := 0, -1.0
+	for i := range outline {
+		if d := math.Hypot(pt(i)[0]-pt(0)[0], pt(i)[1]-pt(0)[1]); d > fardist {
+			far, fardist = i, d
+		}
+	}
+	keep := make([]bool, len(outline)+1)
+	keep[0], keep[far], keep[len(outline)] = true, true, true
+	for stack := [][2]int{{0, far}, {far, len(outline)}}; len(stack) > 0; {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		a, b := pt(span[0]), pt(span[1])
+		seglen := math.Hypot(b[0]-a[0], b[1]-a[1])
+		idx, maxdist := -1, tolerance
+		for i := span[0] + 1; i < span[1]; i++ {
+			p := pt(i)
+			d := math.Hypot(p[0]-a[0], p[1]-a[1])
+			if seglen > 0 {
+				d = math.Abs((b[0]-a[0])*(a[1]-p[1])-(a[0]-p[0])*(b[1]-a[1])) / seglen
+			}
+			if d > maxdist {
+				idx, maxdist = i, d
+			}
+		}
+		if idx >= 0 {
+			keep[idx] = true
+			stack = append(stack, [2]int{span[0], idx}, [2]int{idx, span[1]})
+		}
+	}
+	for i := range outline {
+		if keep[i] {
+			ret = append(ret, pt(i))
+		}
+	}
+	return
+}
+
+// potrace's smoothing: each polygon vertex becomes either a corner or a Bezier curve from the
+// midpoint of its incoming edge to that of its outgoing edge, depending on its "alpha", ie.
+// how far it juts out from the line between its neighbours
+func imgTraceSmooth(poly [][2]float64, alphaMax float64) (ret []TraceSeg) {
+	sign := func(f float64) float64 {
+		return fIf(f > 0, 1, fIf(f < 0, -1, 0))
+	}
+	lerp := func(t float64, a [2]float64, b [2]float64) [2]float64 {
+		return [2]float64{a[0] + t*(b[0]-a[0]), a[1] + t*(b[1]-a[1])}
+	}
+	n := len(poly)
+	ret = make([]TraceSeg, n)
+	for i := range poly {
+		p0, p1, p2 := poly[(i+n-1)%n], poly[i], poly[(i+1)%n]
+		alpha := 4.0 / 3.0
+		if denom := sign(p2[1]-p0[1])*(p2[1]-p0[1]) + sign(p2[0]-p0[0])*(p2[0]-p0[0]); denom != 0 {
+			dd := math.Abs(((p1[0]-p0[0])*(p2[1]-p0[1]) - (p2[0]-p0[0])*(p1[1]-p0[1])) / denom)
+			alpha = fIf(dd > 1, 1-1/dd, 0) / 0.75
+		}
+		seg := TraceSeg{End: lerp(0.5, p1, p2)}
+		if n < 3 || alpha >= alphaMax {
+			seg.Corner, seg.Vertex = true, p1
+		} else {
+			alpha = math.Max(0.55, math.Min(1, alpha))
+			seg.C1, seg.C2 = lerp(0.5+0.5*alpha, p0, p1), lerp(0.5+0.5*alpha, p2, p1)
+		}
+		ret[i] = seg
+	}
+	return
+}
+
+// compact SVG path data of `curves`: 0.1px precision, relative coords, no redundant separators or command letters
+func imgTraceSvgPathData(curves [][]TraceSeg) string {
+	var buf strings.Builder
+	var cmd byte
+	var cx, cy int // current point, in tenths of px
+	var lastnum string
+	tenths := func(f float64) int { return int(math.Round(f * 10)) }
+	num := func(n int) {
+		s := sIf(n < 0, "-", "")
+		if n = max(n, -n); n >= 10 {
+			s += itoa(n / 10)
+		}
+		if n%10 != 0 {
+			s += "." + itoa(n%10)
+		} else if n < 10 {
+			s += "0"
+		}
+		// separators only where needed: not before "-", nor before ".5" right after "1.5"
+		if lastnum != "" && s[0] != '-' && !(s[0] == '.' && strings.IndexByte(lastnum, '.') >= 0) {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(s)
+		lastnum = s
+	}
+	op := func(c byte, pts ...[2]float64) {
+		if c != cmd || c == 'M' {
+			buf.WriteByte(c)
+			lastnum = ""
+		}
+		cmd = c
+		var nx, ny int
+		for _, pt := range pts {
+			nx, ny = tenths(pt[0]), tenths(pt[1])
+			if c == 'M' {
+				num(nx)
+				num(ny)
+			} else {
+				num(nx - cx)
+				num(ny - cy)
+			}
+		}
+		cx, cy = nx, ny
+	}
+	for _, curve := range curves {
+		op('M', curve[len(curve)-1].End)
+		for _, seg := range curve {
+			if seg.Corner {
+				op('l', seg.Vertex)
+				op('l', seg.End)
+			} else {
+				op('c', seg.C1, seg.C2, seg.End)
+			}
+		}
+		buf.WriteByte('z')
+		cmd, lastnum = 'z', ""
+	}
+	return buf.String()
+}
+
+// the path data from an imgSubRectSvg-traced file, or "" if not such (eg. an embedded-raster one)
+func imgTraceSvgPathDataFrom(svg []byte) string {
+	if bytes.Contains(svg, []byte("<image")) {
+		return ""
+	}
+	if idx := bytes.Index(svg, []byte(` d="`)); idx > 0 {
+		d := svg[idx+len(` d="`):]
+		if idx = bytes.IndexByte(d, '"'); idx >= 0 {
+			return string(d[:idx])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a chapter's watch folder (cx.json's `Chapter.Inbox`) for pages not coming from our own
+// scanners, eg. phone photos or another studio's scans: while the GUI runs, every new image
+// file in `Dir` gets perspective-corrected into `scans/SERIES/CHAPTER/NAME.YYYYMMDD.png`,
+// then moved into `Dir/.imported` and picked up as a new sheet version (or, if failing to
+// import, moved into `Dir/.failed` and reported)
+type InboxOpts struct {
+	Dir       string     // created if missing, on GUI start
+	SheetName string     `json:",omitempty"` // as in the scan form (a run of '#' for the next free number), else each file's own base name
+	BorderCm  [2]float64 // the outer panel borders' true width & height: required, as imports get resampled by it to 600dpi
+}
+
+// the inbox is only watched with its `BorderCm` set: photos carry no usable resolution of their own
+func (me *InboxOpts) usable() bool {
+	return me != nil && me.Dir != "" && me.BorderCm[0] > 0.001 && me.BorderCm[1] > 0.001
+}
+
+// files in an `InboxOpts.Dir` are only imported once unchanged since the previous poll
+const inboxPollInterval = 4 * time.Second
+
+var inbox struct {
+	sync.Mutex
+	seen    map[string][2]int64 // inbox file paths to their last-polled {mod-time, size}
+	failed  map[string][2]int64 // inbox file paths to the {mod-time, size} whose import failed but that could not be moved into `.failed`, not retried unless changed
+	pending []inboxImported     // imported but not yet added to the loaded project, see inboxApply
+}
+
+type inboxImported struct {
+	chapter  *Chapter
+	fileName string
+}
+
+// polls all chapters' inbox dirs until the GUI exits
+func inboxWatch() {
+	inbox.Lock()
+	inbox.seen, inbox.failed = map[string][2]int64{}, map[string][2]int64{}
+	inbox.Unlock()
+	for _, series := range App.Proj.Series {
+		for _, chapter := range series.Chapters {
+			if chapter.Inbox != nil && chapter.Inbox.Dir != "" {
+				func() {
+					defer App.Report.catch("inbox", chapter, nil)
+					if !chapter.Inbox.usable() {
+						panic("not watching " + chapter.Inbox.Dir + " without its BorderCm set, as the resolution of imports would be unknown")
+					} else if err := os.MkdirAll(chapter.Inbox.Dir, os.ModePerm); err != nil {
+						panic(err)
+					}
+				}()
+			}
+		}
+	}
+	for ; !App.Gui.Exiting.Load(); time.Sleep(inboxPollInterval) {
+		for _, series := range App.Proj.Series {
+			for _, chapter := range series.Chapters {
+				if chapter.Inbox.usable() {
+					inboxPoll(chapter)
+				}
+			}
+		}
+	}
+}
+
+func inboxPoll(chapter *Chapter) {
+	entries, err := os.ReadDir(chapter.Inbox.Dir)
+	if err != nil {
+		return // already reported by inboxWatch if failing to create it, and no need to do so every few seconds
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || scanFileExt(entry.Name()) == "" {
+			continue
+		}
+		fileinfo, err := entry.Info()
+		if err != nil {
+			continue // gone since the ReadDir
+		}
+		filename, stamp := filepath.Join(chapter.Inbox.Dir, entry.Name()), [2]int64{fileinfo.ModTime().UnixNano(), fileinfo.Size()}
+		inbox.Lock()
+		seen, failed := inbox.seen[filename], inbox.failed[filename]
+		inbox.seen[filename] = stamp
+		inbox.Unlock()
+		if seen == stamp && failed != stamp { // not still being written, nor failed before
+			inboxImport(chapter, filename, stamp)
+		}
+	}
+}
+
+func inboxImport(chapter *Chapter, srcFilePath string, stamp [2]int64) {
+	opts := chapter.Inbox
+	defer App.Report.catch("inbox", chapter, func() {
+		faileddirpath := filepath.Join(opts.Dir, ".failed")
+		err := os.MkdirAll(faileddirpath, os.ModePerm)
+		if err == nil {
+			err = os.Rename(srcFilePath, filepath.Join(faileddirpath, filepath.Base(srcFilePath)))
+		}
+		if err != nil {
+			App.Report.add("inbox", chapter, err)
+			inbox.Lock()
+			inbox.failed[srcFilePath] = stamp
+			inbox.Unlock()
+		}
+	})
+	sheetname, sheetvername := strings.TrimSuffix(filepath.Base(srcFilePath), filepath.Ext(srcFilePath)), time.Now().Format("20060102")
+	if idx := strings.LastIndexByte(sheetname, '.'); idx > 0 { // already named as in scans/, eg. from another studio
+		if _, err := time.Parse("20060102", sheetname[idx+1:]); err == nil {
+			sheetname, sheetvername = sheetname[:idx], sheetname[idx+1:]
+		}
+	}
+	if opts.SheetName != "" {
+		sheetname = opts.SheetName
+	}
+	scanQueue.Lock() // for scanSheetFileName
+	dstfilepath := scanSheetFileName(chapter, sheetname, sheetvername)
+	scanQueue.Unlock()
+	if fileStat(dstfilepath) != nil {
+		panic(srcFilePath + ": not importing over existing " + dstfilepath)
+	}
+
+	timedLogged("Inbox: importing "+srcFilePath+" as "+dstfilepath+"...", func() string {
+		corners, pxcm, ok := imgPerspectivePngFile(srcFilePath, dstfilepath, opts.BorderCm, App.Proj.Sheets.Deskew.marginCm(), !chapter.FullColor)
+		info := &ScanInfo{Dev: "inbox", Opts: map[string]string{"source": filepath.Base(srcFilePath)}, Dt: time.Now().UnixNano()}
+		if ok {
+			info.Opts["corners"] = toJsonStr(corners)
+		} else {
+			App.Report.add("inbox", chapter, srcFilePath+": no outer panel borders found for perspective correction, imported as-is")
+			img := imgDecodeFile(srcFilePath)
+			if !chapter.FullColor {
+				img = imgToGray(img)
+			}
+			fileWrite(dstfilepath, pngEncode(img))
+		}
+		scanRecordInfo(dstfilepath, pxcm, info)
+
+		importeddirpath := filepath.Join(opts.Dir, ".imported")
+		mkDir(importeddirpath)
+		if err := os.Rename(srcFilePath, filepath.Join(importeddirpath, filepath.Base(srcFilePath))); err != nil {
+			panic(err)
+		}
+		inbox.Lock()
+		inbox.pending = append(inbox.pending, inboxImported{chapter: chapter, fileName: dstfilepath})
+		inbox.Unlock()
+		return sIf(ok, "with", "without") + " perspective correction"
+	})
+}
+
+// adds the sheet versions imported since the last call to the loaded project and preps them,
+// but only once no prep work is under way (until then, they stay pending): called on each
+// GUI request, returning a notice of what got added (if anything)
+func inboxApply() (notice string) {
+	if !prepAllDone() {
+		return ""
+	}
+	inbox.Lock()
+	pending := inbox.pending
+	inbox.pending = nil
+	inbox.Unlock()
+
+	var names []string
+	scanQueue.Lock() // as held by `scanSheetFileName` callers (such as `inboxImport`) while reading `Chapter.sheets`
+	defer scanQueue.Unlock()
+	for _, it := range pending {
+		func() {
+			defer App.Report.catch("inbox", it.chapter, nil)
+			sv := it.chapter.addSheetVerFile("inbox", it.fileName)
+			names = append(names, it.chapter.Name+"/"+sv.parentSheet.name)
+		}()
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	go appPrepWork(false)
+	return "Imported from inbox: " + strings.Join(names, ", ")
+}
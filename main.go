@@ -60,7 +60,9 @@ func main() {
 	})
 
 	if len(os.Args) > 1 {
-		appPrepWork(false)
+		if os.Args[1] != "check" && os.Args[1] != "translate" && os.Args[1] != "restore" {
+			appPrepWork(false)
+		}
 		args := map[string]bool{}
 		for _, arg := range os.Args[2:] {
 			args[arg] = true
@@ -68,22 +70,27 @@ func main() {
 		if msg := appMainAction(false, os.Args[1], args); msg != "" {
 			printLn(msg)
 		}
+		numproblems := App.Report.print()
 		appOnExit()
+		if numproblems > 0 && os.Args[1] == "check" { // for scripts & CI: other actions' problems are only printed above
+			os.Exit(1)
+		}
 	} else {
 		App.Gui.BrowserPid = -1
 		go appPrepWork(true)
 		if os.Getenv("NOGUI") == "" {
 			go scanDevicesDetection()
-			go httpListenAndServe()
+			go inboxWatch()
+			go httpListenAndServe(":4321", httpHandle)
 			go launchGuiInKioskyBrowser()
 		}
-		for App.Gui.Exiting = false; !App.Gui.Exiting; time.Sleep(time.Second) {
-			appbusy := (scanJob != nil) || (scanDevices == nil) ||
-				(0 < atomic.LoadInt32(&numBusyRequests)) || !App.Proj.allPrepsDone
+		for App.Gui.Exiting.Store(false); !App.Gui.Exiting.Load(); time.Sleep(time.Second) {
+			appbusy := scanQueueBusy() || (scanDevices == nil) ||
+				(0 < atomic.LoadInt32(&numBusyRequests)) || !prepAllDone()
 			for _, busy := range appMainActions {
 				appbusy = appbusy || busy
 			}
-			App.Gui.Exiting = (App.Gui.BrowserPid == 0) && !appbusy
+			App.Gui.Exiting.Store((App.Gui.BrowserPid == 0) && !appbusy)
 		}
 		appOnExit()
 	}
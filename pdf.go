@@ -0,0 +1,599 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/md5"
+	"encoding/hex"
+	"image"
+	"image/draw"
+	"maps"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+const pdfPtMm = 72.0 / 25.4
+
+var pdfCssFontFamily = regexp.MustCompile(`font-family\s*:\s*['"]?([^'";,]+)`)
+var pdfCssFontUrl = regexp.MustCompile(`url\(['"]?\./([^'")]+)`)
+
+// a minimal in-process PDF writer (for BookGen): pages of PNG images, vector
+// paths and text in embedded TrueType / OpenType fonts. All page coords are in
+// mm from the top-left, like in our SVGs, rather than PDF's pt from bottom-left
+type Pdf struct {
+	Info map[string]string // Title, Author, Subject, Keywords...
+
+	objs    [][]byte // obj number n is at [n-1]
+	pages   []int
+	images  map[string]*pdfImage
+	fonts   map[string]*PdfFont
+	gstates map[string]int
+}
+
+type PdfPage struct {
+	doc   *Pdf
+	wMm   float64
+	hMm   float64
+	boxes map[string][4]float64 // TrimBox, BleedBox, ArtBox: x0,y0,x1,y1 in mm from top-left
+	buf   bytes.Buffer
+	res   map[string]map[string]int // XObject, Font, ExtGState: names to obj numbers
+}
+
+type PdfFont struct {
+	name   string
+	objNr  int
+	std    bool // no usable font file found: falls back to Helvetica (not embedded)
+	cff    bool
+	data   []byte
+	sfnt   *sfnt.Font
+	sbuf   sfnt.Buffer
+	upem   fixed.Int26_6
+	glyphs map[sfnt.GlyphIndex]rune
+	widths map[sfnt.GlyphIndex]int
+}
+
+type pdfImage struct {
+	objNr int
+	w, h  int
+}
+
+type PdfTextStyle struct {
+	Bold        bool
+	Italic      bool
+	FillGray    float64
+	StrokeGray  float64
+	StrokeWidth float64 // if >0, outlines the glyphs (beneath the fill, like svg's `paint-order: stroke`)
+}
+
+func pdfNew(info map[string]string) *Pdf {
+	me := Pdf{Info: info, images: map[string]*pdfImage{}, fonts: map[string]*PdfFont{}, gstates: map[string]int{}}
+	_, _ = me.alloc(), me.alloc() // 1: catalog, 2: pages tree
+	return &me
+}
+
+func (me *Pdf) alloc() int {
+	me.objs = append(me.objs, nil)
+	return len(me.objs)
+}
+
+func (me *Pdf) set(objNr int, dict string, stream []byte) {
+	var buf bytes.Buffer
+	buf.WriteString(itoa(objNr) + " 0 obj\n" + dict + "\n")
+	if stream != nil {
+		buf.WriteString("stream\n")
+		buf.Write(stream)
+		buf.WriteString("\nendstream\n")
+	}
+	buf.WriteString("endobj\n")
+	me.objs[objNr-1] = buf.Bytes()
+}
+
+func (me *Pdf) add(dict string, stream []byte) (objNr int) {
+	objNr = me.alloc()
+	me.set(objNr, dict, stream)
+	return
+}
+
+func (me *Pdf) addStream(dict string, data []byte, compress bool) int {
+	if compress {
+		data, dict = pdfDeflate(data), dict+" /Filter /FlateDecode"
+	}
+	return me.add("<< "+dict+" /Length "+itoa(len(data))+" >>", data)
+}
+
+func pdfDeflate(data []byte) []byte {
+	var buf bytes.Buffer
+	zw, _ := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	if _, err := zw.Write(data); err != nil {
+		panic(err)
+	} else if err = zw.Close(); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// a PDF text string: plain if ASCII, else UTF-16BE
+func pdfStr(s string) string {
+	for _, r := range s {
+		if r >= 128 || r < 32 {
+			return "<FEFF" + strings.ToUpper(hex.EncodeToString(pdfUtf16(s))) + ">"
+		}
+	}
+	return "(" + strings.NewReplacer("\\", "\\\\", "(", "\\(", ")", "\\)").Replace(s) + ")"
+}
+
+func pdfUtf16(s string) (ret []byte) {
+	for _, u := range utf16.Encode([]rune(s)) {
+		ret = append(ret, byte(u>>8), byte(u))
+	}
+	return
+}
+
+func pdfNum(f float64) string {
+	return strconv.FormatFloat(math.Round(f*10000)/10000, 'f', -1, 64)
+}
+
+func pdfNums(fs ...float64) string {
+	strs := make([]string, len(fs))
+	for i, f := range fs {
+		strs[i] = pdfNum(f)
+	}
+	return strings.Join(strs, " ")
+}
+
+// a new page of the given trim size, plus `bleedMm` all around (if any)
+func (me *Pdf) page(wMm float64, hMm float64, bleedMm float64) *PdfPage {
+	pg := PdfPage{doc: me, wMm: wMm + 2*bleedMm, hMm: hMm + 2*bleedMm, res: map[string]map[string]int{"XObject": {}, "Font": {}, "ExtGState": {}}, boxes: map[string][4]float64{}}
+	if pg.op(pdfNums(pdfPtMm, 0, 0, -pdfPtMm, 0, pg.hMm*pdfPtMm) + " cm"); bleedMm > 0 {
+		pg.boxes["BleedBox"] = [4]float64{0, 0, pg.wMm, pg.hMm}
+		pg.boxes["TrimBox"] = [4]float64{bleedMm, bleedMm, bleedMm + wMm, bleedMm + hMm}
+		pg.op(pdfNums(1, 0, 0, 1, bleedMm, bleedMm) + " cm") // so coords are relative to the trim box
+	}
+	return &pg
+}
+
+// in mm relative to the trim box
+func (me *PdfPage) box(name string, xMm float64, yMm float64, wMm float64, hMm float64) {
+	x0, y0 := xMm+me.boxes["TrimBox"][0], yMm+me.boxes["TrimBox"][1]
+	me.boxes[name] = [4]float64{x0, y0, x0 + wMm, y0 + hMm}
+}
+
+func (me *PdfPage) op(s string) {
+	me.buf.WriteString(s)
+	me.buf.WriteByte('\n')
+}
+
+func (me *PdfPage) push(a float64, b float64, c float64, d float64, e float64, f float64) {
+	me.op("q " + pdfNums(a, b, c, d, e, f) + " cm")
+}
+
+func (me *PdfPage) pop() {
+	me.op("Q")
+}
+
+func (me *PdfPage) path(pts [][2]float64) {
+	for i, pt := range pts {
+		me.op(pdfNums(pt[0], pt[1]) + sIf(i == 0, " m", " l"))
+	}
+	me.op("h")
+}
+
+// appends SVG path data `d` (as by imgTraceSvgPathData, so only M/m, L/l, C/c & Z/z) to the current path
+func (me *PdfPage) svgPath(d string) {
+	var cmd byte
+	var nums []float64
+	var cx, cy, sx, sy float64
+	flush := func() {
+		rel := cmd >= 'a'
+		for n := map[byte]int{'m': 2, 'l': 2, 'c': 6}[cmd|0x20]; n > 0 && len(nums) >= n; nums = nums[n:] {
+			pts := slices.Clone(nums[:n])
+			for i := 0; rel && i < n; i += 2 {
+				pts[i], pts[i+1] = pts[i]+cx, pts[i+1]+cy
+			}
+			cx, cy = pts[n-2], pts[n-1]
+			switch cmd | 0x20 {
+			case 'm':
+				sx, sy = cx, cy
+				me.op(pdfNums(pts...) + " m")
+				cmd = sIf(rel, "l", "L")[0] // further pairs after a moveto are linetos
+			case 'l':
+				me.op(pdfNums(pts...) + " l")
+			case 'c':
+				me.op(pdfNums(pts...) + " c")
+			}
+		}
+		nums = nums[:0]
+	}
+	for i := 0; i < len(d); {
+		switch c := d[i]; {
+		case strings.IndexByte("MmLlCcZz", c) >= 0:
+			flush()
+			if cmd = c; c|0x20 == 'z' {
+				me.op("h")
+				cx, cy = sx, sy
+			}
+			i++
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for dot := c == '.'; j < len(d) && ((d[j] >= '0' && d[j] <= '9') || (d[j] == '.' && !dot)); j++ {
+				dot = dot || d[j] == '.'
+			}
+			f, _ := strconv.ParseFloat(d[i:j], 64)
+			nums, i = append(nums, f), j
+		default:
+			i++
+		}
+	}
+	flush()
+}
+
+func (me *PdfPage) rectPath(x float64, y float64, w float64, h float64) {
+	me.op(pdfNums(x, y, w, h) + " re")
+}
+
+// fills and/or strokes the current path: gray < 0 means none
+func (me *PdfPage) paint(fillGray float64, strokeGray float64, strokeWidth float64) {
+	if fillGray >= 0 {
+		me.op(pdfNum(fillGray) + " g")
+	}
+	if stroke := strokeGray >= 0 && strokeWidth > 0; stroke {
+		me.op(pdfNum(strokeGray) + " G " + pdfNum(strokeWidth) + " w 1 j")
+		me.op(sIf(fillGray >= 0, "B", "S"))
+	} else {
+		me.op(sIf(fillGray >= 0, "f", "n"))
+	}
+}
+
+// clips to the current path (until the next `pop`)
+func (me *PdfPage) clip() {
+	me.op("W n")
+}
+
+func (me *PdfPage) opacity(alpha float64) {
+	key := pdfNum(alpha)
+	objnr := me.doc.gstates[key]
+	if objnr == 0 {
+		objnr = me.doc.add("<< /Type /ExtGState /ca "+key+" /CA "+key+" >>", nil)
+		me.doc.gstates[key] = objnr
+	}
+	name := "G" + itoa(objnr)
+	me.res["ExtGState"][name] = objnr
+	me.op("/" + name + " gs")
+}
+
+// draws the PNG file into the given rect, which if `h` is 0 gets the image's aspect ratio
+func (me *PdfPage) image(filePath string, x float64, y float64, w float64, h float64) {
+	img := me.doc.image(filePath)
+	if h == 0 {
+		h = w * (float64(img.h) / float64(img.w))
+	}
+	name := "I" + itoa(img.objNr)
+	me.res["XObject"][name] = img.objNr
+	me.push(w, 0, 0, -h, x, y+h)
+	me.op("/" + name + " Do")
+	me.pop()
+}
+
+func (me *Pdf) imageSize(filePath string) (int, int) {
+	img := me.image(filePath)
+	return img.w, img.h
+}
+
+func (me *Pdf) image(filePath string) *pdfImage {
+	if img := me.images[filePath]; img != nil {
+		return img
+	}
+	src, _, err := image.Decode(bytes.NewReader(fileRead(filePath)))
+	if err != nil {
+		panic(err)
+	}
+	bounds := src.Bounds()
+	ret := &pdfImage{w: bounds.Dx(), h: bounds.Dy()}
+	dict := "/Type /XObject /Subtype /Image /Width " + itoa(ret.w) + " /Height " + itoa(ret.h) + " /BitsPerComponent 8"
+	if gray, _ := src.(*image.Gray); gray != nil {
+		pix := gray.Pix
+		if gray.Stride != ret.w || bounds.Min != (image.Point{}) {
+			pix = make([]byte, 0, ret.w*ret.h)
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				pix = append(pix, gray.Pix[gray.PixOffset(bounds.Min.X, y):gray.PixOffset(bounds.Max.X, y)]...)
+			}
+		}
+		ret.objNr = me.addStream(dict+" /ColorSpace /DeviceGray", pix, true)
+	} else {
+		nrgba := image.NewNRGBA(image.Rect(0, 0, ret.w, ret.h))
+		draw.Draw(nrgba, nrgba.Rect, src, bounds.Min, draw.Src)
+		rgb, alpha, opaque := make([]byte, 0, 3*ret.w*ret.h), make([]byte, 0, ret.w*ret.h), true
+		for i := 0; i < len(nrgba.Pix); i += 4 {
+			rgb, alpha = append(rgb, nrgba.Pix[i:i+3]...), append(alpha, nrgba.Pix[i+3])
+			opaque = opaque && nrgba.Pix[i+3] == 255
+		}
+		if !opaque {
+			dict += " /SMask " + itoa(me.addStream("/Type /XObject /Subtype /Image /Width "+itoa(ret.w)+" /Height "+itoa(ret.h)+" /BitsPerComponent 8 /ColorSpace /DeviceGray", alpha, true)) + " 0 R"
+		}
+		ret.objNr = me.addStream(dict+" /ColorSpace /DeviceRGB", rgb, true)
+	}
+	me.images[filePath] = ret
+	return ret
+}
+
+// the font of the given CSS `font-family` per `App.Proj.Sheets.Panel.CssFontFaces`
+func (me *Pdf) font(family string) *PdfFont {
+	if fnt := me.fonts[family]; fnt != nil {
+		return fnt
+	}
+	fnt := &PdfFont{name: "F" + itoa(len(me.fonts)+1), objNr: me.alloc(), std: true, glyphs: map[sfnt.GlyphIndex]rune{}, widths: map[sfnt.GlyphIndex]int{}}
+	me.fonts[family] = fnt
+	for _, css := range App.Proj.Sheets.Panel.CssFontFaces {
+		if m := pdfCssFontFamily.FindStringSubmatch(css); len(m) > 1 && trim(m[1]) == family {
+			if m = pdfCssFontUrl.FindStringSubmatch(css); len(m) > 1 {
+				if data, err := os.ReadFile("site/files/" + m[1]); err == nil {
+					if f, err := sfnt.Parse(data); err == nil {
+						fnt.std, fnt.data, fnt.sfnt, fnt.upem, fnt.cff = false, data, f, fixed.I(int(f.UnitsPerEm())), bytes.HasPrefix(data, []byte("OTTO"))
+					}
+				}
+			}
+			break
+		}
+	}
+	if fnt.std {
+		App.Report.add("gen", nil, "PDF: no TTF/OTF font file (in cx.json's Sheets.Panel.CssFontFaces) for '"+family+"', falling back to non-embedded Helvetica")
+	}
+	return fnt
+}
+
+// the PDF-encoded string (hex glyph IDs, or for the fallback font a literal
+// string) and its advance width in 1000ths of the font size
+func (me *PdfFont) encode(s string) (enc string, width int) {
+	if me.std {
+		var sb strings.Builder
+		for _, r := range s {
+			if r >= 256 {
+				r = '?'
+			}
+			if width += 556; r == '(' || r == ')' || r == '\\' {
+				sb.WriteByte('\\')
+			}
+			sb.WriteByte(byte(r))
+		}
+		return "(" + sb.String() + ")", width
+	}
+	var sb strings.Builder
+	sb.WriteByte('<')
+	for _, r := range s {
+		gi, err := me.sfnt.GlyphIndex(&me.sbuf, r)
+		if err != nil {
+			gi = 0
+		}
+		w, known := me.widths[gi]
+		if !known {
+			if adv, err := me.sfnt.GlyphAdvance(&me.sbuf, gi, me.upem, font.HintingNone); err == nil {
+				w = int(1000 * float64(adv) / float64(me.upem))
+			}
+			me.widths[gi] = w
+		}
+		if _, known = me.glyphs[gi]; !known && gi != 0 {
+			me.glyphs[gi] = r
+		}
+		width += w
+		sb.WriteString(strings.ToUpper(hex.EncodeToString([]byte{byte(gi >> 8), byte(gi)})))
+	}
+	sb.WriteByte('>')
+	return sb.String(), width
+}
+
+// the font's own line metrics, in 1000ths of the font size
+func (me *PdfFont) metrics() (ascent int, descent int, capHeight int, bbox [4]int) {
+	ascent, descent, capHeight, bbox = 718, -207, 718, [4]int{-166, -225, 1000, 931}
+	if !me.std {
+		if m, err := me.sfnt.Metrics(&me.sbuf, me.upem, font.HintingNone); err == nil {
+			ascent, descent, capHeight = int(1000*float64(m.Ascent)/float64(me.upem)), -int(1000*float64(m.Descent)/float64(me.upem)), int(1000*float64(m.CapHeight)/float64(me.upem))
+		}
+		if b, err := me.sfnt.Bounds(&me.sbuf, me.upem, font.HintingNone); err == nil {
+			bbox = [4]int{int(1000 * float64(b.Min.X) / float64(me.upem)), -int(1000 * float64(b.Max.Y) / float64(me.upem)),
+				int(1000 * float64(b.Max.X) / float64(me.upem)), -int(1000 * float64(b.Min.Y) / float64(me.upem))}
+		}
+	}
+	return
+}
+
+// draws `s` with its baseline starting at x,y (in the current coords, with y
+// pointing down) transformed by the affine `mat` (if any, see svgTransformMatrix),
+// and returns its advance width
+func (me *PdfPage) text(fnt *PdfFont, size float64, mat *[6]float64, x float64, y float64, s string, style PdfTextStyle) (advance float64) {
+	enc, width := fnt.encode(s)
+	me.res["Font"][fnt.name] = fnt.objNr
+	if advance = size * float64(width) / 1000; trim(s) == "" {
+		return
+	}
+	// glyph space points up, so flip, and for italics shear
+	tm := pdfMatMul([6]float64{1, 0, fIf(style.Italic, 0.2, 0), -1, x, y}, [6]float64{1, 0, 0, 1, 0, 0})
+	if mat != nil {
+		tm = pdfMatMul(tm, *mat)
+	}
+	me.op("BT /" + fnt.name + " " + pdfNum(size) + " Tf " + pdfNums(tm[:]...) + " Tm")
+	fill := pdfNum(style.FillGray) + " g"
+	if style.StrokeWidth > 0 { // stroke first, then fill over it
+		me.op(pdfNum(style.StrokeGray) + " G " + pdfNum(style.StrokeWidth) + " w 1 j 1 Tr " + enc + " Tj " + pdfNums(tm[:]...) + " Tm")
+	}
+	if style.Bold { // synthetic: fill plus a thin same-colored outline
+		me.op(fill + " " + pdfNum(style.FillGray) + " G " + pdfNum(size*0.033) + " w 2 Tr " + enc + " Tj ET")
+	} else {
+		me.op(fill + " 0 Tr " + enc + " Tj ET")
+	}
+	return
+}
+
+// the affine product `a` then `b`, both as in PDF's `cm` and SVG's `matrix()`
+func pdfMatMul(a [6]float64, b [6]float64) [6]float64 {
+	return [6]float64{
+		a[0]*b[0] + a[1]*b[2], a[0]*b[1] + a[1]*b[3],
+		a[2]*b[0] + a[3]*b[2], a[2]*b[1] + a[3]*b[3],
+		a[4]*b[0] + a[5]*b[2] + b[4], a[4]*b[1] + a[5]*b[3] + b[5],
+	}
+}
+
+// parses an SVG `transform` attribute value (translate, scale, rotate, skewX, skewY, matrix)
+func svgTransformMatrix(transform string) (ret [6]float64) {
+	ret = [6]float64{1, 0, 0, 1, 0, 0}
+	for _, part := range strings.Split(transform, ")") {
+		idx := strings.IndexByte(part, '(')
+		if idx < 0 {
+			continue
+		}
+		var args []float64
+		for _, arg := range strings.FieldsFunc(part[idx+1:], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' }) {
+			if f, err := strconv.ParseFloat(arg, 64); err == nil {
+				args = append(args, f)
+			}
+		}
+		arg := func(i int, def float64) float64 {
+			if i < len(args) {
+				return args[i]
+			}
+			return def
+		}
+		var mat [6]float64
+		switch trim(part[:idx]) {
+		case "translate":
+			mat = [6]float64{1, 0, 0, 1, arg(0, 0), arg(1, 0)}
+		case "scale":
+			mat = [6]float64{arg(0, 1), 0, 0, arg(1, arg(0, 1)), 0, 0}
+		case "rotate":
+			rad := arg(0, 0) * math.Pi / 180
+			cx, cy := arg(1, 0), arg(2, 0)
+			mat = pdfMatMul(pdfMatMul([6]float64{1, 0, 0, 1, -cx, -cy}, [6]float64{math.Cos(rad), math.Sin(rad), -math.Sin(rad), math.Cos(rad), 0, 0}), [6]float64{1, 0, 0, 1, cx, cy})
+		case "skewX":
+			mat = [6]float64{1, 0, math.Tan(arg(0, 0) * math.Pi / 180), 1, 0, 0}
+		case "skewY":
+			mat = [6]float64{1, math.Tan(arg(0, 0) * math.Pi / 180), 0, 1, 0, 0}
+		case "matrix":
+			mat = [6]float64{arg(0, 1), arg(1, 0), arg(2, 0), arg(3, 1), arg(4, 0), arg(5, 0)}
+		default:
+			continue
+		}
+		ret = pdfMatMul(mat, ret) // svg applies the right-most transform first
+	}
+	return
+}
+
+func (me *Pdf) pageEnd(pg *PdfPage) {
+	res := ""
+	for _, kind := range sortedMapKeys(pg.res) {
+		if names := pg.res[kind]; len(names) > 0 {
+			res += " /" + kind + " <<"
+			for _, name := range sortedMapKeys(names) {
+				res += " /" + name + " " + itoa(names[name]) + " 0 R"
+			}
+			res += " >>"
+		}
+	}
+	content := me.addStream("", pg.buf.Bytes(), true)
+	dict := "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 " + pdfNums(pg.wMm*pdfPtMm, pg.hMm*pdfPtMm) + "] /Contents " + itoa(content) + " 0 R /Resources <<" + res + " >>"
+	for _, name := range sortedMapKeys(pg.boxes) {
+		box := pg.boxes[name] // our y points down, PDF's up
+		dict += " /" + name + " [" + pdfNums(box[0]*pdfPtMm, (pg.hMm-box[3])*pdfPtMm, box[2]*pdfPtMm, (pg.hMm-box[1])*pdfPtMm) + "]"
+	}
+	me.pages = append(me.pages, me.add(dict+" >>", nil))
+}
+
+func (me *Pdf) fontsEnd() {
+	for _, name := range sortedMapKeys(me.fonts) {
+		fnt := me.fonts[name]
+		if fnt.std {
+			me.set(fnt.objNr, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>", nil)
+			continue
+		}
+		basefont, _ := fnt.sfnt.Name(&fnt.sbuf, sfnt.NameIDPostScript)
+		if basefont = strings.Map(func(r rune) rune {
+			return rune(iIf(r > 32 && r < 127 && !strings.ContainsRune("()<>[]{}/%#", r), int(r), -1))
+		}, basefont); basefont == "" {
+			basefont = fnt.name
+		}
+		ascent, descent, capheight, bbox := fnt.metrics()
+		fontfile := me.addStream(sIf(fnt.cff, "/Subtype /OpenType", "/Length1 "+itoa(len(fnt.data))), fnt.data, true)
+		descriptor := me.add("<< /Type /FontDescriptor /FontName /"+basefont+" /Flags 32 /FontBBox ["+itoa(bbox[0])+" "+itoa(bbox[1])+" "+itoa(bbox[2])+" "+itoa(bbox[3])+
+			"] /ItalicAngle 0 /Ascent "+itoa(ascent)+" /Descent "+itoa(descent)+" /CapHeight "+itoa(capheight)+" /StemV 80 /"+sIf(fnt.cff, "FontFile3", "FontFile2")+" "+itoa(fontfile)+" 0 R >>", nil)
+		widths, tounicode := "", ""
+		for _, gi := range slices.Sorted(maps.Keys(fnt.widths)) {
+			widths += itoa(int(gi)) + " [" + itoa(fnt.widths[gi]) + "] "
+		}
+		for _, gi := range slices.Sorted(maps.Keys(fnt.glyphs)) {
+			tounicode += "<" + strings.ToUpper(hex.EncodeToString([]byte{byte(gi >> 8), byte(gi)})) + "> <" + strings.ToUpper(hex.EncodeToString(pdfUtf16(string(fnt.glyphs[gi])))) + ">\n"
+		}
+		cidfont := me.add("<< /Type /Font /Subtype /"+sIf(fnt.cff, "CIDFontType0", "CIDFontType2")+" /BaseFont /"+basefont+
+			" /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor "+itoa(descriptor)+" 0 R /DW 1000 /W ["+widths+"]"+sIf(fnt.cff, "", " /CIDToGIDMap /Identity")+" >>", nil)
+		cmap := me.addStream("", []byte(`/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def
+/CMapName /Adobe-Identity-UCS def
+/CMapType 2 def
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+`+pdfBfChars(tounicode)+`endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end`), true)
+		me.set(fnt.objNr, "<< /Type /Font /Subtype /Type0 /BaseFont /"+basefont+" /Encoding /Identity-H /DescendantFonts ["+itoa(cidfont)+" 0 R] /ToUnicode "+itoa(cmap)+" 0 R >>", nil)
+	}
+}
+
+// bfchar sections may hold at most 100 entries each
+func pdfBfChars(lines string) (s string) {
+	all := strings.Split(strings.TrimSuffix(lines, "\n"), "\n")
+	for i := 0; i < len(all) && lines != ""; i += 100 {
+		chunk := all[i:min(i+100, len(all))]
+		s += itoa(len(chunk)) + " beginbfchar\n" + strings.Join(chunk, "\n") + "\nendbfchar\n"
+	}
+	return
+}
+
+// writes out the whole document. For reproducible output, no dates get
+// recorded unless the `SOURCE_DATE_EPOCH` env var is set
+func (me *Pdf) writeFile(outFilePath string) {
+	me.fontsEnd()
+	kids := ""
+	for _, pg := range me.pages {
+		kids += itoa(pg) + " 0 R "
+	}
+	me.set(2, "<< /Type /Pages /Kids ["+kids+"] /Count "+itoa(len(me.pages))+" >>", nil)
+	me.set(1, "<< /Type /Catalog /Pages 2 0 R >>", nil)
+	info := "/Producer (cositegen)"
+	for _, k := range sortedMapKeys(me.Info) {
+		if v := me.Info[k]; v != "" {
+			info += " /" + k + " " + pdfStr(v)
+		}
+	}
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		dt := "(D:" + time.Unix(epoch, 0).UTC().Format("20060102150405") + "Z)"
+		info += " /CreationDate " + dt + " /ModDate " + dt
+	}
+	infonr := me.add("<< "+info+" >>", nil)
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(me.objs))
+	for i, obj := range me.objs {
+		offsets[i] = buf.Len()
+		buf.Write(obj)
+	}
+	id := md5.Sum(buf.Bytes())
+	xref := buf.Len()
+	buf.WriteString("xref\n0 " + itoa(len(me.objs)+1) + "\n0000000000 65535 f \n")
+	for _, offset := range offsets {
+		buf.WriteString(itoa0pref(offset, 10) + " 00000 n \n")
+	}
+	buf.WriteString("trailer\n<< /Size " + itoa(len(me.objs)+1) + " /Root 1 0 R /Info " + itoa(infonr) + " 0 R /ID [<" + hex.EncodeToString(id[:]) + "> <" + hex.EncodeToString(id[:]) + ">] >>\nstartxref\n" + itoa(xref) + "\n%%EOF\n")
+	fileWrite(outFilePath, buf.Bytes())
+}
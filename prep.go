@@ -0,0 +1,245 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type PrepState int
+
+const (
+	PrepQueued PrepState = iota
+	PrepRunning
+	PrepDone
+	PrepFailed
+)
+
+func (me PrepState) String() string {
+	return [...]string{"queued", "running", "done", "failed"}[me]
+}
+
+type PrepJob struct {
+	Sv        *SheetVer
+	State     PrepState
+	Stage     string // while `PrepRunning`: the current step of `SheetVer.ensurePrep`
+	DidWork   bool
+	memCost   uint64
+	started   time.Time
+	committed *SheetVerData // `Sv.Data` as of the job's start, for `Project.save` to store while it runs
+}
+
+// the background prep scheduler: sheets get prepped by up to `maxJobs` workers
+// at once, but only as long as their estimated decoding memory fits `maxMem`
+// (a single sheet over budget still runs, just not alongside any others)
+var appPrep struct {
+	sync.Mutex
+	cond    *sync.Cond
+	jobs    []*PrepJob
+	byID    map[string]*PrepJob
+	memUsed uint64
+	maxMem  uint64
+	maxJobs int
+}
+
+func prepRun(svs []*SheetVer, onDone func(*PrepJob)) {
+	jobs, byid := make([]*PrepJob, 0, len(svs)), make(map[string]*PrepJob, len(svs))
+	for _, sv := range svs {
+		job := &PrepJob{Sv: sv, State: PrepQueued, memCost: prepMemCost(sv)}
+		jobs, byid[sv.ID] = append(jobs, job), job
+	}
+	appPrep.Lock()
+	if appPrep.cond == nil {
+		appPrep.cond = sync.NewCond(&appPrep.Mutex)
+	}
+	appPrep.maxJobs, appPrep.maxMem = prepMaxJobs(), prepMaxMem()
+	appPrep.jobs, appPrep.byID, appPrep.memUsed = jobs, byid, 0
+	appPrep.Unlock()
+	printLn("Prepping " + itoa(len(jobs)) + " sheets with up to " + itoa(appPrep.maxJobs) + " concurrent jobs within ~" + itoa(int(appPrep.maxMem/(1024*1024))) + "MB...")
+
+	stopprogress := make(chan bool)
+	go func() {
+		for ticker := time.NewTicker(11 * time.Second); ; {
+			select {
+			case <-stopprogress:
+				ticker.Stop()
+				return
+			case <-ticker.C:
+				printLn(prepProgressLine())
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		appPrep.Lock()
+		for numrunning := prepNumRunning(); numrunning >= appPrep.maxJobs ||
+			(numrunning > 0 && appPrep.memUsed+job.memCost > appPrep.maxMem); numrunning = prepNumRunning() {
+			appPrep.cond.Wait()
+		}
+		job.State, job.Stage, job.started, appPrep.memUsed = PrepRunning, "", time.Now(), appPrep.memUsed+job.memCost
+		job.committed = job.Sv.Data.cloned()
+		appPrep.Unlock()
+
+		wg.Add(1)
+		go func(job *PrepJob) {
+			defer wg.Done()
+			state := PrepFailed
+			defer func() {
+				appPrep.Lock()
+				job.State, job.Stage, appPrep.memUsed = state, "", appPrep.memUsed-job.memCost
+				appPrep.cond.Broadcast()
+				appPrep.Unlock()
+				onDone(job)
+			}()
+			func() {
+				job.Sv.prep.Lock()
+				defer job.Sv.prep.Unlock()
+				defer App.Report.catch("prep", job.Sv, nil)
+				if !job.Sv.prep.done {
+					job.DidWork = job.Sv.ensurePrep(true, false)
+					job.Sv.prep.done = true
+				}
+				state = PrepDone
+			}()
+		}(job)
+	}
+	wg.Wait()
+	close(stopprogress)
+}
+
+// callers hold the `appPrep` lock
+func prepNumRunning() (n int) {
+	for _, job := range appPrep.jobs {
+		if job.State == PrepRunning {
+			n++
+		}
+	}
+	return
+}
+
+// called from `SheetVer.ensurePrep` at the start of each of its steps
+func prepStage(sv *SheetVer, stage string) {
+	appPrep.Lock()
+	defer appPrep.Unlock()
+	if job := appPrep.byID[sv.ID]; job != nil && job.State == PrepRunning {
+		job.Stage = stage
+	}
+}
+
+// the state of `sv` in the current (or most recent) prep run, if any
+func prepJobOf(sv *SheetVer) (job PrepJob, ok bool) {
+	appPrep.Lock()
+	defer appPrep.Unlock()
+	if it := appPrep.byID[sv.ID]; it != nil {
+		job, ok = *it, true
+	}
+	return
+}
+
+// callers hold the `appPrep` lock: the IDs of all sheets currently mid-prep, to
+// their data from before (`nil` if none yet), as last committed by their prep
+func prepCommittedData() (ret map[string]*SheetVerData) {
+	for _, job := range appPrep.jobs {
+		if job.State == PrepRunning {
+			if ret == nil {
+				ret = map[string]*SheetVerData{}
+			}
+			ret[job.Sv.ID] = job.committed
+		}
+	}
+	return
+}
+
+// whether the most recent `appPrepWork` run has finished
+func prepAllDone() bool {
+	appPrep.Lock()
+	defer appPrep.Unlock()
+	return App.Proj.allPrepsDone
+}
+
+func prepCounts() (counts [4]int, running []PrepJob) {
+	appPrep.Lock()
+	defer appPrep.Unlock()
+	for _, job := range appPrep.jobs {
+		if counts[job.State]++; job.State == PrepRunning {
+			running = append(running, *job)
+		}
+	}
+	return
+}
+
+func prepProgressLine() string {
+	counts, running := prepCounts()
+	s := "PREP: " + itoa(counts[PrepQueued]) + " queued, " + itoa(counts[PrepRunning]) + " running, " + itoa(counts[PrepDone]) + " done, " + itoa(counts[PrepFailed]) + " failed"
+	for _, job := range running {
+		s += "\n\t" + job.Sv.FileName + ": " + sIf(job.Stage == "", "starting", job.Stage) + " (" + time.Since(job.started).Round(time.Second).String() + ")"
+	}
+	return s
+}
+
+// `PREPJOBS` env var, else cx.json's `Sheets.Prep.MaxJobs`, else the number of CPUs
+func prepMaxJobs() int {
+	if n, err := strconv.Atoi(os.Getenv("PREPJOBS")); err == nil && n > 0 {
+		return n
+	} else if App.Proj.Sheets.Prep.MaxJobs > 0 {
+		return App.Proj.Sheets.Prep.MaxJobs
+	}
+	return runtime.NumCPU()
+}
+
+// `PREPMEMMB` env var, else cx.json's `Sheets.Prep.MaxMemMB`, else half the RAM
+func prepMaxMem() uint64 {
+	if n, err := strconv.ParseUint(os.Getenv("PREPMEMMB"), 10, 64); err == nil && n > 0 {
+		return n * 1024 * 1024
+	} else if App.Proj.Sheets.Prep.MaxMemMB > 0 {
+		return uint64(App.Proj.Sheets.Prep.MaxMemMB) * 1024 * 1024
+	}
+	if data, err := os.ReadFile("/proc/meminfo"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "MemTotal:" {
+				if kb, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+					return kb * 1024 / 2
+				}
+			}
+		}
+	}
+	return 4096 * 1024 * 1024
+}
+
+// rough bytes-in-memory estimate of prepping `sv`: its decoded scan plus the gray
+// and b&w copies, or for already-prepped sheets just one decoded b&w image
+func prepMemCost(sv *SheetVer) uint64 {
+	file, err := os.Open(sv.FileName)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	cfg, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0
+	}
+	numpx := uint64(cfg.Width) * uint64(cfg.Height)
+	if sv.Data != nil && sv.Data.PanelsTree != nil && fileStat(sv.Data.BwFilePath) != nil && fileStat(sv.Data.BwSmallFilePath) != nil {
+		return numpx
+	}
+	bytesperpx := uint64(4)
+	switch cfg.ColorModel {
+	case color.GrayModel:
+		bytesperpx = 1
+	case color.Gray16Model:
+		bytesperpx = 2
+	case color.RGBA64Model, color.NRGBA64Model:
+		bytesperpx = 8
+	default:
+		if _, ok := cfg.ColorModel.(color.Palette); ok {
+			bytesperpx = 1
+		}
+	}
+	return numpx * (bytesperpx + 2)
+}
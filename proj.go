@@ -49,6 +49,20 @@ type Project struct {
 			}
 		}
 	}
+	Scan struct {
+		Profiles    map[string]*ScanProfile      // by name, eg. "pencils 600dpi gray" or "inks 1200dpi"
+		DevDefaults map[string]map[string]string // per device ident ("" for all), over the built-in `saneDevDefaults`
+		DevDontShow map[string][]string          // per device ident ("" for all), added to the built-in `saneDevDontShow`
+		Escl        []string                     // base URLs of eSCL (AirScan) network scanners, eg. "http://192.168.1.23/eSCL"
+		PreviewDpi  int                          // for preview scans, defaults to 75
+	}
+	Translate struct {
+		GlossaryFile string
+		Http         struct {
+			Url    string
+			ApiKey string
+		}
+	}
 	Site struct {
 		StoryboardsDir string
 		Title          string
@@ -85,6 +99,7 @@ type Project struct {
 			Thresholds struct {
 				Previewable []uint8
 				Defaults    map[string]uint8
+				Auto        bool // sheets without explicit threshold (own, chapter's, series' or dated `Defaults`) use their `bwThresholdAuto`
 			}
 			NumDistrClusters int
 		}
@@ -100,12 +115,19 @@ type Project struct {
 			BgBlur          int
 			CssFontFaces    map[string]string
 			SvgText         map[string]*PanelSvgTextGen
+			Trace           TraceOpts // for the SVG quali (`SizeHint` 0) and print books
+		}
+		Deskew DeskewOpts
+		Prep   struct {
+			MaxJobs  int
+			MaxMemMB int
 		}
 		GenLetteredPngsInDir string
 	}
 
 	defaultQualiIdx int
-	allPrepsDone    bool
+	allPrepsDone    bool       // guarded by the `appPrep` lock, see `prepAllDone`
+	dataMu          sync.Mutex // guards `data.Sv.ById` entries being added & saved concurrently during prep
 	data            struct {
 		Sv struct {
 			fileNamesToIds map[string]string
@@ -164,11 +186,32 @@ func (me *Project) textStr(lang string, key string) (s string) {
 	return s
 }
 
+// reviewed translations only, see also `percentDrafted`
 func (me *Project) percentTranslated(lang string, ser *Series, chap *Chapter, sheetVer *SheetVer, pgNr int) float64 {
 	if lang == "" || lang == App.Proj.Langs[0] {
 		return 100
 	}
-	numtotal, numtrans, allseries := 0, 0, me.Series
+	numtotal, numtrans, _ := me.numTranslated(lang, ser, chap, sheetVer, pgNr)
+	if numtotal == 0 {
+		return -1.0
+	}
+	return float64(numtrans) * (100.0 / float64(numtotal))
+}
+
+// unreviewed machine translations only, see also `percentTranslated`
+func (me *Project) percentDrafted(lang string, ser *Series, chap *Chapter, sheetVer *SheetVer, pgNr int) float64 {
+	if lang == "" || lang == App.Proj.Langs[0] {
+		return 0
+	}
+	numtotal, _, numdrafts := me.numTranslated(lang, ser, chap, sheetVer, pgNr)
+	if numtotal == 0 {
+		return -1.0
+	}
+	return float64(numdrafts) * (100.0 / float64(numtotal))
+}
+
+func (me *Project) numTranslated(lang string, ser *Series, chap *Chapter, sheetVer *SheetVer, pgNr int) (numTotal int, numReviewed int, numDrafts int) {
+	allseries := me.Series
 	if ser != nil {
 		allseries = []*Series{ser}
 	}
@@ -191,8 +234,12 @@ func (me *Project) percentTranslated(lang string, ser *Series, chap *Chapter, sh
 					for _, areas := range me.data.Sv.textRects[sv.ID] {
 						for _, area := range areas {
 							if def := trim(area.Data[me.Langs[0]]); def != "" {
-								if numtotal++; trim(area.Data[lang]) != "" {
-									numtrans++
+								if numTotal++; trim(area.Data[lang]) != "" {
+									if area.Drafts[lang] {
+										numDrafts++
+									} else {
+										numReviewed++
+									}
 								}
 							}
 						}
@@ -201,34 +248,43 @@ func (me *Project) percentTranslated(lang string, ser *Series, chap *Chapter, sh
 			}
 		}
 	}
-	if numtotal == 0 {
-		return -1.0
-	}
-	return float64(numtrans) * (100.0 / float64(numtotal))
+	return
 }
 
 func (me *Project) save(texts bool) {
-	if jsonSave("_data.json", &me.data); texts {
-		jsonSave("_txt.json", me.data.Sv.textRects)
+	me.dataMu.Lock()
+	defer me.dataMu.Unlock()
+	appPrep.Lock() // no prep job to start or finish until saved
+	defer appPrep.Unlock()
+	data := me.data
+	if committed := prepCommittedData(); len(committed) > 0 { // sheets mid-prep: their data from before, theirs-to-be getting saved once done
+		data.Sv.ById = make(map[string]*SheetVerData, len(me.data.Sv.ById))
+		for id, svdata := range me.data.Sv.ById {
+			if svdataold, busy := committed[id]; !busy {
+				data.Sv.ById[id] = svdata
+			} else if svdataold != nil {
+				data.Sv.ById[id] = svdataold
+			}
+		}
+	}
+	if storeSave(storeDataFileName, &data, storeBakDataMinAge); texts {
+		me.txtSave()
 	}
 }
 
 func (me *Project) load() (numSheetVers int) {
 	jsonLoad("cx.json", nil, me) // exits early if no such file, before creating work dirs:
+	App.Report.reset("load")
 	if me.Site.Title == "" {
 		me.Site.Title = me.Site.Host
 	}
 	mkDir(".ccache")
 	var dtdatajson time.Time
-	if fileinfo := fileStat("_data.json"); fileinfo != nil {
+	if fileinfo := fileStat(storeDataFileName); fileinfo != nil {
 		dtdatajson = fileinfo.ModTime()
-		jsonLoad("_data.json", nil, &me.data)
-	}
-	if fileStat("_txt.json") != nil {
-		jsonLoad("_txt.json", nil, &me.data.Sv.textRects)
-	} else {
-		me.data.Sv.textRects = map[string][][]ImgPanelArea{}
+		jsonLoad(storeDataFileName, nil, &me.data)
 	}
+	me.txtLoad()
 	me.data.Sv.fileNamesToIds = map[string]string{}
 	oldIdsToFileMeta := me.data.Sv.IdsToFileMeta
 	me.data.Sv.IdsToFileMeta = make(map[string]FileInfo, len(oldIdsToFileMeta))
@@ -295,7 +351,7 @@ func (me *Project) load() (numSheetVers int) {
 		}
 		if series.Author != "" {
 			if series.author = me.Authors[series.Author]; series.author == nil {
-				panic("unknown author: " + series.Author)
+				App.Report.add("load", series, "unknown author: "+series.Author)
 			}
 		}
 		seriesdirpath := "scans/" + series.Name
@@ -344,13 +400,13 @@ func (me *Project) load() (numSheetVers int) {
 				}
 			}
 
+			chap.parentSeries = series
 			if chap.Author == "" {
 				chap.author = series.author
 			} else if chap.author = me.Authors[chap.Author]; chap.author == nil {
-				panic("unknown author: " + chap.Author)
+				App.Report.add("load", chap, "unknown author: "+chap.Author)
 			}
 
-			chap.parentSeries = series
 			chapdirpath := filepath.Join(seriesdirpath, chap.Name)
 			if chap.UrlName == "" {
 				chap.UrlName = chap.Name
@@ -360,18 +416,20 @@ func (me *Project) load() (numSheetVers int) {
 			}
 			files, err := os.ReadDir(chapdirpath)
 			if err != nil {
-				panic(err)
+				App.Report.add("load", chap, err)
+				continue
 			}
 
 			var work = struct {
 				sync.WaitGroup
 				sync.Mutex
+				broken []*SheetVer
 			}{}
 			for _, f := range files {
-				if fnamebase := f.Name(); strings.HasSuffix(fnamebase, ".png") &&
-					!(f.IsDir() || strings.HasPrefix(fnamebase, "bw.") || strings.HasPrefix(fnamebase, "p.")) {
+				if fnamebase, fext := f.Name(), scanFileExt(f.Name()); fext != "" &&
+					!(f.IsDir() || strings.HasPrefix(fnamebase, "bw.") || strings.HasPrefix(fnamebase, "p.") || strings.HasPrefix(fnamebase, scanNormPrefix)) {
 					fname := filepath.Join(chapdirpath, fnamebase)
-					fnamebase = fnamebase[:len(fnamebase)-len(".png")]
+					fnamebase = fnamebase[:len(fnamebase)-len(filepath.Ext(fnamebase))] // not `fext`, as normalized (eg. ".tiff" to ".tif")
 					versionname := fnamebase[1+strings.LastIndexByte(fnamebase, '.'):]
 					t, _ := time.Parse("20060102", versionname)
 					dt := t.UnixNano()
@@ -383,7 +441,8 @@ func (me *Project) load() (numSheetVers int) {
 					}
 					sheetname := fnamebase[:strings.LastIndexByte(fnamebase, '.')]
 					if sheetname == "" {
-						panic("invalid sheet-file name: " + fname)
+						App.Report.add("load", chap, "invalid sheet-file name: "+fname)
+						continue
 					}
 
 					var sheet *Sheet
@@ -397,34 +456,44 @@ func (me *Project) load() (numSheetVers int) {
 						sheet = &Sheet{name: sheetname, parentChapter: chap}
 						chap.sheets = append(chap.sheets, sheet)
 					}
+					srcfname := fname // differs from the `FileName` only for non-PNG scans, see scanNormalized
+					if fext != ".png" {
+						fname = filepath.Join(chapdirpath, scanNormPrefix+fnamebase+".png")
+					}
 					sheetver := &SheetVer{DateTimeUnixNano: dt, parentSheet: sheet, FileName: fname}
 					sheet.versions = append([]*SheetVer{sheetver}, sheet.versions...)
 					numSheetVers++
 
 					fileinfo, err := f.Info()
 					if err != nil {
-						panic(err)
+						App.Report.add("load", sheetver, err)
+						work.broken = append(work.broken, sheetver)
+						continue
 					}
 					work.Add(1)
-					go func(sv *SheetVer, svfileinfo os.FileInfo) {
+					go func(sv *SheetVer, svfileinfo os.FileInfo, srcFileName string) {
 						defer work.Done()
+						defer App.Report.catch("load", sv, func() { work.Lock(); work.broken = append(work.broken, sv); work.Unlock() })
+						if srcFileName != sv.FileName {
+							scanNormalized(srcFileName, sv.FileName, svfileinfo)
+						}
 						if modtime := svfileinfo.ModTime().UnixNano(); modtime < dtdatajson.UnixNano() {
 							work.Lock()
 							for id, filemeta := range oldIdsToFileMeta {
-								if filemeta.FilePath == sv.FileName && filemeta.ModTime == modtime && filemeta.Size == svfileinfo.Size() {
+								if filemeta.FilePath == srcFileName && filemeta.ModTime == modtime && filemeta.Size == svfileinfo.Size() {
 									sv.ID = id
 									break
 								}
 							}
 							work.Unlock()
 						}
-						if sv.ID == "" {
-							data := fileRead(sv.FileName)
+						if sv.ID == "" { // always of the original scan file, so independent of how it got normalized
+							data := fileRead(srcFileName)
 							sv.ID = contentHashStr(data)
 						}
 						work.Lock()
 						me.data.Sv.fileNamesToIds[sv.FileName] = sv.ID
-						me.data.Sv.IdsToFileMeta[sv.ID] = FileInfo{sv.FileName, svfileinfo.ModTime().UnixNano(), svfileinfo.Size()}
+						me.data.Sv.IdsToFileMeta[sv.ID] = FileInfo{srcFileName, svfileinfo.ModTime().UnixNano(), svfileinfo.Size()}
 						work.Unlock()
 						if sv.Data = me.data.Sv.ById[sv.ID]; sv.Data != nil {
 							sv.Data.parentSheetVer = sv
@@ -434,36 +503,19 @@ func (me *Project) load() (numSheetVers int) {
 						if err := os.Symlink("../../../.ccache/"+svCacheDirNamePrefix+sv.ID, cachedirsymlinkpath); err != nil {
 							panic(err)
 						}
-					}(sheetver, fileinfo)
+					}(sheetver, fileinfo, srcfname)
 				}
 			}
 			work.Wait()
+			chap.removeSheetVers("load", work.broken...)
 
 			if len(chap.sheets) > 0 {
 				chap.ensureSheetsPerPage()
-				chap.versions = []int64{0}
-				for _, sheet := range chap.sheets {
-					for i, sheetver := range sheet.versions {
-						if i > 0 {
-							if len(chap.versions) <= i {
-								chap.versions = append(chap.versions, sheetver.DateTimeUnixNano)
-							} else if sheetver.DateTimeUnixNano < chap.versions[i] {
-								chap.versions[i] = sheetver.DateTimeUnixNano
-							}
-						} else {
-							if sheetver.DateTimeUnixNano > chap.verDtLatest.until {
-								chap.verDtLatest.until = sheetver.DateTimeUnixNano
-							}
-							if sheetver.DateTimeUnixNano < chap.verDtLatest.from || chap.verDtLatest.from == 0 {
-								chap.verDtLatest.from = sheetver.DateTimeUnixNano
-							}
-						}
-					}
-				}
+				chap.refreshVersions()
 				if sbPath := chap.storyboardFilePath(); fileStat(sbPath) != nil {
-					chap.loadStoryboard()
+					func() { defer App.Report.catch("load", chap, nil); chap.loadStoryboard() }()
 				} else if sbPath != "" {
-					panic(sbPath)
+					App.Report.add("load", chap, "storyboard not found: "+sbPath)
 				}
 			}
 		}
@@ -532,13 +584,19 @@ func (me *Project) scanYearLatest(skipPriv bool, lang string) (ret int) {
 	return
 }
 
-func (me *Project) bwThreshold(dtUnixNano int64) (ret uint8) {
+func (me *Project) bwThreshold(dtUnixNano int64) uint8 {
+	ret, _ := me.bwThresholdDated(dtUnixNano)
+	return ret
+}
+
+// also tells whether `ret` came from a dated `Sheets.Bw.Thresholds.Defaults` entry (rather than the "" one)
+func (me *Project) bwThresholdDated(dtUnixNano int64) (ret uint8, dated bool) {
 	if ret = me.Sheets.Bw.Thresholds.Defaults[""]; dtUnixNano > 0 {
 		var d int64
 		for k, v := range me.Sheets.Bw.Thresholds.Defaults {
 			if dt, _ := strconv.ParseInt(k, 0, 64); k != "" && dt != 0 {
 				if diff := dtUnixNano - dt; diff >= 0 && (diff <= d || d == 0) {
-					ret, d = v, diff
+					ret, d, dated = v, diff, true
 				}
 			}
 		}
@@ -26,6 +26,7 @@ type Series struct {
 	GenPanelSvgText *PanelSvgTextGen
 	Priv            bool
 	BwThreshold     uint8
+	Bw              *BwOpts
 
 	author  *Author
 	isStrip bool
@@ -48,6 +49,12 @@ type Chapter struct {
 	Priv             bool
 	HomePic          []interface{}
 	BwThreshold      uint8
+	Bw               *BwOpts
+	Gray             *GrayOpts  // if set, panel pics keep gray tones (see GrayOpts)
+	FullColor        bool       // sheets are colour scans or paintings: panel pics get cut from them as-is, b&w is only a mask
+	PanelsTraced     bool       // detect panels by their ink borders (see imgPanelsTraced) instead of by gutters
+	ScanProfile      string     // preselected in the scan form, by name in cx.json's `Scan.Profiles`
+	Inbox            *InboxOpts // if set, new images in its `Dir` get imported as sheet versions while the GUI runs
 
 	author       *Author
 	sheets       []*Sheet
@@ -304,6 +311,130 @@ func (me *Chapter) ensureSheetsPerPage() {
 	}
 }
 
+// (re)computes `versions` and `verDtLatest` from all sheets' versions
+func (me *Chapter) refreshVersions() {
+	me.versions, me.verDtLatest.from, me.verDtLatest.until = []int64{0}, 0, 0
+	for _, sheet := range me.sheets {
+		for i, sheetver := range sheet.versions {
+			if i > 0 {
+				if len(me.versions) <= i {
+					me.versions = append(me.versions, sheetver.DateTimeUnixNano)
+				} else if sheetver.DateTimeUnixNano < me.versions[i] {
+					me.versions[i] = sheetver.DateTimeUnixNano
+				}
+			} else {
+				if sheetver.DateTimeUnixNano > me.verDtLatest.until {
+					me.verDtLatest.until = sheetver.DateTimeUnixNano
+				}
+				if sheetver.DateTimeUnixNano < me.verDtLatest.from || me.verDtLatest.from == 0 {
+					me.verDtLatest.from = sheetver.DateTimeUnixNano
+				}
+			}
+		}
+	}
+}
+
+// adds the sheet version at `fileName` (a PNG freshly written into this chapter's scans dir) to
+// the already-loaded project just as `Project.load` would have picked it up, see inboxApply
+func (me *Chapter) addSheetVerFile(stage string, fileName string) *SheetVer {
+	fnamebase := strings.TrimSuffix(filepath.Base(fileName), ".png")
+	idx := strings.LastIndexByte(fnamebase, '.')
+	t, err := time.Parse("20060102", fnamebase[idx+1:])
+	if err != nil || idx <= 0 {
+		panic("invalid sheet-file name: " + fileName)
+	}
+	fileinfo := fileStat(fileName)
+	if fileinfo == nil {
+		panic("file not found: " + fileName)
+	}
+	var sheet *Sheet
+	sheetname, sheetidx := fnamebase[:idx], len(me.sheets)
+	for i, s := range me.sheets {
+		if s.name == sheetname {
+			sheet = s
+			break
+		} else if s.name > sheetname && sheetidx == len(me.sheets) {
+			sheetidx = i
+		}
+	}
+	if sheet == nil {
+		sheet = &Sheet{name: sheetname, parentChapter: me}
+		if len(me.SheetsPerPage) == 0 {
+			me.sheets = append(me.sheets[:sheetidx], append([]*Sheet{sheet}, me.sheets[sheetidx:]...)...)
+			me.ensureSheetsPerPage()
+		} else { // as in removeSheetVers, keeping the pagination: the new sheet joins the page of the one before it
+			pgidx, pgstart, previdx := 0, 0, max(0, sheetidx-1)
+			for ; pgidx < len(me.SheetsPerPage)-1 && previdx >= pgstart+me.SheetsPerPage[pgidx]; pgidx++ {
+				pgstart += me.SheetsPerPage[pgidx]
+			}
+			me.sheets = append(me.sheets[:sheetidx], append([]*Sheet{sheet}, me.sheets[sheetidx:]...)...)
+			me.SheetsPerPage[pgidx]++
+			App.Report.add(stage, sheet, "new sheet added to page "+itoa(1+pgidx)+", now of "+itoa(me.SheetsPerPage[pgidx])+" sheets")
+		}
+	}
+	sv := &SheetVer{DateTimeUnixNano: t.UnixNano(), parentSheet: sheet, FileName: fileName, ID: contentHashStr(fileRead(fileName))}
+	for _, existing := range sheet.versions {
+		if existing.DateTimeUnixNano == sv.DateTimeUnixNano {
+			panic("sheet version already loaded: " + existing.FileName)
+		}
+	}
+	App.Proj.dataMu.Lock()
+	App.Proj.data.Sv.fileNamesToIds[sv.FileName] = sv.ID
+	App.Proj.data.Sv.IdsToFileMeta[sv.ID] = FileInfo{sv.FileName, fileinfo.ModTime().UnixNano(), fileinfo.Size()}
+	if sv.Data = App.Proj.data.Sv.ById[sv.ID]; sv.Data != nil {
+		sv.Data.parentSheetVer = sv
+	}
+	App.Proj.dataMu.Unlock()
+	cachedirsymlinkpath := sv.FileName[:len(sv.FileName)-len(".png")]
+	_ = os.Remove(cachedirsymlinkpath)
+	if err := os.Symlink("../../../.ccache/"+svCacheDirNamePrefix+sv.ID, cachedirsymlinkpath); err != nil {
+		panic(err)
+	}
+	versions := append([]*SheetVer{sv}, sheet.versions...) // newest first
+	for i := 1; i < len(versions) && versions[i].DateTimeUnixNano > sv.DateTimeUnixNano; i++ {
+		versions[i-1], versions[i] = versions[i], versions[i-1]
+	}
+	sheet.versions = versions
+	me.refreshVersions()
+	return sv
+}
+
+// drops the specified (broken) sheet versions, then any sheets left without versions: a set
+// `SheetsPerPage` is kept, just with those sheets taken off their pages (reported under `stage`)
+func (me *Chapter) removeSheetVers(stage string, svs ...*SheetVer) {
+	if len(svs) == 0 {
+		return
+	}
+	var sheets []*Sheet
+	sheetsperpage := append([]int{}, me.SheetsPerPage...)
+	for i, pgidx, pgstart := 0, 0, 0; i < len(me.sheets); i++ {
+		for ; pgidx < len(sheetsperpage) && i >= pgstart+me.SheetsPerPage[pgidx]; pgidx++ {
+			pgstart += me.SheetsPerPage[pgidx]
+		}
+		sheet := me.sheets[i]
+		var versions []*SheetVer
+		for _, sv := range sheet.versions {
+			if indexOf(svs, sv) < 0 {
+				versions = append(versions, sv)
+			}
+		}
+		if sheet.versions = versions; len(versions) > 0 {
+			sheets = append(sheets, sheet)
+		} else if pgidx < len(sheetsperpage) {
+			sheetsperpage[pgidx]--
+			App.Report.add(stage, sheet, "sheet left out of page "+itoa(1+pgidx)+" for lack of usable versions")
+		}
+	}
+	if me.sheets = sheets; len(me.SheetsPerPage) > 0 {
+		me.SheetsPerPage = nil
+		for _, n := range sheetsperpage {
+			if n > 0 {
+				me.SheetsPerPage = append(me.SheetsPerPage, n)
+			}
+		}
+	}
+}
+
 func (me *Chapter) readDurationMinutes() int {
 	return len(me.sheets) / 2
 }
@@ -343,6 +474,9 @@ func (me *Chapter) hasBgCol() bool {
 }
 
 func (me *Chapter) percentColorized() float64 {
+	if me.FullColor {
+		return 100.0
+	}
 	numsv, numbg := 0, 0
 	for _, sheet := range me.sheets {
 		for _, sv := range sheet.versions {
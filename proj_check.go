@@ -0,0 +1,100 @@
+package main
+
+import (
+	"image"
+)
+
+// the `check` action: validates cx.json, _data.json and _txt.json against each
+// other and against scans/ (without any prepping), findings go into `App.Report`
+func projCheck(flags map[string]bool) {
+	App.Report.reset("check")
+	var numfindings int
+	finding := func(at Any, msg string) {
+		numfindings++
+		App.Report.add("check", at, msg)
+	}
+
+	timedLogged("Checking project...", func() string {
+		for _, svid := range sortedMapKeys(App.Proj.data.Sv.textRects) {
+			if _, exists := App.Proj.data.Sv.IdsToFileMeta[svid]; !exists {
+				finding(nil, "expired hash-ID in _txt.json: "+svid)
+			}
+		}
+
+		for i, bookpub := range App.Proj.Books.Pubs {
+			for _, seriesname := range bookpub.Series {
+				if App.Proj.seriesByName(seriesname) == nil {
+					finding(nil, "Books.Pubs["+itoa(i)+"] ('"+bookpub.Title+"') names unknown series: "+seriesname)
+				}
+			}
+		}
+
+		for _, series := range App.Proj.Series {
+			for _, chapter := range series.Chapters {
+				if chapter.ScanProfile != "" && App.Proj.Scan.Profiles[chapter.ScanProfile] == nil {
+					finding(chapter, "ScanProfile names unknown profile: "+chapter.ScanProfile)
+				}
+				if len(chapter.sheets) == 0 {
+					continue
+				}
+				var sum int
+				for _, n := range chapter.SheetsPerPage {
+					sum += n
+				}
+				if sum != len(chapter.sheets) {
+					finding(chapter, "SheetsPerPage sum is "+itoa(sum)+" but chapter has "+itoa(len(chapter.sheets))+" sheets")
+				}
+
+				if len(chapter.HomePic) > 0 {
+					idxsheet, ok0 := chapter.HomePic[0].(float64)
+					var idxpanel float64
+					var ok1 bool
+					if len(chapter.HomePic) > 1 {
+						idxpanel, ok1 = chapter.HomePic[1].(float64)
+					}
+					if !(ok0 && ok1) {
+						finding(chapter, "HomePic needs a sheet index and a panel index: "+toJsonStr(chapter.HomePic))
+					} else if int(idxsheet) < 0 || int(idxsheet) >= len(chapter.sheets) {
+						finding(chapter, "HomePic points to missing sheet #"+itoa(int(idxsheet)))
+					} else if numpanels, _ := chapter.sheets[int(idxsheet)].versions[0].panelCount(); int(idxpanel) < 0 || (numpanels > 0 && int(idxpanel) >= numpanels) {
+						finding(chapter, "HomePic points to missing panel #"+itoa(int(idxpanel))+" of sheet '"+chapter.sheets[int(idxsheet)].name+"'")
+					}
+				}
+
+				for _, sheet := range chapter.sheets {
+					for _, sv := range sheet.versions {
+						projCheckSheetVerTextRects(sv, finding)
+					}
+				}
+			}
+		}
+		return "for " + itoa(numfindings) + " finding(s)"
+	})
+}
+
+func projCheckSheetVerTextRects(sv *SheetVer, finding func(Any, string)) {
+	if sv.Data == nil || sv.Data.PanelsTree == nil {
+		return // not yet prepped, so nothing to check against
+	}
+	var panels []image.Rectangle
+	sv.Data.PanelsTree.each(func(panel *ImgPanel) {
+		panels = append(panels, panel.Rect)
+	})
+	for pidx, areas := range App.Proj.data.Sv.textRects[sv.ID] {
+		if pidx >= len(panels) && len(areas) > 0 {
+			finding(sv, "text areas for panel #"+itoa(pidx+1)+" but sheet has only "+itoa(len(panels))+" panels")
+			continue
+		}
+		for _, area := range areas {
+			var inpanel bool
+			for _, rect := range panels {
+				if inpanel = area.Rect.Overlaps(rect); inpanel {
+					break
+				}
+			}
+			if !inpanel {
+				finding(sv, "text area "+area.Rect.String()+" (panel #"+itoa(pidx+1)+") lies outside every panel")
+			}
+		}
+	}
+}
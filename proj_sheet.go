@@ -8,11 +8,14 @@ import (
 	"image/color"
 	"image/draw"
 	_ "image/png"
+	"io"
+	"maps"
 	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -54,19 +57,37 @@ type SheetVerData struct {
 	DirPath         string `json:",omitempty"`
 	BwFilePath      string `json:",omitempty"`
 	BwSmallFilePath string `json:",omitempty"`
+	GrayFilePath    string `json:",omitempty"` // only for sheets of `Chapter.Gray` chapters
 	hasBgCol        string
 
 	PxCm               float64
 	BwThreshold        uint8     `json:",omitempty"`
 	FontFactor         float64   `json:",omitempty"`
 	GrayDistr          []int     `json:",omitempty"`
+	GrayHist           []int     `json:",omitempty"` // all 256 gray levels, for `bwThresholdAuto`
 	ColDarkestLightest []uint8   `json:",omitempty"`
 	PanelsTree         *ImgPanel `json:",omitempty"`
+	PanelsTreePinned   bool      `json:",omitempty"` // manually edited in the sheet editor, so never re-detected
 	HomePic            string    `json:",omitempty"`
+	Scan               *ScanInfo `json:",omitempty"` // how it was scanned, if via the scan queue
 }
 
 func (me *SheetVerData) PicDirPath(qualiSizeHint int) string {
-	return filepath.Join(me.DirPath, "__panels__"+itoa(int(me.parentSheetVer.bwThreshold()))+"_"+ftoa(App.Proj.Sheets.Panel.BorderCm, -1)+"_"+itoa(qualiSizeHint))
+	return filepath.Join(me.DirPath, "__panels__"+me.parentSheetVer.bwKey()+me.parentSheetVer.grayKey()+sIf(qualiSizeHint == 0, App.Proj.Sheets.Panel.Trace.cacheKey(), "")+"_"+ftoa(App.Proj.Sheets.Panel.BorderCm, -1)+"_"+itoa(qualiSizeHint))
+}
+
+// a copy unaffected by the (re)prepping or editing of `me` (which may be `nil`)
+func (me *SheetVerData) cloned() *SheetVerData {
+	if me == nil {
+		return nil
+	}
+	ret := *me
+	ret.GrayDistr, ret.GrayHist, ret.ColDarkestLightest = slices.Clone(me.GrayDistr), slices.Clone(me.GrayHist), slices.Clone(me.ColDarkestLightest)
+	if me.PanelsTree != nil {
+		panelstree := me.PanelsTree.cloned()
+		ret.PanelsTree = &panelstree
+	}
+	return &ret
 }
 
 type SheetVer struct {
@@ -79,15 +100,126 @@ type SheetVer struct {
 		sync.Mutex
 		done bool
 	}
+	textAreaSuggs struct {
+		sync.Mutex
+		bwFilePath string
+		panels     [][]image.Rectangle
+	}
+	textCarryCache struct {
+		sync.Mutex
+		key    string
+		result *SheetVerTextCarry
+	}
+}
+
+// the lettering of an older version of the same sheet, mapped onto this one
+type SheetVerTextCarry struct {
+	From  *SheetVer
+	Xform ImgXform         // from `From`'s to this version's full-size b&w pixel coords
+	Score float64          // 0..1: how much of `From`'s ink lands on this version's ink once transformed
+	Areas [][]ImgPanelArea // by this version's panel indices
+	Flags [][]string       // same shape as `Areas`: if non-empty, why that area needs double-checking
 }
 
 func (me *SheetVer) bwThreshold() uint8 {
 	if me.Data.BwThreshold != 0 {
 		return me.Data.BwThreshold
 	}
+	chap := me.parentSheet.parentChapter
+	if _, dated := App.Proj.bwThresholdDated(me.DateTimeUnixNano); App.Proj.Sheets.Bw.Thresholds.Auto && !dated && // dated defaults pin down past scan sessions' thresholds
+		chap.BwThreshold == 0 && chap.parentSeries.BwThreshold == 0 {
+		if auto := me.bwThresholdAuto(); auto != 0 {
+			return auto
+		}
+	}
 	return me.parentSheet.bwThreshold(me.DateTimeUnixNano)
 }
 
+func (me *SheetVer) bwPng(srcImgData io.Reader, onDecoded func() error, blackIfLessThan uint8) []byte {
+	opts := me.bwOpts()
+	if me.parentSheet.parentChapter.FullColor {
+		srcimg, _, err := image.Decode(srcImgData)
+		if onDecoded != nil {
+			_ = onDecoded()
+		}
+		if err != nil {
+			panic(err)
+		}
+		img := imgColorMask(srcimg, blackIfLessThan, 48)
+		if opts != nil && opts.DespecklePx > 0 {
+			imgBwDespeckle(img, opts.DespecklePx)
+		}
+		return pngEncode(img)
+	} else if opts == nil {
+		return imgToMonochromePng(srcImgData, onDecoded, blackIfLessThan)
+	}
+	img := imgToMonochrome(srcImgData, onDecoded, 0)
+	opts.apply(img, blackIfLessThan, me.Data.PxCm)
+	return pngEncode(img)
+}
+
+// the chapter's, else the series', if any
+func (me *SheetVer) bwOpts() *BwOpts {
+	if chap := me.parentSheet.parentChapter; chap.Bw != nil {
+		return chap.Bw
+	}
+	return me.parentSheet.parentChapter.parentSeries.Bw
+}
+
+// identifies the b&w conversion in the names of its cached outputs
+func (me *SheetVer) bwKey() string {
+	return itoa(int(me.bwThreshold())) + me.bwOpts().cacheKey() + sIf(me.parentSheet.parentChapter.FullColor, ".col", "")
+}
+
+// identifies the gray master in the names of its cached outputs, empty if not in gray mode
+func (me *SheetVer) grayKey() string {
+	opts := me.parentSheet.parentChapter.Gray
+	if opts == nil || me.parentSheet.parentChapter.FullColor {
+		return ""
+	}
+	blackpt, whitept := me.grayPoints()
+	return ".g" + itoa(opts.levels()) + "-" + itoa(int(blackpt)) + "-" + itoa(int(whitept))
+}
+
+// the gray master's black & white points: as configured, else from the gray histogram
+func (me *SheetVer) grayPoints() (blackPt uint8, whitePt uint8) {
+	opts := me.parentSheet.parentChapter.Gray
+	if blackPt, whitePt = opts.BlackPoint, opts.WhitePoint; blackPt == 0 && len(me.Data.ColDarkestLightest) == 2 {
+		blackPt = me.Data.ColDarkestLightest[0]
+	}
+	if whitePt == 0 {
+		whitePt = 255
+		if len(me.Data.GrayHist) == 256 {
+			peak := int(me.bwThreshold())
+			for i := peak; i < 256; i++ {
+				if me.Data.GrayHist[i] > me.Data.GrayHist[peak] {
+					peak = i
+				}
+			}
+			whitePt = uint8(max(int(me.bwThreshold())+1, peak-8))
+		}
+	}
+	return
+}
+
+// the sheet image that panel pics & home pics get cut from
+func (me *SheetVer) picSrcFilePath() string {
+	if me.parentSheet.parentChapter.FullColor {
+		return me.FileName
+	} else if me.Data.GrayFilePath != "" {
+		return me.Data.GrayFilePath
+	}
+	return me.Data.BwFilePath
+}
+
+// the threshold proposed by this sheet's own gray histogram, or 0 if not yet known
+func (me *SheetVer) bwThresholdAuto() uint8 {
+	if me.Data == nil || len(me.Data.GrayHist) != 256 {
+		return 0
+	}
+	return imgGrayHistThreshold(me.Data.GrayHist)
+}
+
 func (me *SheetVer) DtName() string {
 	return strconv.FormatInt(me.DateTimeUnixNano, 10)
 }
@@ -112,31 +244,45 @@ func (me *SheetVer) ensurePrep(fromBgPrep bool, forceFullRedo bool) (didWork boo
 	shouldsaveprojdata := forceFullRedo
 	if me.Data == nil {
 		shouldsaveprojdata = true
-		me.Data = &SheetVerData{parentSheetVer: me, PxCm: dpi1200} //1200dpi
-		{
-			pngdata := fileRead(me.FileName)
-			if img, _, err := image.Decode(bytes.NewReader(pngdata)); err != nil {
-				panic(err)
-			} else if w := img.Bounds().Max.X; w < 10000 {
-				me.Data.PxCm *= 0.5 //600dpi
-			}
-		}
+		me.Data = &SheetVerData{parentSheetVer: me}
+		App.Proj.dataMu.Lock()
 		App.Proj.data.Sv.ById[me.ID] = me.Data
+		App.Proj.dataMu.Unlock()
+	}
+	if me.Data.PxCm == 0 { // else known from its `Scan` record
+		me.Data.PxCm = dpi1200 //1200dpi
+		pngdata := fileRead(me.FileName)
+		if img, _, err := image.Decode(bytes.NewReader(pngdata)); err != nil {
+			panic(err)
+		} else if w := img.Bounds().Max.X; w < 10000 {
+			me.Data.PxCm *= 0.5 //600dpi
+		}
 	}
 	me.Data.DirPath = ".ccache/" + svCacheDirNamePrefix + me.ID
-	me.Data.BwFilePath = filepath.Join(me.Data.DirPath, "bw."+itoa(int(me.bwThreshold()))+".png")
-	me.Data.BwSmallFilePath = filepath.Join(me.Data.DirPath, "bwsmall."+itoa(int(me.bwThreshold()))+"."+itoa(int(App.Proj.Sheets.Bw.SmallWidth))+".png")
+	// the gray histogram comes first, as it may decide the b&w threshold
+	prepStage(me, "graydistr")
+	didgraydistr := me.ensureGrayDistr(forceFullRedo || len(me.Data.GrayDistr) == 0)
+	me.Data.BwFilePath = filepath.Join(me.Data.DirPath, "bw."+me.bwKey()+".png")
+	me.Data.BwSmallFilePath = filepath.Join(me.Data.DirPath, "bwsmall."+me.bwKey()+"."+itoa(int(App.Proj.Sheets.Bw.SmallWidth))+".png")
+	if me.Data.GrayFilePath = ""; me.grayKey() != "" {
+		me.Data.GrayFilePath = filepath.Join(me.Data.DirPath, "gray"+me.grayKey()+".png")
+	}
 	mkDir(me.Data.DirPath)
 
 	// the major prep steps
-	didgraydistr := me.ensureGrayDistr(forceFullRedo || len(me.Data.GrayDistr) == 0)
+	prepStage(me, "bw")
 	didbw, didbwsmall := me.ensureBwSheetPngs(forceFullRedo)
+	prepStage(me, "panels")
 	didpanels := me.ensurePanelsTree(me.Data.PanelsTree == nil || forceFullRedo || didbw)
+	prepStage(me, "panelpics")
 	didpanelpics := me.ensurePanelPics(forceFullRedo || didpanels)
+	prepStage(me, "homepic")
 	didhomepic := me.ensureHomePic(forceFullRedo || didbw || didbwsmall || didpanels)
+	prepStage(me, "strips")
 	didstrips := me.parentSheet.parentChapter.isStrip && me.ensureStrips(forceFullRedo || didbw || didpanels || didpanelpics)
 
-	if shouldsaveprojdata = shouldsaveprojdata || didgraydistr || didpanels || didhomepic || didstrips; shouldsaveprojdata {
+	// from the bg prep (ie. `prepRun`), saving is left to the caller once this sheet is done
+	if shouldsaveprojdata = shouldsaveprojdata || didgraydistr || didpanels || didhomepic || didstrips; shouldsaveprojdata && !fromBgPrep {
 		App.Proj.save(false)
 	}
 	if didWork = shouldsaveprojdata || didbw || didbwsmall || didpanelpics || didstrips; didWork {
@@ -159,7 +305,7 @@ func (me *SheetVer) ensureBwSheetPngs(force bool) (didBw bool, didBwSmall bool)
 			if file, err := os.Open(me.FileName); err != nil {
 				panic(err)
 			} else {
-				fileWrite(me.Data.BwFilePath, imgToMonochromePng(file, file.Close, me.bwThreshold()))
+				fileWrite(me.Data.BwFilePath, me.bwPng(file, file.Close, me.bwThreshold()))
 			}
 		}
 		if file, err := os.Open(me.Data.BwFilePath); err != nil {
@@ -171,6 +317,17 @@ func (me *SheetVer) ensureBwSheetPngs(force bool) (didBw bool, didBwSmall bool)
 		}
 	}
 
+	if me.Data.GrayFilePath != "" && (didBw || fileStat(me.Data.GrayFilePath) == nil) {
+		if file, err := os.Open(me.FileName); err != nil {
+			panic(err)
+		} else {
+			img := imgToMonochrome(file, file.Close, 0)
+			blackpt, whitept := me.grayPoints()
+			imgGrayMaster(img, blackpt, whitept, me.parentSheet.parentChapter.Gray.levels())
+			fileWrite(me.Data.GrayFilePath, pngEncode(img))
+		}
+	}
+
 	if symlinkpath := filepath.Join(filepath.Dir(me.FileName), "bw."+filepath.Base(me.FileName)); didBw || fileStat(symlinkpath) == nil {
 		_ = os.Remove(symlinkpath)
 		fileLink(me.Data.BwFilePath, symlinkpath)
@@ -329,7 +486,7 @@ func (me *SheetVer) ensurePanelPics(force bool) bool {
 			mkDir(me.Data.PicDirPath(quali.SizeHint))
 		}
 	}
-	srcimgfile, err := os.Open(me.Data.BwFilePath)
+	srcimgfile, err := os.Open(me.picSrcFilePath())
 	if err != nil {
 		panic(err)
 	}
@@ -338,6 +495,14 @@ func (me *SheetVer) ensurePanelPics(force bool) bool {
 		panic(err)
 	}
 	_ = srcimgfile.Close()
+	var imggray *image.Gray // only full-colour sheets' sources go down the colour path, our gray & b&w masters may well decode as paletted or 16-bit gray
+	if !me.parentSheet.parentChapter.FullColor {
+		imggray = imgToGray(imgsrc)
+	}
+	graylevels := 0
+	if me.Data.GrayFilePath != "" {
+		graylevels = me.parentSheet.parentChapter.Gray.levels()
+	}
 
 	var pidx int
 	var work sync.WaitGroup
@@ -355,15 +520,27 @@ func (me *SheetVer) ensurePanelPics(force bool) bool {
 				w, h := int(width), int(height)
 				px1cm := me.Data.PxCm / (float64(sw) / float64(quali.SizeHint))
 				var wassamesize bool
-				pngdata := imgSubRectPng(imgsrc.(*image.Gray), panel.Rect, &w, &h, int(px1cm*App.Proj.Sheets.Panel.BorderCm), true, &wassamesize)
+				var img image.Image
+				if imggray != nil {
+					img = imgSubRect(imggray, panel.Rect, &w, &h, int(px1cm*App.Proj.Sheets.Panel.BorderCm), true, &wassamesize)
+					imgPosterize(img, graylevels)
+				} else { // full-colour
+					img = imgSubRectColor(imgsrc, panel.Rect, &w, &h, int(px1cm*App.Proj.Sheets.Panel.BorderCm), &wassamesize)
+				}
+				pngdata := pngEncode(img)
 				fileWrite(filepath.Join(me.Data.PicDirPath(quali.SizeHint), itoa(pidx)+".png"), pngdata)
 				if wassamesize {
 					break
 				}
 			}
 			if App.Proj.hasSvgQuali() {
-				fileWrite(filepath.Join(me.Data.PicDirPath(0), itoa(pidx)+".svg"),
-					imgSubRectSvg(imgsrc.(*image.Gray), panel.Rect, int(me.Data.PxCm*App.Proj.Sheets.Panel.BorderCm)))
+				var svg []byte
+				if imggray != nil && graylevels == 0 {
+					svg = imgSubRectSvg(imggray, panel.Rect, int(me.Data.PxCm*App.Proj.Sheets.Panel.BorderCm))
+				} else { // tones & colours can't be traced, so the full-res panel gets embedded instead
+					svg = imgSubRectSvgEmbed(imgsrc, panel.Rect, int(me.Data.PxCm*App.Proj.Sheets.Panel.BorderCm))
+				}
+				fileWrite(filepath.Join(me.Data.PicDirPath(0), itoa(pidx)+".svg"), svg)
 			}
 		}(pidx)
 		pidx++
@@ -436,11 +613,11 @@ func (me *SheetVer) ensureStrips(force bool) bool {
 }
 
 func (me *SheetVer) ensureGrayDistr(force bool) bool {
-	if force || len(me.Data.GrayDistr) != App.Proj.Sheets.Bw.NumDistrClusters || len(me.Data.ColDarkestLightest) != 2 {
+	if force || len(me.Data.GrayDistr) != App.Proj.Sheets.Bw.NumDistrClusters || len(me.Data.ColDarkestLightest) != 2 || len(me.Data.GrayHist) != 256 {
 		if file, err := os.Open(me.FileName); err != nil {
 			panic(err)
 		} else {
-			me.Data.GrayDistr, me.Data.ColDarkestLightest = imgGrayDistrs(file, file.Close, App.Proj.Sheets.Bw.NumDistrClusters)
+			me.Data.GrayDistr, me.Data.ColDarkestLightest, me.Data.GrayHist = imgGrayDistrs(file, file.Close, App.Proj.Sheets.Bw.NumDistrClusters)
 		}
 		return true
 	}
@@ -456,14 +633,14 @@ func (me *SheetVer) ensureHomePic(force bool) (didHomePic bool) {
 			}
 			me.Data.HomePic = picpath
 			fileWrite(picpath,
-				imgSubRectPngFile(me.Data.BwFilePath, me.panel(pidx).Rect, 0, App.Proj.Site.Gen.HomePicSizeHint, false))
+				imgSubRectPngFile(me.picSrcFilePath(), me.panel(pidx).Rect, 0, App.Proj.Site.Gen.HomePicSizeHint, false))
 		}
 	}
 	return
 }
 
 func (me *SheetVer) homePicPath(panelIdx int) string {
-	return me.Data.BwFilePath + ".homepic_" + itoa(panelIdx) + "_" + itoa(App.Proj.Site.Gen.HomePicSizeHint) + ".png"
+	return filepath.Join(me.Data.DirPath, filepath.Base(me.picSrcFilePath())) + ".homepic_" + itoa(panelIdx) + "_" + itoa(App.Proj.Site.Gen.HomePicSizeHint) + ".png"
 }
 
 func (me *SheetVer) sizeCm() (float64, float64) {
@@ -529,19 +706,25 @@ func (me *SheetVer) ensurePanelsTree(force bool) (did bool) {
 	bgtmplsvgfilepath := filepath.Join(me.Data.DirPath, bgtmplsvgfilename)
 	detectFromSb := (me.DtStr() > App.Proj.Sheets.Panel.TreeFromStoryboard.After) &&
 		(me.parentSheet.parentChapter.storyboardFilePath() != "")
-	if did = force || (os.Getenv("FORCE_PTREE") == me.parentSheet.parentChapter.Name) || me.Data.PanelsTree == nil ||
+	traced := me.parentSheet.parentChapter.PanelsTraced && !detectFromSb
+	pinned := me.Data.PanelsTreePinned && me.Data.PanelsTree != nil
+	if did = force || me.Data.PanelsTree == nil || (!pinned && ((os.Getenv("FORCE_PTREE") == me.parentSheet.parentChapter.Name) ||
+		(me.Data.PanelsTree.Traced != traced) ||
 		(me.Data.PanelsTree.SbBorderOuter != iIf(detectFromSb, App.Proj.Sheets.Panel.TreeFromStoryboard.BorderOuter, 0)) ||
-		(me.Data.PanelsTree.SbBorderInner != iIf(detectFromSb, App.Proj.Sheets.Panel.TreeFromStoryboard.BorderInner, 0)); did {
+		(me.Data.PanelsTree.SbBorderInner != iIf(detectFromSb, App.Proj.Sheets.Panel.TreeFromStoryboard.BorderInner, 0)))); did {
 		_ = os.Remove(bgtmplsvgfilepath)
-		if detectFromSb {
+		if pinned { // keep the manual edit as-is, only the below bg template gets re-gen'd
+		} else if detectFromSb {
 			me.Data.PanelsTree = me.parentSheet.parentChapter.panelsTreeFromStoryboard(me)
 		} else if file, err := os.Open(me.Data.BwFilePath); err != nil {
 			panic(err)
 		} else {
-			me.Data.PanelsTree = imgPanelsFile(file, file.Close)
+			me.Data.PanelsTree = imgPanelsFile(file, file.Close, traced)
+		}
+		if !pinned {
+			me.Data.PanelsTree.SbBorderOuter = iIf(detectFromSb, App.Proj.Sheets.Panel.TreeFromStoryboard.BorderOuter, 0)
+			me.Data.PanelsTree.SbBorderInner = iIf(detectFromSb, App.Proj.Sheets.Panel.TreeFromStoryboard.BorderInner, 0)
 		}
-		me.Data.PanelsTree.SbBorderOuter = iIf(detectFromSb, App.Proj.Sheets.Panel.TreeFromStoryboard.BorderOuter, 0)
-		me.Data.PanelsTree.SbBorderInner = iIf(detectFromSb, App.Proj.Sheets.Panel.TreeFromStoryboard.BorderInner, 0)
 	} else if os.Getenv("REDO_BGS") != "" {
 		_ = os.Remove(bgtmplsvgfilepath)
 	}
@@ -584,6 +767,53 @@ func (me *SheetVer) ensurePanelsTree(force bool) (did bool) {
 	return
 }
 
+// applies a manual panels-tree edit and pins the result against re-detection (or, if
+// `edit` is nil, un-pins and re-detects), then moves all text areas to their now-covering
+// panels and re-gens everything depending on the panels (bg template, panel pics, home pic, strips)
+func (me *SheetVer) editPanelsTree(edit func(root *ImgPanel) bool) {
+	me.prep.Lock()
+	defer me.prep.Unlock()
+	if edit != nil && !edit(me.Data.PanelsTree) {
+		return
+	} else if me.Data.PanelsTreePinned = (edit != nil); edit != nil {
+		me.Data.PanelsTree.flattenSubs()
+	}
+	_ = me.ensurePanelsTree(true)
+
+	if oldareas := App.Proj.data.Sv.textRects[me.ID]; len(oldareas) > 0 {
+		var numpanels int
+		me.Data.PanelsTree.each(func(*ImgPanel) { numpanels++ })
+		newareas := make([][]ImgPanelArea, numpanels)
+		for pidx, areas := range oldareas {
+			for _, area := range areas {
+				idx := -1
+				if !area.Rect.Empty() {
+					_, idx = me.panelMostCoveredBy(area.Rect)
+				}
+				if idx < 0 {
+					idx = min(pidx, numpanels-1)
+				}
+				newareas[idx] = append(newareas[idx], area)
+			}
+		}
+		App.Proj.data.Sv.textRects[me.ID] = newareas
+	}
+	App.Proj.txtJournalPanels(me.ID, me.Data.PanelsTree, me.Data.PanelsTreePinned)
+
+	me.textAreaSuggs.Lock()
+	me.textAreaSuggs.bwFilePath, me.textAreaSuggs.panels = "", nil
+	me.textAreaSuggs.Unlock()
+	me.textCarryCache.Lock()
+	me.textCarryCache.key, me.textCarryCache.result = "", nil
+	me.textCarryCache.Unlock()
+	_ = me.ensurePanelPics(true)
+	_ = me.ensureHomePic(true)
+	if me.parentSheet.parentChapter.isStrip {
+		_ = me.ensureStrips(true)
+	}
+	App.Proj.save(true)
+}
+
 func (me *SheetVer) panelAreas(panelIdx int) []ImgPanelArea {
 	if all := App.Proj.data.Sv.textRects[me.ID]; len(all) > panelIdx {
 		return all[panelIdx]
@@ -591,6 +821,150 @@ func (me *SheetVer) panelAreas(panelIdx int) []ImgPanelArea {
 	return nil
 }
 
+// the most recent older version of the same sheet that has any text areas
+func (me *SheetVer) textCarrySource() *SheetVer {
+	for _, sv := range me.parentSheet.versions {
+		if sv != me && sv.DateTimeUnixNano < me.DateTimeUnixNano && sv.Data != nil && sv.Data.PanelsTree != nil {
+			if _, numareas := sv.panelCount(); numareas > 0 {
+				return sv
+			}
+		}
+	}
+	return nil
+}
+
+// for a (re)scan without any text areas yet: the lettering of `textCarrySource()` registered
+// onto this version (via their small b&w images), to be reviewed and then accepted or not
+func (me *SheetVer) textCarry() *SheetVerTextCarry {
+	if _, numareas := me.panelCount(); numareas > 0 {
+		return nil
+	}
+	src := me.textCarrySource()
+	if src == nil {
+		return nil
+	}
+	me.textCarryCache.Lock()
+	defer me.textCarryCache.Unlock()
+	if key := src.ID + ":" + src.Data.BwSmallFilePath + ":" + me.Data.BwSmallFilePath + ":" + me.Data.PanelsTree.Rect.String(); key != me.textCarryCache.key {
+		me.textCarryCache.key, me.textCarryCache.result = key, nil
+		func() { // a missing or undecodable bw file (of either version) gets reported, not carried
+			defer App.Report.catch("textcarry", me, nil)
+			me.textCarryCache.result = me.textCarryFrom(src)
+		}()
+	}
+	return me.textCarryCache.result
+}
+
+func (me *SheetVer) textCarryFrom(src *SheetVer) *SheetVerTextCarry {
+	loadbw := func(sv *SheetVer) *image.Gray {
+		file, err := os.Open(sv.Data.BwSmallFilePath)
+		if err != nil {
+			panic(err)
+		}
+		return imgToMonochrome(file, file.Close, 128)
+	}
+	srcbw, dstbw := loadbw(src), loadbw(me)
+	xform, score := imgRegister(srcbw, dstbw)
+	ret := SheetVerTextCarry{From: src, Score: score, Xform: xform.rescaled(
+		float64(srcbw.Rect.Dx())/float64(src.Data.PanelsTree.Rect.Dx()),
+		float64(dstbw.Rect.Dx())/float64(me.Data.PanelsTree.Rect.Dx()))}
+
+	var srcpanels []*ImgPanel
+	src.Data.PanelsTree.each(func(p *ImgPanel) { srcpanels = append(srcpanels, p) })
+	var dstpanels []*ImgPanel
+	me.Data.PanelsTree.each(func(p *ImgPanel) { dstpanels = append(dstpanels, p) })
+	ret.Areas, ret.Flags = make([][]ImgPanelArea, len(dstpanels)), make([][]string, len(dstpanels))
+	tolerance := 0.5 * me.Data.PxCm // how far a panel may have "moved" (beyond the registration) before flagging its areas
+	for pidx, areas := range App.Proj.data.Sv.textRects[src.ID] {
+		for _, area := range areas {
+			area.Data, area.Drafts = maps.Clone(area.Data), maps.Clone(area.Drafts)
+			area.Rect = ret.Xform.applyRect(area.Rect)
+			if area.PointTo != nil && (area.PointTo.X != 0 || area.PointTo.Y != 0) {
+				pt := ret.Xform.applyPt(*area.PointTo)
+				area.PointTo = &pt
+			}
+			var flag string
+			dstpanel, dstpidx := me.panelMostCoveredBy(area.Rect)
+			if dstpidx < 0 {
+				dstpidx, flag = min(pidx, len(dstpanels)-1), "not on any panel"
+			} else if pidx < len(srcpanels) {
+				expected := ret.Xform.applyRect(srcpanels[pidx].Rect)
+				if dist := math.Max(
+					math.Max(math.Abs(float64(expected.Min.X-dstpanel.Rect.Min.X)), math.Abs(float64(expected.Min.Y-dstpanel.Rect.Min.Y))),
+					math.Max(math.Abs(float64(expected.Max.X-dstpanel.Rect.Max.X)), math.Abs(float64(expected.Max.Y-dstpanel.Rect.Max.Y)))); dist > tolerance {
+					flag = "panel moved by " + ftoa(dist/me.Data.PxCm, 1) + "cm"
+				}
+			}
+			if !area.Rect.In(me.Data.PanelsTree.Rect) {
+				flag = strings.TrimPrefix(flag+", off the sheet", ", ")
+			}
+			ret.Areas[dstpidx], ret.Flags[dstpidx] = append(ret.Areas[dstpidx], area), append(ret.Flags[dstpidx], flag)
+		}
+	}
+	return &ret
+}
+
+// accepts the `textCarry()` result, flagged areas only if `withFlagged`: saving is up to the caller
+func (me *SheetVer) textCarryApply(withFlagged bool) (numAreas int) {
+	carry := me.textCarry()
+	if carry == nil {
+		return 0
+	}
+	textrects := make([][]ImgPanelArea, len(carry.Areas))
+	for pidx, areas := range carry.Areas {
+		for i, area := range areas {
+			if withFlagged || carry.Flags[pidx][i] == "" {
+				textrects[pidx], numAreas = append(textrects[pidx], area), numAreas+1
+			}
+		}
+	}
+	if numAreas > 0 {
+		App.Proj.dataMu.Lock()
+		App.Proj.data.Sv.textRects[me.ID] = textrects
+		App.Proj.dataMu.Unlock()
+		App.Proj.txtJournal(me.ID)
+	}
+	return
+}
+
+// per panel, the detected (but not yet accepted) text-area rects not overlapping any existing ones
+func (me *SheetVer) textAreaSuggestions() (ret [][]image.Rectangle) {
+	me.textAreaSuggs.Lock()
+	defer me.textAreaSuggs.Unlock()
+	if me.textAreaSuggs.bwFilePath != me.Data.BwFilePath {
+		file, err := os.Open(me.Data.BwFilePath)
+		if err != nil {
+			panic(err)
+		}
+		img, _, err := image.Decode(file)
+		_ = file.Close()
+		if err != nil {
+			panic(err)
+		}
+		me.textAreaSuggs.bwFilePath, me.textAreaSuggs.panels = me.Data.BwFilePath, nil
+		imggray := imgToGray(img) // not necessarily decoding as `*image.Gray`, eg. if recompressed
+		me.Data.PanelsTree.each(func(panel *ImgPanel) {
+			me.textAreaSuggs.panels = append(me.textAreaSuggs.panels, panel.detectTextAreas(imggray, me.Data.PxCm))
+		})
+	}
+	for pidx, suggs := range me.textAreaSuggs.panels {
+		var rects []image.Rectangle
+		for _, sugg := range suggs {
+			var taken bool
+			for _, area := range me.panelAreas(pidx) {
+				if taken = area.Rect.Overlaps(sugg); taken {
+					break
+				}
+			}
+			if !taken {
+				rects = append(rects, sugg)
+			}
+		}
+		ret = append(ret, rects)
+	}
+	return
+}
+
 func (me *SheetVer) hasFaceAreas() (ret bool) {
 	var pidx int
 	me.Data.PanelsTree.each(func(p *ImgPanel) {
@@ -640,7 +1014,7 @@ func (me *SheetVer) haveAnyTexts(lang string) bool {
 	for _, areas := range App.Proj.data.Sv.textRects[me.ID] {
 		for _, area := range areas {
 			for data_lang, text := range area.Data {
-				if trim(text) != "" && (lang == "" || data_lang == lang) {
+				if trim(text) != "" && !area.Drafts[data_lang] && (lang == "" || data_lang == lang) {
 					return true
 				}
 			}
@@ -682,52 +1056,10 @@ func (me *SheetVer) genTextSvgForPanel(panelIdx int, panel *ImgPanel, lang strin
 	pw, ph := panel.Rect.Dx(), panel.Rect.Dy()
 	s := "<svg viewbox='0 0 " + itoa(pw) + " " + itoa(ph) + "'>"
 	for tidx, pta := range panelareas {
-		rx, ry, rw, rh := pta.Rect.Min.X-panel.Rect.Min.X, pta.Rect.Min.Y-panel.Rect.Min.Y, pta.Rect.Dx(), pta.Rect.Dy()
+		rx, ry := pta.Rect.Min.X-panel.Rect.Min.X, pta.Rect.Min.Y-panel.Rect.Min.Y
 		borderandfill := (pta.PointTo != nil)
 		if borderandfill {
-			rpx, rpy := pta.PointTo.X-panel.Rect.Min.X, pta.PointTo.Y-panel.Rect.Min.Y
-			mmh, cmh := int(me.Data.PxCm*me.parentSheet.parentChapter.GenPanelSvgText.BoxPolyStrokeWidthCm), int(me.Data.PxCm/2.0)
-			pl, pr, pt, pb := (rx + mmh), ((rx + rw) - mmh), (ry + mmh), ((ry + rh) - mmh)
-			poly := [][2]int{{pl, pt}, {pr, pt}, {pr, pb}, {pl, pb}}
-			ins := func(idx int, pts ...[2]int) {
-				head, tail := poly[:idx], poly[idx:]
-				poly = append(head, append(pts, tail...)...)
-			}
-
-			isBalloon := !(pta.PointTo.X == 0 && pta.PointTo.Y == 0)
-			if isBalloon {
-				dx, dy := intAbs(rpx-(rx+(rw/2))), intAbs(rpy-(ry+(rh/2)))
-				isr, isb := rpx > (rx+(rw/2)), rpy > (ry+(rh/2))
-				isl, ist, dst := !isr, !isb, [2]int{rpx, rpy}
-
-				isbr := isb && isr && dy > dx
-				isbl := isb && isl && dy > dx
-				istr := ist && isr && dy > dx
-				istl := ist && isl && dy > dx
-				isrb := isr && isb && dx > dy && !isbr
-				islb := isl && isb && dx > dy
-				isrt := isr && ist && dx > dy
-				islt := isl && ist && dx > dy
-
-				if isbl || islb {
-					ins(3, [2]int{pl + cmh, pb}, dst)
-				} else if isbr || isrb {
-					ins(3, dst, [2]int{pr - cmh, pb})
-				} else if istr {
-					ins(1, [2]int{pr - cmh, pt}, dst)
-				} else if istl {
-					ins(1, dst, [2]int{pl + cmh, pt})
-				} else if isrt {
-					ins(2, dst, [2]int{pr, pt + cmh})
-				} else if isrb {
-					ins(2, [2]int{pr, pb - cmh}, dst)
-				} else if islt {
-					ins(4, [2]int{pl, pt + cmh}, dst)
-				} else if islb {
-					ins(4, dst, [2]int{pl, pb - cmh})
-				}
-			}
-
+			poly, mmh, isBalloon := me.panelAreaBoxPoly(panel, &pta)
 			s += "<polygon points='"
 			for _, pt := range poly {
 				s += itoa(pt[0]) + "," + itoa(pt[1]) + " "
@@ -742,12 +1074,65 @@ func (me *SheetVer) genTextSvgForPanel(panelIdx int, panel *ImgPanel, lang strin
 	return s
 }
 
+// for text areas with a `PointTo`: the outline (relative to the panel) of the
+// box or, if `PointTo` isn't 0,0, the balloon (box plus tail) around the text
+func (me *SheetVer) panelAreaBoxPoly(panel *ImgPanel, pta *ImgPanelArea) (poly [][2]int, strokeWidth int, isBalloon bool) {
+	rx, ry, rw, rh := pta.Rect.Min.X-panel.Rect.Min.X, pta.Rect.Min.Y-panel.Rect.Min.Y, pta.Rect.Dx(), pta.Rect.Dy()
+	rpx, rpy := pta.PointTo.X-panel.Rect.Min.X, pta.PointTo.Y-panel.Rect.Min.Y
+	mmh, cmh := int(me.Data.PxCm*me.parentSheet.parentChapter.GenPanelSvgText.BoxPolyStrokeWidthCm), int(me.Data.PxCm/2.0)
+	pl, pr, pt, pb := (rx + mmh), ((rx + rw) - mmh), (ry + mmh), ((ry + rh) - mmh)
+	poly, strokeWidth = [][2]int{{pl, pt}, {pr, pt}, {pr, pb}, {pl, pb}}, mmh
+	ins := func(idx int, pts ...[2]int) {
+		head, tail := poly[:idx], poly[idx:]
+		poly = append(head, append(pts, tail...)...)
+	}
+
+	isBalloon = !(pta.PointTo.X == 0 && pta.PointTo.Y == 0)
+	if isBalloon {
+		dx, dy := intAbs(rpx-(rx+(rw/2))), intAbs(rpy-(ry+(rh/2)))
+		isr, isb := rpx > (rx+(rw/2)), rpy > (ry+(rh/2))
+		isl, ist, dst := !isr, !isb, [2]int{rpx, rpy}
+
+		isbr := isb && isr && dy > dx
+		isbl := isb && isl && dy > dx
+		istr := ist && isr && dy > dx
+		istl := ist && isl && dy > dx
+		isrb := isr && isb && dx > dy && !isbr
+		islb := isl && isb && dx > dy
+		isrt := isr && ist && dx > dy
+		islt := isl && ist && dx > dy
+
+		if isbl || islb {
+			ins(3, [2]int{pl + cmh, pb}, dst)
+		} else if isbr || isrb {
+			ins(3, dst, [2]int{pr - cmh, pb})
+		} else if istr {
+			ins(1, [2]int{pr - cmh, pt}, dst)
+		} else if istl {
+			ins(1, dst, [2]int{pl + cmh, pt})
+		} else if isrt {
+			ins(2, dst, [2]int{pr, pt + cmh})
+		} else if isrb {
+			ins(2, [2]int{pr, pb - cmh}, dst)
+		} else if islt {
+			ins(4, [2]int{pl, pt + cmh}, dst)
+		} else if islb {
+			ins(4, dst, [2]int{pl, pb - cmh})
+		}
+	}
+	return
+}
+
 func (me *SheetVer) genTextSvgForPanelArea(pidx int, tidx int, pta *ImgPanelArea, lang string, forHtml bool, forEbook bool, isBorderAndFill bool) string {
-	linex := 0.0
+	linex, fontSizeCmA4, perLineDyCmA4 := me.panelAreaTextSizes(pta)
+	return me.imgSvgText(pidx, tidx, pta, lang, int(linex), fontSizeCmA4, perLineDyCmA4, forHtml, forEbook, isBorderAndFill)
+}
+
+func (me *SheetVer) panelAreaTextSizes(pta *ImgPanelArea) (lineX float64, fontSizeCmA4 float64, perLineDyCmA4 float64) {
 	if pta.PointTo != nil {
-		linex = me.Data.PxCm * me.parentSheet.parentChapter.GenPanelSvgText.BoxPolyDxCmA4
+		lineX = me.Data.PxCm * me.parentSheet.parentChapter.GenPanelSvgText.BoxPolyDxCmA4
 	}
-	fontSizeCmA4, perLineDyCmA4 := me.parentSheet.parentChapter.GenPanelSvgText.FontSizeCmA4, me.parentSheet.parentChapter.GenPanelSvgText.PerLineDyCmA4
+	fontSizeCmA4, perLineDyCmA4 = me.parentSheet.parentChapter.GenPanelSvgText.FontSizeCmA4, me.parentSheet.parentChapter.GenPanelSvgText.PerLineDyCmA4
 	if me.parentSheet.parentChapter.GenPanelSvgText.FontSizeCmA4 > 0.01 { // !=0 in float
 		fontSizeCmA4 = me.parentSheet.parentChapter.GenPanelSvgText.FontSizeCmA4
 	}
@@ -761,7 +1146,7 @@ func (me *SheetVer) genTextSvgForPanelArea(pidx int, tidx int, pta *ImgPanelArea
 	if pta.SvgTextTspanStyleAttr == "_storytitle" {
 		perLineDyCmA4 *= 1.23
 	}
-	return me.imgSvgText(pidx, tidx, pta, lang, int(linex), fontSizeCmA4, perLineDyCmA4, forHtml, forEbook, isBorderAndFill)
+	return
 }
 
 func (me *SheetVerData) pxBounds() (ret image.Rectangle) {
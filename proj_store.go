@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	storeBakDirPath     = ".bak"
+	storeBakNumKeep     = 44
+	storeBakTimeFormat  = "20060102-150405.000"
+	storeBakDataMinAge  = 10 * time.Minute // `_data.json` gets saved after most every prep step, so not every save gets a snapshot
+	storeDataFileName   = "_data.json"
+	storeTxtFileName    = "_txt.json"
+	storeTxtJournalPath = "_txt.wal"
+)
+
+// one line in `_txt.wal`: the full new text areas of one sheet version
+// (`nil` for removal), or with `Op` "relink", the move of `SvID` to `NewSvID`,
+// or with `Op` "panels", its manually edited `PanelsTree` along with its text areas
+type StoreTxtJournalEntry struct {
+	Dt               int64
+	Op               string `json:",omitempty"`
+	SvID             string
+	NewSvID          string           `json:",omitempty"`
+	Areas            [][]ImgPanelArea `json:",omitempty"`
+	PanelsTree       *ImgPanel        `json:",omitempty"`
+	PanelsTreePinned bool             `json:",omitempty"`
+}
+
+// writes `fileName` atomically and durably, after snapshotting the version it replaces into
+// `.bak/` (unless unchanged or the newest snapshot is younger than `minAge`)
+func storeSave(fileName string, obj Any, minAge time.Duration) {
+	data, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	if olddata, err := os.ReadFile(fileName); err == nil && len(olddata) > 0 && !bytes.Equal(olddata, data) {
+		if snapshots := storeSnapshots(fileName); len(snapshots) == 0 || time.Since(storeSnapshotTime(fileName, snapshots[0])) >= minAge {
+			storeSnapshot(fileName, olddata)
+		}
+	}
+	storeFileWrite(fileName, data)
+}
+
+// unlike `fileWrite`, also fsyncs both the file and (for the rename) its dir before returning
+func storeFileWrite(fileName string, data []byte) {
+	tmpfilename := fileName + "." + strconv.FormatInt(time.Now().UnixNano(), 36)
+	file, err := os.OpenFile(tmpfilename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, os.ModePerm)
+	if err == nil {
+		if _, err = file.Write(data); err == nil {
+			err = file.Sync()
+		}
+		if errclose := file.Close(); err == nil {
+			err = errclose
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmpfilename, fileName)
+	}
+	if err != nil {
+		_ = os.Remove(tmpfilename)
+		panic(err)
+	}
+	if dir, err := os.Open(filepath.Dir(fileName)); err == nil { // so the rename itself survives a crash
+		_ = dir.Sync()
+		_ = dir.Close()
+	}
+}
+
+func storeSnapshot(fileName string, data []byte) {
+	mkDir(storeBakDirPath)
+	fileWrite(filepath.Join(storeBakDirPath, fileName+"."+time.Now().Format(storeBakTimeFormat)), data)
+	if snapshots := storeSnapshots(fileName); len(snapshots) > storeBakNumKeep {
+		for _, snapshot := range snapshots[storeBakNumKeep:] {
+			_ = os.Remove(filepath.Join(storeBakDirPath, snapshot))
+		}
+	}
+}
+
+// the file names (not paths) of `fileName`'s snapshots in `.bak/`, newest first
+func storeSnapshots(fileName string) (ret []string) {
+	entries, _ := os.ReadDir(storeBakDirPath)
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasPrefix(name, fileName+".") && !storeSnapshotTime(fileName, name).IsZero() {
+			ret = append(ret, name)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ret)))
+	return
+}
+
+func storeSnapshotTime(fileName string, snapshotName string) time.Time {
+	dt, _ := time.ParseInLocation(storeBakTimeFormat, strings.TrimPrefix(snapshotName, fileName+"."), time.Local)
+	return dt
+}
+
+// to be called right after (and by whoever) changing `App.Proj.data.Sv.textRects[svID]`,
+// before the next (full) `_txt.json` save: appends to `_txt.wal`, replayed on `load`
+func (me *Project) txtJournal(svIDs ...string) {
+	me.dataMu.Lock()
+	defer me.dataMu.Unlock()
+	var buf bytes.Buffer
+	for _, svid := range svIDs {
+		buf.WriteString(toJsonStr(StoreTxtJournalEntry{Dt: time.Now().UnixNano(), SvID: svid, Areas: me.data.Sv.textRects[svid]}) + "\n")
+	}
+	me.txtJournalAppend(buf.Bytes())
+}
+
+func (me *Project) txtJournalRelink(oldSvID string, newSvID string) {
+	me.dataMu.Lock()
+	defer me.dataMu.Unlock()
+	me.txtJournalAppend([]byte(toJsonStr(StoreTxtJournalEntry{Dt: time.Now().UnixNano(), Op: "relink", SvID: oldSvID, NewSvID: newSvID}) + "\n"))
+}
+
+// the `editPanelsTree` counterpart to `txtJournal`: as the text areas were just re-assigned to
+// the new panels, both must be replayed together (the panels tree being kept in `_data.json`)
+func (me *Project) txtJournalPanels(svID string, panelsTree *ImgPanel, pinned bool) {
+	me.dataMu.Lock()
+	defer me.dataMu.Unlock()
+	me.txtJournalAppend([]byte(toJsonStr(StoreTxtJournalEntry{Dt: time.Now().UnixNano(), Op: "panels", SvID: svID, Areas: me.data.Sv.textRects[svID],
+		PanelsTree: panelsTree, PanelsTreePinned: pinned}) + "\n"))
+}
+
+func (*Project) txtJournalAppend(data []byte) {
+	file, err := os.OpenFile(storeTxtJournalPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	if _, err = file.Write(data); err != nil {
+		panic(err)
+	} else if err = file.Sync(); err != nil {
+		panic(err)
+	}
+}
+
+// applies all `_txt.wal` entries to the just-loaded `textRects` (and panels trees): a torn last
+// line (from a crash mid-append) is skipped, as it never got followed by a full save
+func (me *Project) txtJournalReplay() (numReplayed int, numPanelsTrees int) {
+	file, err := os.Open(storeTxtJournalPath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		var entry StoreTxtJournalEntry
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) == 0 {
+			continue
+		} else if err := json.Unmarshal(line, &entry); err != nil {
+			printLn(storeTxtJournalPath+": skipping unreadable entry:", err.Error())
+			continue
+		}
+		if numReplayed++; entry.Op == "panels" {
+			if svdata := me.data.Sv.ById[entry.SvID]; svdata != nil {
+				svdata.PanelsTree, svdata.PanelsTreePinned, numPanelsTrees = entry.PanelsTree, entry.PanelsTreePinned, numPanelsTrees+1
+				if svdata.DirPath != "" { // its panel pics etc. may predate the edit, so re-prep from scratch
+					rmDir(svdata.DirPath)
+				}
+			}
+		}
+		switch {
+		case entry.Op == "relink":
+			if areas, ok := me.data.Sv.textRects[entry.SvID]; ok {
+				me.data.Sv.textRects[entry.NewSvID] = areas
+				delete(me.data.Sv.textRects, entry.SvID)
+			}
+		case entry.Areas == nil:
+			delete(me.data.Sv.textRects, entry.SvID)
+		default:
+			me.data.Sv.textRects[entry.SvID] = entry.Areas
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		printLn(storeTxtJournalPath+":", err.Error())
+	}
+	return
+}
+
+// (re)loads `_txt.json`, then replays (and folds in) any `_txt.wal` left over from a crash
+func (me *Project) txtLoad() {
+	me.dataMu.Lock()
+	defer me.dataMu.Unlock()
+	me.data.Sv.textRects = map[string][][]ImgPanelArea{}
+	if fileStat(storeTxtFileName) != nil {
+		jsonLoad(storeTxtFileName, nil, &me.data.Sv.textRects)
+	}
+	if numreplayed, numpanelstrees := me.txtJournalReplay(); numreplayed > 0 {
+		printLn("Replayed " + itoa(numreplayed) + " unsaved text edit(s) from " + storeTxtJournalPath)
+		if numpanelstrees > 0 {
+			storeSave(storeDataFileName, &me.data, storeBakDataMinAge)
+		}
+		me.txtSave()
+	}
+}
+
+// callers hold `me.dataMu`: the full `_txt.json` save, after which the journal is obsolete
+func (me *Project) txtSave() {
+	storeSave(storeTxtFileName, me.data.Sv.textRects, 0)
+	if err := os.Remove(storeTxtJournalPath); err != nil && !os.IsNotExist(err) {
+		panic(err)
+	}
+}
+
+// the `restore` action: without args, lists the `_txt.json` snapshots; with one
+// arg (list number or snapshot file name), rolls `_txt.json` back to that snapshot
+func projRestore(flags map[string]bool) {
+	snapshots := storeSnapshots(storeTxtFileName)
+	if len(flags) == 0 {
+		printLn("Snapshots of " + storeTxtFileName + " in " + storeBakDirPath + "/ (newest first), restore one via: restore <number>")
+		for i, snapshot := range snapshots {
+			var textrects map[string][][]ImgPanelArea
+			jsonLoad(filepath.Join(storeBakDirPath, snapshot), nil, &textrects)
+			var numareas int
+			for _, panels := range textrects {
+				for _, areas := range panels {
+					numareas += len(areas)
+				}
+			}
+			printLn("\t"+itoa(1+i)+"\t"+storeSnapshotTime(storeTxtFileName, snapshot).Format("2006-01-02 15:04:05"), "\t"+itoa(len(textrects))+" sheets, "+itoa(numareas)+" text areas")
+		}
+		return
+	}
+	var snapshot string
+	for arg := range flags {
+		if snapshot != "" {
+			panic("restore: expected one snapshot number or file name")
+		}
+		if snapshot = filepath.Base(arg); indexOf(snapshots, snapshot) < 0 {
+			if idx, err := strconv.Atoi(arg); err == nil && idx > 0 && idx <= len(snapshots) {
+				snapshot = snapshots[idx-1]
+			} else {
+				panic("restore: no such snapshot: " + arg)
+			}
+		}
+	}
+
+	var textrects map[string][][]ImgPanelArea
+	data := fileRead(filepath.Join(storeBakDirPath, snapshot))
+	jsonLoad("", data, &textrects)
+	App.Proj.dataMu.Lock()
+	defer App.Proj.dataMu.Unlock()
+	App.Proj.data.Sv.textRects = textrects
+	App.Proj.txtSave() // also snapshots the current `_txt.json`, so the restore itself can be undone
+	printLn("Restored " + storeTxtFileName + " from " + snapshot)
+}
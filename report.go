@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// problems encountered during load, prep, gen etc. get collected here (per
+// series / chapter / sheet) instead of aborting the whole process: the GUI
+// start view and CLI actions then show what went wrong and what was skipped
+type Report struct {
+	mu      sync.Mutex
+	entries []ReportEntry
+}
+
+type ReportEntry struct {
+	Stage   string
+	Series  *Series
+	Chapter *Chapter
+	Sheet   *Sheet
+	Ver     *SheetVer
+	Msg     string
+	Dt      time.Time
+}
+
+func (me *ReportEntry) String() (s string) {
+	s = "[" + me.Stage + "]"
+	if me.Series != nil {
+		s += " " + me.Series.Name
+	}
+	if me.Chapter != nil {
+		s += "/" + me.Chapter.Name
+	}
+	if me.Ver != nil {
+		s += " (" + me.Ver.FileName + ")"
+	} else if me.Sheet != nil {
+		s += "/" + me.Sheet.name
+	}
+	return s + ":\t" + me.Msg
+}
+
+// `at` is nil or a `*Series`, `*Chapter`, `*Sheet` or `*SheetVer` (parents get filled in)
+func (me *Report) add(stage string, at Any, err Any) {
+	entry := ReportEntry{Stage: stage, Msg: fmt.Sprintf("%v", err), Dt: time.Now()}
+	switch it := at.(type) {
+	case *SheetVer:
+		entry.Ver, entry.Sheet = it, it.parentSheet
+	case *Sheet:
+		entry.Sheet = it
+	case *Chapter:
+		entry.Chapter = it
+	case *Series:
+		entry.Series = it
+	}
+	if entry.Sheet != nil {
+		entry.Chapter = entry.Sheet.parentChapter
+	}
+	if entry.Chapter != nil {
+		entry.Series = entry.Chapter.parentSeries
+	}
+	printLn("[ERR]\t" + entry.String())
+
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.entries = append(me.entries, entry)
+}
+
+// to be `defer`red: recovers from any panic by reporting it (and then calling onErr, if any)
+func (me *Report) catch(stage string, at Any, onErr func()) {
+	if err := recover(); err != nil {
+		me.add(stage, at, err)
+		if onErr != nil {
+			onErr()
+		}
+	}
+}
+
+// forgets all entries of the specified stages, usually right before re-running those
+func (me *Report) reset(stages ...string) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	entries := me.entries[:0]
+	for _, entry := range me.entries {
+		if indexOf(stages, entry.Stage) < 0 {
+			entries = append(entries, entry)
+		}
+	}
+	me.entries = entries
+}
+
+// all entries concerning the specified series and chapter (either or both may be nil for "any")
+func (me *Report) of(series *Series, chapter *Chapter) (ret []ReportEntry) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for _, entry := range me.entries {
+		if (series == nil || entry.Series == nil || entry.Series == series) &&
+			(chapter == nil || entry.Chapter == nil || entry.Chapter == chapter) {
+			ret = append(ret, entry)
+		}
+	}
+	return
+}
+
+func (me *Report) print() (numEntries int) {
+	entries := me.of(nil, nil)
+	if numEntries = len(entries); numEntries > 0 {
+		printLn("\n" + itoa(numEntries) + " problem(s) reported:")
+		for _, entry := range entries {
+			printLn("\t" + entry.String())
+		}
+	}
+	return
+}
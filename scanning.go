@@ -3,17 +3,29 @@ package main
 import (
 	"fmt"
 	"html"
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	"maps"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	_ "golang.org/x/image/tiff"
 )
 
 var (
-	scanJob         *ScanJob
-	scanJobNotice   string
+	scanQueue struct {
+		sync.Mutex
+		jobs    []*ScanJob // in the order queued, finished ones kept (for their status) until dismissed
+		running bool
+	}
 	scanDevices     []*ScanDevice
+	scanLastOpts    = map[string]map[string]string{} // per device ident, as most recently queued via the scan form
 	saneDefaultArgs = []string{
 		"--format=pnm",
 		"--buffer-size=" + strconv.FormatInt(128* /*expects in KB*/ 1024, 10),
@@ -49,8 +61,23 @@ type ScanDevice struct {
 	Model   string
 	Type    string
 	Options []ScanOption
+
+	backend ScanBackend
+	url     string // for eSCL devices, the base URL as configured in cx.json's `Scan.Escl`
+}
+
+// a way of driving scanners: SANE's `scanimage` CLI, or eSCL (aka AirScan) over HTTP
+type ScanBackend interface {
+	// the devices found, with their options
+	detect() []*ScanDevice
+	// scans per `sj` into files named `filePathPrefix` + page number (from 1) + format extension, returned in page order
+	scan(sj *ScanJob, filePathPrefix string) []string
 }
 
+var scanBackends = []ScanBackend{scanBackendSane{}, scanBackendEscl{}}
+
+type scanBackendSane struct{}
+
 func (me *ScanDevice) String() string {
 	return fmt.Sprintf("[%d] %s (%s %s, type '%s')", me.Nr, me.Ident, me.Vendor, me.Model, me.Type)
 }
@@ -65,140 +92,523 @@ type ScanOption struct {
 	Inactive    bool
 }
 
+// a named set of scan settings in cx.json's `Scan.Profiles`, selectable in the scan form
+type ScanProfile struct {
+	Dev        string            // device ident, as listed in the scan form, eg. "test" or "genesys:libusb:001:004"
+	Opts       map[string]string // `scanimage` option values by option name, overriding the device defaults
+	Batch      bool              `json:",omitempty"`
+	BatchCount int               `json:",omitempty"`
+}
+
+// how a sheet version got scanned, recorded into its `SheetVerData` when its PNG is written
+type ScanInfo struct {
+	Profile string            `json:",omitempty"`
+	Dev     string            // device ident
+	Opts    map[string]string // all option values as passed to `scanimage`
+	Dt      int64             // unix-nano time of the scan
+}
+
+// one queued `scanimage` run: a single sheet, or (if `Batch`) as many as the device's
+// document feeder delivers, each becoming its own `ScanJobSheet`
 type ScanJob struct {
-	Id          string
-	Series      *Series
-	Chapter     *Chapter
-	PnmFileName string
+	Id            string
+	Series        *Series
+	Chapter       *Chapter
+	Dev           *ScanDevice
+	Opts          map[string]string
+	Profile       string // name of the `ScanProfile` picked in the scan form, if any
+	SheetName     string // with any run of '#' standing for the next free sheet number in the chapter, eg. "p##"
+	SheetVerName  string
+	Preview       bool // a quick low-res scan of the whole bed into .ccache, for picking a crop in the scan form (then `applyCrop`ed onto the real scan, `optsUncropped` keeping the rest)
+	Batch         bool // `scanimage --batch` for document feeders
+	BatchCount    int  // if `Batch`, stop after this many sheets instead of once the feeder runs empty
+	State         string
+	Err           string
+	Sheets        []*ScanJobSheet
+	optsUncropped map[string]string // `Opts` from before `applyCrop`, as remembered in `scanLastOpts` (the crop being for this one sheet only)
+}
+
+type ScanJobSheet struct {
+	RawFileName string // as written by the `ScanBackend`
 	PngFileName string
-	Dev         *ScanDevice
-	Opts        map[string]string
+	Done        bool
+	Err         string
 }
 
+const (
+	scanJobQueued     = "queued"
+	scanJobScanning   = "scanning"
+	scanJobConverting = "converting"
+	scanJobDone       = "done"
+	scanJobFailed     = "failed"
+)
+
 func scanDevicesDetection() {
 	timedLogged("", func() string {
 		scanDevices = nil
 		var sds []*ScanDevice
-		cmd := exec.Command("scanimage", "--formatted-device-list",
-			`,{"Vendor": "%v", "Model": "%m", "Type": "%t", "Ident": "%d", "Nr": %i}`)
-		data, err := cmd.CombinedOutput()
+		for _, backend := range scanBackends {
+			func() {
+				defer App.Report.catch("scan", nil, nil) // eg. no SANE set up shouldn't keep eSCL devices from being usable
+				sds = append(sds, backend.detect()...)
+			}()
+		}
+		scanDevices = sds
+		return itoa(len(scanDevices)) + " scanner(s) detected in"
+	})
+}
+
+func (me scanBackendSane) detect() (sds []*ScanDevice) {
+	cmd := exec.Command("scanimage", "--formatted-device-list",
+		`,{"Vendor": "%v", "Model": "%m", "Type": "%t", "Ident": "%d", "Nr": %i}`)
+	data, err := cmd.CombinedOutput()
+	if err != nil {
+		panic(err.Error() + ": " + string(data))
+	}
+	dataprefix := []byte(`[{"Vendor": "sane-project.org", "Model": "sane-test", "Type": "sim", "Ident": "test", "Nr": -1}`)
+	jsonLoad("", append(dataprefix, append(data, ']')...), &sds)
+
+	prefcat, prefdesc, prefspec := "  ", "        ", "    -"
+	for _, sd := range sds {
+		if sd.Ident, sd.backend = trim(sd.Ident), me; sd.Ident == "" || html.EscapeString(sd.Ident) != sd.Ident {
+			panic(fmt.Sprintf("TODO prep code for previously unexpected scandev ident format:\t%#v", sd.Ident))
+		}
+		cmdargs := append(saneDefaultArgs, "--device-name", sd.Ident, "--all-options")
+		if sd.Ident == "test" {
+			cmdargs = append(cmdargs, "--enable-test-options")
+		}
+		cmd := exec.Command("scanimage", cmdargs...)
+		data, err = cmd.CombinedOutput()
 		if err != nil {
 			panic(err.Error() + ": " + string(data))
 		}
-		dataprefix := []byte(`[{"Vendor": "sane-project.org", "Model": "sane-test", "Type": "sim", "Ident": "test", "Nr": -1}`)
-		jsonLoad("", append(dataprefix, append(data, ']')...), &sds)
-
-		prefcat, prefdesc, prefspec := "  ", "        ", "    -"
-		for _, sd := range sds {
-			if sd.Ident = trim(sd.Ident); sd.Ident == "" || html.EscapeString(sd.Ident) != sd.Ident {
-				panic(fmt.Sprintf("TODO prep code for previously unexpected scandev ident format:\t%#v", sd.Ident))
+		var cat string
+		var opt ScanOption
+		next := func() {
+			if opt.Name != "" {
+				sd.Options = append(sd.Options, opt)
 			}
-			cmdargs := append(saneDefaultArgs, "--device-name", sd.Ident, "--all-options")
-			if sd.Ident == "test" {
-				cmdargs = append(cmdargs, "--enable-test-options")
+			opt = ScanOption{Category: cat}
+		}
+		for _, ln := range strings.Split(string(data), "\n") {
+			// this exact ordering of the `if` tests matters here
+			if strings.HasPrefix(ln, prefdesc) {
+				opt.Description = append(opt.Description, trim(ln))
+			} else if strings.HasPrefix(ln, prefspec) {
+				next()
+				ln = trim(ln[len(prefspec):])
+				idx := strings.IndexFunc(ln, func(r rune) bool {
+					return !(r == '-' || (r >= 'a' && r <= 'z'))
+				})
+				opt.Name, opt.IsButton = strings.TrimLeft(ln, "-"), cat == "Buttons:"
+				if idx > 0 {
+					opt.Name = strings.TrimLeft(ln[:idx], "-")
+					opt.FormatInfo = trim(ln[idx:])
+					opt.Inactive = strings.HasSuffix(opt.FormatInfo, " [inactive]")
+					opt.IsToggle = strings.HasPrefix(opt.FormatInfo, "[=(") && strings.Contains(opt.FormatInfo, "yes|no)]")
+				} else {
+					opt.IsToggle = true
+				}
+			} else if strings.HasPrefix(ln, prefcat) {
+				next()
+				cat = trim(ln)
 			}
-			cmd := exec.Command("scanimage", cmdargs...)
-			data, err = cmd.CombinedOutput()
-			if err != nil {
-				panic(err.Error() + ": " + string(data))
+		}
+		next()
+	}
+	return
+}
+
+// queues `job` and kicks off the queue runner, unless already running
+func scanJobEnqueue(job *ScanJob) {
+	scanQueue.Lock()
+	defer scanQueue.Unlock()
+	job.State, scanQueue.jobs = scanJobQueued, append(scanQueue.jobs, job)
+	if !job.Preview {
+		scanLastOpts[job.Dev.Ident] = job.Opts
+		if job.optsUncropped != nil {
+			scanLastOpts[job.Dev.Ident] = job.optsUncropped
+		}
+	}
+	if !scanQueue.running {
+		scanQueue.running = true
+		go scanQueueRun()
+	}
+}
+
+// runs queued jobs one after another (the scanners being the bottleneck), while their
+// PNM-to-PNG conversions proceed in the background
+func scanQueueRun() {
+	for {
+		var job *ScanJob
+		scanQueue.Lock()
+		for _, sj := range scanQueue.jobs {
+			if sj.State == scanJobQueued {
+				job = sj
+				break
 			}
-			var cat string
-			var opt ScanOption
-			next := func() {
-				if opt.Name != "" {
-					sd.Options = append(sd.Options, opt)
-				}
-				opt = ScanOption{Category: cat}
+		}
+		if scanQueue.running = (job != nil); job != nil {
+			job.State = scanJobScanning
+		}
+		scanQueue.Unlock()
+		if job == nil {
+			return
+		}
+		scanJobDo(job)
+	}
+}
+
+// whether any scan job is still queued, scanning or converting
+func scanQueueBusy() bool {
+	scanQueue.Lock()
+	defer scanQueue.Unlock()
+	for _, sj := range scanQueue.jobs {
+		if sj.State != scanJobDone && sj.State != scanJobFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// the jobs of `chapter` (or all if `nil`), copied to be safe to render while they progress
+func scanQueueJobs(chapter *Chapter) (ret []ScanJob) {
+	scanQueue.Lock()
+	defer scanQueue.Unlock()
+	for _, sj := range scanQueue.jobs {
+		if chapter == nil || sj.Chapter == chapter {
+			job := *sj
+			job.Sheets = nil
+			for _, sheet := range sj.Sheets {
+				job.Sheets = append(job.Sheets, &ScanJobSheet{sheet.RawFileName, sheet.PngFileName, sheet.Done, sheet.Err})
 			}
-			for _, ln := range strings.Split(string(data), "\n") {
-				// this exact ordering of the `if` tests matters here
-				if strings.HasPrefix(ln, prefdesc) {
-					opt.Description = append(opt.Description, trim(ln))
-				} else if strings.HasPrefix(ln, prefspec) {
-					next()
-					ln = trim(ln[len(prefspec):])
-					idx := strings.IndexFunc(ln, func(r rune) bool {
-						return !(r == '-' || (r >= 'a' && r <= 'z'))
-					})
-					opt.Name, opt.IsButton = strings.TrimLeft(ln, "-"), cat == "Buttons:"
-					if idx > 0 {
-						opt.Name = strings.TrimLeft(ln[:idx], "-")
-						opt.FormatInfo = trim(ln[idx:])
-						opt.Inactive = strings.HasSuffix(opt.FormatInfo, " [inactive]")
-						opt.IsToggle = strings.HasPrefix(opt.FormatInfo, "[=(") && strings.Contains(opt.FormatInfo, "yes|no)]")
-					} else {
-						opt.IsToggle = true
-					}
-				} else if strings.HasPrefix(ln, prefcat) {
-					next()
-					cat = trim(ln)
-				}
+			ret = append(ret, job)
+		}
+	}
+	return
+}
+
+// forgets the finished (done or failed) jobs of `chapter`
+func scanQueueDismiss(chapter *Chapter) {
+	scanQueue.Lock()
+	defer scanQueue.Unlock()
+	jobs := scanQueue.jobs[:0]
+	for _, sj := range scanQueue.jobs {
+		if sj.Chapter != chapter || (sj.State != scanJobDone && sj.State != scanJobFailed) {
+			jobs = append(jobs, sj)
+		} else if sj.Preview {
+			for _, sheet := range sj.Sheets {
+				_ = os.Remove(sheet.PngFileName)
 			}
-			next()
 		}
-		scanDevices = sds
-		return itoa(len(scanDevices)) + " scanner(s) detected in"
-	})
+	}
+	scanQueue.jobs = jobs
 }
 
-func scanJobDo() {
-	sj := scanJob
+func scanJobDo(sj *ScanJob) {
+	filepathprefix := "/dev/shm/csg" + sj.Id + "_"
 	defer func() {
-		scanJob = nil
 		if err := recover(); err != nil {
-			_ = os.Remove(sj.PnmFileName)
-			_ = os.Remove(sj.PngFileName)
-			scanJobNotice = "[" + sj.PngFileName + "] " + fmt.Sprintf("%v", err)
+			if matches, _ := filepath.Glob(filepathprefix + "*"); len(matches) > 0 {
+				for _, match := range matches {
+					_ = os.Remove(match)
+				}
+			}
+			scanQueue.Lock()
+			sj.State, sj.Err = scanJobFailed, fmt.Sprintf("%v", err)
+			scanQueue.Unlock()
+			App.Report.add("scan", sj.Chapter, err)
 		}
 	}()
-	for _, fname := range []string{sj.PngFileName, sj.PnmFileName} {
-		_ = os.Remove(fname)
-	}
 
+	var rawfilepaths []string
 	timedLogged("SheetScan: from "+sj.Dev.Ident+"...", func() string {
-		cmd := exec.Command("scanimage", append(saneDefaultArgs,
-			"--device-name="+sj.Dev.Ident,
-			"--output-file="+sj.PnmFileName,
-		)...)
-		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
-		for name, val := range sj.Opts {
-			var isBtn bool
-			for _, opt := range sj.Dev.Options {
-				if opt.Name == name {
-					isBtn = opt.IsButton
-				}
-			}
-			if (!isBtn) || val == "yes" {
-				cmd.Args = append(cmd.Args, "--"+name+sIf(isBtn, "", "="+val))
-			}
+		rawfilepaths = sj.Dev.backend.scan(sj, filepathprefix)
+		return "for " + itoa(len(rawfilepaths)) + " page(s)"
+	})
+
+	scanQueue.Lock()
+	for _, rawfilepath := range rawfilepaths {
+		pngfilename := ".ccache/.scanpreview." + sj.Id + ".png"
+		if !sj.Preview {
+			pngfilename = scanSheetFileName(sj.Chapter, sj.SheetName, sj.SheetVerName)
 		}
-		printLn("\n\n\nSCANNING via command:\n" + strings.Join(cmd.Args, " ") + "\n\n")
-		if err := cmd.Start(); err != nil {
-			panic(fmt.Errorf("%v %v", err, cmd.Args))
+		sj.Sheets = append(sj.Sheets, &ScanJobSheet{RawFileName: rawfilepath, PngFileName: pngfilename})
+	}
+	sj.State = scanJobConverting
+	scanQueue.Unlock()
+	printLn("SheetScan: " + itoa(len(sj.Sheets)) + " sheet(s) scanned, background PNG conversion kicked off.")
+
+	go func() {
+		var work sync.WaitGroup
+		slots := make(chan bool, prepMaxJobs())
+		for _, sheet := range sj.Sheets {
+			work.Add(1)
+			slots <- true
+			go func(sheet *ScanJobSheet) {
+				defer func() { <-slots; work.Done() }()
+				scanJobSheetConvert(sj, sheet)
+			}(sheet)
 		}
-		if err := cmd.Wait(); err != nil {
-			panic(fmt.Errorf("%v %v", err, cmd.Args))
+		work.Wait()
+		scanQueue.Lock()
+		defer scanQueue.Unlock()
+		sj.State = scanJobDone
+		for _, sheet := range sj.Sheets {
+			if sheet.Err != "" {
+				sj.State, sj.Err = scanJobFailed, itoa(len(sj.Sheets))+" sheet(s) scanned, but not all converted"
+			}
 		}
-		return "for " + sj.PnmFileName
-	})
-
-	scanJobNotice = "scan completed, background PNG conversion kicked off."
-	printLn(scanJobNotice)
+	}()
+}
 
+func (scanBackendSane) scan(sj *ScanJob, filePathPrefix string) (ret []string) {
+	cmd := exec.Command("scanimage", append(saneDefaultArgs,
+		"--device-name="+sj.Dev.Ident,
+		"--batch="+filePathPrefix+"%d.pnm",
+	)...)
+	if !sj.Batch {
+		cmd.Args = append(cmd.Args, "--batch-count=1")
+	} else if sj.BatchCount > 0 {
+		cmd.Args = append(cmd.Args, "--batch-count="+itoa(sj.BatchCount))
+	}
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	for name, val := range sj.Opts {
+		var isBtn bool
+		for _, opt := range sj.Dev.Options {
+			if opt.Name == name {
+				isBtn = opt.IsButton
+			}
+		}
+		if (!isBtn) || val == "yes" {
+			cmd.Args = append(cmd.Args, "--"+name+sIf(isBtn, "", "="+val))
+		}
+	}
+	printLn("\n\n\nSCANNING via command:\n" + strings.Join(cmd.Args, " ") + "\n\n")
+	if err := cmd.Start(); err != nil {
+		panic(fmt.Errorf("%v %v", err, cmd.Args))
+	}
+	// with `--batch`, a feeder running empty is how the run normally ends, so only no pages at all is failure
+	if err := cmd.Wait(); err != nil && fileStat(filePathPrefix+"1.pnm") == nil {
+		panic(fmt.Errorf("%v %v", err, cmd.Args))
+	}
 	time.Sleep(time.Second) // rarely, the PNM isn't fully there yet
-	pnmfilename, pngfilename := sj.PnmFileName, sj.PngFileName
-	go timedLogged("SheetScan: converting to "+pngfilename+"...", func() string {
+	for i := 1; fileStat(filePathPrefix+itoa(i)+".pnm") != nil; i++ {
+		ret = append(ret, filePathPrefix+itoa(i)+".pnm")
+	}
+	return
+}
+
+func scanJobSheetConvert(sj *ScanJob, sheet *ScanJobSheet) {
+	rawfilename, pngfilename := sheet.RawFileName, sheet.PngFileName
+	timedLogged("SheetScan: converting to "+pngfilename+"...", func() string {
+		defer App.Report.catch("scan", sj.Chapter, func() {
+			_ = os.Remove(pngfilename)
+			scanQueue.Lock()
+			sheet.Err = "conversion failed, see report"
+			scanQueue.Unlock()
+		})
 		pngfile, err := os.Create(pngfilename)
 		if err != nil {
 			panic(pngfilename + ": " + err.Error())
 		}
-		pnmfile, err := os.Open(pnmfilename)
+		rawfile, err := os.Open(rawfilename)
 		if err != nil {
-			panic(pnmfilename + ": " + err.Error())
+			panic(rawfilename + ": " + err.Error())
+		}
+		if sj.Preview { // as-is, so that preview px map straight to scan-bed mm
+			imgScanToPng(rawfile, pngfile, false, 0, 0, 0, 0)
+			_ = os.Remove(rawfilename)
+			scanQueue.Lock()
+			sheet.Done = true
+			scanQueue.Unlock()
+			return "for preview"
+		}
+		// snipping off the edge artifacts of `scanimage` flatbed scans, unless cropped to a region
+		_, issane := sj.Dev.backend.(scanBackendSane)
+		issnip := issane && sj.Opts["x"] == "" && sj.Opts["y"] == ""
+		imgScanToPng(rawfile, pngfile, true, 0, 0, iIf(issnip, 399, 0), iIf(issnip, 99, 0))
+		_ = os.Remove(rawfilename)
+		if opts := &App.Proj.Sheets.Deskew; opts.Auto {
+			if deg, crop, ok := imgDeskewPngFile(pngfilename, pngfilename, scanPxCm(sj.Opts["resolution"]), opts); !ok {
+				App.Report.add("scan", sj.Chapter, pngfilename+": no outer panel borders found for deskewing, left as scanned")
+			} else {
+				printLn("SheetScan: deskewed " + pngfilename + " by " + ftoa(deg, 2) + "°, cropped to " + crop.String())
+			}
 		}
-		imgPnmToPng(pnmfile, pngfile, true, 0, 0, 399, 99)
-		_ = os.Remove(pnmfilename)
+		scanRecord(sj, pngfilename)
+		scanQueue.Lock()
+		sheet.Done = true
+		scanQueue.Unlock()
 		// go pngOptFireAndForget(pngfilename)
 		return "for " + pngfilename
 	})
 }
+
+// pre-registers the `SheetVerData` of the freshly written scan at `pngFileName` (keyed by
+// content hash, just like `Project.load` will once it picks up the file), so that it carries
+// its `ScanInfo` and the true `PxCm` instead of the width-based guess in `ensurePrep`
+func scanRecord(sj *ScanJob, pngFileName string) {
+	opts := make(map[string]string, len(sj.Opts))
+	for k, v := range sj.Opts {
+		opts[k] = v
+	}
+	scanRecordInfo(pngFileName, fIf(sj.Opts["resolution"] == "", 0, scanPxCm(sj.Opts["resolution"])),
+		&ScanInfo{Profile: sj.Profile, Dev: sj.Dev.Ident, Opts: opts, Dt: time.Now().UnixNano()})
+}
+
+// see scanRecord, also used for inbox imports (`pxCm` may be 0 if not known)
+func scanRecordInfo(pngFileName string, pxCm float64, info *ScanInfo) {
+	id := contentHashStr(fileRead(pngFileName))
+	App.Proj.dataMu.Lock()
+	if App.Proj.data.Sv.ById[id] == nil {
+		App.Proj.data.Sv.ById[id] = &SheetVerData{PxCm: pxCm, Scan: info}
+	}
+	App.Proj.dataMu.Unlock()
+	App.Proj.save(false)
+}
+
+// the option values to prefill the scan form with for device `devIdent`: the built-in
+// `saneDevDefaults`, then cx.json's `Scan.DevDefaults`, then the options last used with
+// that device in this session, then those of `profile` if it is for that device
+func scanDevOptDefaults(devIdent string, profile *ScanProfile) map[string]string {
+	scanQueue.Lock() // guards `scanLastOpts`
+	defer scanQueue.Unlock()
+	ret := map[string]string{}
+	for _, defaults := range []map[string]string{saneDevDefaults[""], saneDevDefaults[devIdent],
+		App.Proj.Scan.DevDefaults[""], App.Proj.Scan.DevDefaults[devIdent], scanLastOpts[devIdent]} {
+		for k, v := range defaults {
+			ret[k] = v
+		}
+	}
+	if profile != nil && profile.Dev == devIdent {
+		for k, v := range profile.Opts {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// the option names not to show in the scan form for device `devIdent`
+func scanDevOptsDontShow(devIdent string) []string {
+	return append(append(append(append([]string{}, saneDevDontShow[devIdent]...), saneDevDontShow[""]...),
+		App.Proj.Scan.DevDontShow[devIdent]...), App.Proj.Scan.DevDontShow[""]...)
+}
+
+// turns `sj` into a preview job: whole bed, no batch, at cx.json's `Scan.PreviewDpi` (or 75dpi)
+func (me *ScanJob) toPreview() {
+	me.Preview, me.Batch, me.SheetName = true, false, "preview"
+	for _, name := range []string{"l", "t", "x", "y"} {
+		delete(me.Opts, name)
+	}
+	me.Opts["resolution"] = itoa(iIf(App.Proj.Scan.PreviewDpi > 0, App.Proj.Scan.PreviewDpi, 75)) + "dpi"
+}
+
+// applies to `sj.Opts` the "left,top,width,height" (in mm, as picked on a preview) of `crop`,
+// as SANE's (and `scanBackendEscl`'s) geometry options "l", "t", "x" & "y", where the device has them
+func (me *ScanJob) applyCrop(crop string) {
+	if parts := strings.Split(crop, ","); len(parts) == 4 {
+		me.optsUncropped = maps.Clone(me.Opts)
+		for i, name := range []string{"l", "t", "x", "y"} {
+			for _, opt := range me.Dev.Options {
+				if v, err := strconv.ParseFloat(trim(parts[i]), 64); opt.Name == name && err == nil && v >= 0 && !opt.Inactive {
+					me.Opts[name] = ftoa(v, 1)
+				}
+			}
+		}
+	}
+}
+
+// the file path for the next sheet scanned into `chapter`: `sheetName` taken literally unless it
+// contains a run of '#', which then becomes the lowest sheet number (zero-padded to the run's length)
+// above all those in use, whether by the chapter's loaded sheets, its scans dir or pending scan jobs.
+// The caller holds `scanQueue`'s lock, so that concurrent batches don't grab the same number.
+func scanSheetFileName(chapter *Chapter, sheetName string, sheetVerName string) string {
+	dirpath := filepath.Join("scans", chapter.parentSeries.Name, chapter.Name)
+	idx := strings.IndexByte(sheetName, '#')
+	if idx < 0 {
+		return filepath.Join(dirpath, sheetName+"."+sheetVerName+".png")
+	}
+	numdigits := len(sheetName[idx:]) - len(strings.TrimLeft(sheetName[idx:], "#"))
+	prefix, suffix := sheetName[:idx], sheetName[idx+numdigits:]
+	var maxnum int
+	use := func(name string) {
+		if strings.HasPrefix(name, prefix) && strings.HasSuffix(name, suffix) && len(name) > len(prefix)+len(suffix) {
+			if num, err := strconv.Atoi(name[len(prefix) : len(name)-len(suffix)]); err == nil && num > maxnum {
+				maxnum = num
+			}
+		}
+	}
+	for _, sheet := range chapter.sheets {
+		use(sheet.name)
+	}
+	if entries, err := os.ReadDir(dirpath); err == nil {
+		for _, entry := range entries {
+			if fext := scanFileExt(entry.Name()); fext != "" {
+				name := strings.TrimPrefix(strings.TrimSuffix(entry.Name(), fext), scanNormPrefix)
+				if idx := strings.LastIndexByte(name, '.'); idx > 0 {
+					use(name[:idx])
+				}
+			}
+		}
+	}
+	for _, sj := range scanQueue.jobs {
+		for _, sheet := range sj.Sheets {
+			if name := strings.TrimSuffix(filepath.Base(sheet.PngFileName), ".png"); strings.IndexByte(name, '.') > 0 {
+				use(name[:strings.LastIndexByte(name, '.')])
+			}
+		}
+	}
+	num := itoa(maxnum + 1)
+	for len(num) < numdigits {
+		num = "0" + num
+	}
+	return filepath.Join(dirpath, prefix+num+suffix+"."+sheetVerName+".png")
+}
+
+// px per cm for a scan job's "resolution" option value (eg. "600dpi" or "600"), defaulting to 1200dpi
+func scanPxCm(resolution string) float64 {
+	if dpi := atoi(strings.TrimSuffix(resolution, "dpi"), 0, 9600); dpi > 0 {
+		return float64(dpi) / 2.54
+	}
+	return dpi1200
+}
+
+// sheet files in `scans/SERIES/CHAPTER` other than PNGs get converted (once, and again
+// whenever changed) to a sibling PNG of this prefix, which then serves as their `FileName`
+const scanNormPrefix = "norm."
+
+// the (lower-cased) extension if `fileName` is of a supported scan format, else ""
+func scanFileExt(fileName string) string {
+	switch ext := strings.ToLower(filepath.Ext(fileName)); ext {
+	case ".png", ".tif", ".tiff", ".jpg", ".jpeg":
+		return sIf(ext == ".tiff", ".tif", sIf(ext == ".jpeg", ".jpg", ext))
+	}
+	return ""
+}
+
+// ensures the PNG at `dstFileName` is up to date with the scan at `srcFileName`, keeping
+// 16-bit depth (for imgGrayDistrs) and grayness (for file size) where the source has them
+func scanNormalized(srcFileName string, dstFileName string, srcFileInfo os.FileInfo) {
+	if dstfileinfo := fileStat(dstFileName); dstfileinfo != nil && dstfileinfo.ModTime().After(srcFileInfo.ModTime()) {
+		return
+	}
+	file, err := os.Open(srcFileName)
+	if err != nil {
+		panic(err)
+	}
+	img, _, err := image.Decode(file)
+	_ = file.Close()
+	if err != nil {
+		panic(srcFileName + ": " + err.Error())
+	}
+	switch img.(type) {
+	case *image.Gray, *image.Gray16, *image.RGBA, *image.NRGBA, *image.RGBA64, *image.NRGBA64:
+	default: // eg. JPEG's YCbCr or CMYK, or paletted or anything else: all 8-bit
+		rgba := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+		draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+		img = rgba
+	}
+	printLn("Normalizing " + srcFileName + " to " + dstFileName + "...")
+	fileWrite(dstFileName, pngEncode(img))
+}
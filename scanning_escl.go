@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// eSCL (aka AirScan, Mopria) network scanners, as listed in cx.json's `Scan.Escl`: driverless,
+// so usable without SANE set up. Any HTTP server speaking the protocol will do, incl. a local stand-in.
+type scanBackendEscl struct{}
+
+// the eSCL `ColorMode`s for the SANE-style "mode" values shared with `saneDevDefaults` & profiles
+var esclColorModes = map[string]string{"Gray": "Grayscale8", "Color": "RGB24", "Lineart": "BlackAndWhite1"}
+
+// the parts of `GET /ScannerCapabilities` of interest here (namespaces ignored)
+type esclCaps struct {
+	MakeAndModel string
+	Manufacturer string
+	Platen       *struct {
+		Caps esclInputCaps `xml:"PlatenInputCaps"`
+	}
+	Adf *struct {
+		Caps esclInputCaps `xml:"AdfSimplexInputCaps"`
+	}
+}
+
+type esclInputCaps struct {
+	MaxWidth  int // in 300ths of an inch
+	MaxHeight int // in 300ths of an inch
+	Profiles  []struct {
+		ColorModes         []string `xml:"ColorModes>ColorMode"`
+		DocumentFormats    []string `xml:"DocumentFormats>DocumentFormat"`
+		DocumentFormatsExt []string `xml:"DocumentFormats>DocumentFormatExt"`
+		Resolutions        []int    `xml:"SupportedResolutions>DiscreteResolutions>DiscreteResolution>XResolution"`
+	} `xml:"SettingProfiles>SettingProfile"`
+}
+
+// the union of all setting profiles' color modes, document formats and resolutions (sorted)
+func (me *esclInputCaps) all() (colorModes []string, formats []string, resolutions []int) {
+	for _, profile := range me.Profiles {
+		for _, mode := range profile.ColorModes {
+			if !slices.Contains(colorModes, mode) {
+				colorModes = append(colorModes, mode)
+			}
+		}
+		for _, format := range append(profile.DocumentFormats, profile.DocumentFormatsExt...) {
+			if !slices.Contains(formats, format) {
+				formats = append(formats, format)
+			}
+		}
+		for _, res := range profile.Resolutions {
+			if !slices.Contains(resolutions, res) {
+				resolutions = append(resolutions, res)
+			}
+		}
+	}
+	slices.Sort(resolutions)
+	return
+}
+
+func (me scanBackendEscl) detect() (sds []*ScanDevice) {
+	for i, baseurl := range App.Proj.Scan.Escl {
+		func() {
+			defer App.Report.catch("scan", nil, nil) // one scanner being off shouldn't hide the others
+			baseurl = strings.TrimSuffix(baseurl, "/")
+			caps := esclCapabilities(baseurl)
+			u, err := url.Parse(baseurl)
+			if err != nil {
+				panic(err)
+			}
+			sd := &ScanDevice{Nr: 1000 + i, Ident: "escl:" + u.Host, Vendor: caps.Manufacturer, Model: caps.MakeAndModel, Type: "eSCL",
+				backend: me, url: baseurl}
+			if html.EscapeString(sd.Ident) != sd.Ident {
+				panic("unexpected eSCL host format: " + sd.Ident)
+			}
+			var sources, modes []string
+			var resolutions []int
+			for _, src := range []struct {
+				name string
+				caps *esclInputCaps
+			}{{"Flatbed", esclCapsOf(caps, false)}, {"ADF", esclCapsOf(caps, true)}} {
+				if src.caps == nil {
+					continue
+				}
+				sources = append(sources, src.name)
+				srcmodes, _, srcress := src.caps.all()
+				for _, mode := range srcmodes {
+					for name, escl := range esclColorModes {
+						if escl == mode {
+							mode = name
+						}
+					}
+					if !slices.Contains(modes, mode) {
+						modes = append(modes, mode)
+					}
+				}
+				for _, res := range srcress {
+					if !slices.Contains(resolutions, res) {
+						resolutions = append(resolutions, res)
+					}
+				}
+			}
+			if slices.Sort(resolutions); len(sources) == 0 || len(modes) == 0 || len(resolutions) == 0 {
+				panic(baseurl + ": no usable scan sources in ScannerCapabilities")
+			}
+			var strress []string
+			for _, res := range resolutions {
+				strress = append(strress, itoa(res))
+			}
+			cat := "eSCL:"
+			sd.Options = []ScanOption{
+				{Category: cat, Name: "source", FormatInfo: strings.Join(sources, "|") + " [" + sources[0] + "]",
+					Description: []string{"Flatbed (eSCL: Platen) or ADF (eSCL: Feeder), the latter for batch scans."}},
+				{Category: cat, Name: "mode", FormatInfo: strings.Join(modes, "|") + " [" + modes[0] + "]",
+					Description: []string{"Gray, Color and Lineart stand for eSCL's Grayscale8, RGB24 and BlackAndWhite1, other modes are passed as-is."}},
+				{Category: cat, Name: "resolution", FormatInfo: strings.Join(strress, "|") + "dpi [" + strress[len(strress)-1] + "]",
+					Description: []string{"Unsupported values get rounded down to the next supported one."}},
+			}
+			if inputcaps := esclCapsOf(caps, false); inputcaps != nil { // SANE-style geometry, eg. for preview crops
+				wmm, hmm := ftoa(float64(inputcaps.MaxWidth)*25.4/300, 1), ftoa(float64(inputcaps.MaxHeight)*25.4/300, 1)
+				for _, opt := range [][3]string{{"l", "0.." + wmm + "mm [0]", "Top-left x position of scan area."}, {"t", "0.." + hmm + "mm [0]", "Top-left y position of scan area."},
+					{"x", "0.." + wmm + "mm [" + wmm + "]", "Width of scan area."}, {"y", "0.." + hmm + "mm [" + hmm + "]", "Height of scan area."}} {
+					sd.Options = append(sd.Options, ScanOption{Category: "Geometry:", Name: opt[0], FormatInfo: opt[1], Description: []string{opt[2]}})
+				}
+			}
+			sds = append(sds, sd)
+		}()
+	}
+	return
+}
+
+// the input caps for the Feeder (if `adf`) or the Platen, `nil` if the scanner has no such source
+func esclCapsOf(caps *esclCaps, adf bool) *esclInputCaps {
+	if adf && caps.Adf != nil && len(caps.Adf.Caps.Profiles) > 0 {
+		return &caps.Adf.Caps
+	} else if !adf && caps.Platen != nil && len(caps.Platen.Caps.Profiles) > 0 {
+		return &caps.Platen.Caps
+	}
+	return nil
+}
+
+func esclCapabilities(baseUrl string) (ret *esclCaps) {
+	data, _, status := esclDo("GET", baseUrl+"/ScannerCapabilities", nil, 11*time.Second)
+	if status != http.StatusOK {
+		panic(baseUrl + "/ScannerCapabilities: HTTP " + itoa(status))
+	}
+	ret = &esclCaps{}
+	if err := xml.Unmarshal(data, ret); err != nil {
+		panic(baseUrl + "/ScannerCapabilities: " + err.Error())
+	}
+	return
+}
+
+// one eSCL HTTP exchange: the response body, its Location header (for scan-job creation) & status code
+func esclDo(method string, reqUrl string, body []byte, timeout time.Duration) (respBody []byte, location string, status int) {
+	req, err := http.NewRequest(method, reqUrl, bytes.NewReader(body))
+	if err != nil {
+		panic(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/xml")
+	}
+	client := http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	defer resp.Body.Close()
+	if respBody, err = io.ReadAll(resp.Body); err != nil {
+		panic(err)
+	}
+	return respBody, resp.Header.Get("Location"), resp.StatusCode
+}
+
+func (scanBackendEscl) scan(sj *ScanJob, filePathPrefix string) (ret []string) {
+	baseurl := sj.Dev.url
+	caps := esclCapabilities(baseurl)
+	src := strings.ToLower(sj.Opts["source"])
+	isadf := strings.Contains(src, "adf") || strings.Contains(src, "feed")
+	inputcaps := esclCapsOf(caps, isadf)
+	if inputcaps == nil {
+		panic(errors.New(sj.Dev.Ident + ": no such source: " + sj.Opts["source"]))
+	}
+	colormodes, formats, resolutions := inputcaps.all()
+	if len(resolutions) == 0 {
+		panic(errors.New(sj.Dev.Ident + ": no resolutions in ScannerCapabilities"))
+	}
+	format := "image/png"
+	if !slices.Contains(formats, format) {
+		if format = "image/jpeg"; !slices.Contains(formats, format) {
+			panic(errors.New(sj.Dev.Ident + " offers neither PNG nor JPEG, but: " + strings.Join(formats, ", ")))
+		}
+	}
+	colormode := sIf(sj.Opts["mode"] == "", "Gray", sj.Opts["mode"])
+	if escl := esclColorModes[colormode]; escl != "" {
+		colormode = escl
+	}
+	if !slices.Contains(colormodes, colormode) {
+		panic(errors.New(sj.Dev.Ident + ": unsupported mode " + colormode + ", use one of: " + strings.Join(colormodes, ", ")))
+	}
+	res, wantres := resolutions[0], atoi(strings.TrimSuffix(sj.Opts["resolution"], "dpi"), 0, 9600)
+	for _, r := range resolutions {
+		if r <= wantres || wantres == 0 {
+			res = r
+		}
+	}
+	scanQueue.Lock() // for `scanPxCm` & `ScanInfo`, the resolution actually used
+	sj.Opts["resolution"] = itoa(res) + "dpi"
+	scanQueue.Unlock()
+
+	// the scan region, in 300ths of an inch: all of the source unless cropped (see `ScanJob.applyCrop`)
+	region := [4]int{0, 0, inputcaps.MaxWidth, inputcaps.MaxHeight}
+	for i, name := range []string{"l", "t", "x", "y"} {
+		if mm, err := strconv.ParseFloat(strings.TrimSuffix(sj.Opts[name], "mm"), 64); err == nil && mm >= 0 {
+			region[i] = int(mm * 300 / 25.4)
+		}
+	}
+	region[2], region[3] = min(region[2], inputcaps.MaxWidth-region[0]), min(region[3], inputcaps.MaxHeight-region[1])
+
+	settings := `<?xml version="1.0" encoding="UTF-8"?>
+<scan:ScanSettings xmlns:scan="http://schemas.hp.com/imaging/escl/2011/05/03" xmlns:pwg="http://www.pwg.org/schemas/2010/12/sm">
+	<pwg:Version>2.0</pwg:Version>
+	<pwg:ScanRegions><pwg:ScanRegion>
+		<pwg:ContentRegionUnits>escl:ThreeHundredthsOfInches</pwg:ContentRegionUnits>
+		<pwg:XOffset>` + itoa(region[0]) + `</pwg:XOffset><pwg:YOffset>` + itoa(region[1]) + `</pwg:YOffset>
+		<pwg:Width>` + itoa(region[2]) + `</pwg:Width><pwg:Height>` + itoa(region[3]) + `</pwg:Height>
+	</pwg:ScanRegion></pwg:ScanRegions>
+	<pwg:InputSource>` + sIf(isadf, "Feeder", "Platen") + `</pwg:InputSource>
+	<scan:ColorMode>` + colormode + `</scan:ColorMode>
+	<scan:XResolution>` + itoa(res) + `</scan:XResolution><scan:YResolution>` + itoa(res) + `</scan:YResolution>
+	<pwg:DocumentFormat>` + format + `</pwg:DocumentFormat><scan:DocumentFormatExt>` + format + `</scan:DocumentFormatExt>
+</scan:ScanSettings>`
+	printLn("\n\n\nSCANNING via eSCL:\n" + baseurl + " @ " + itoa(res) + "dpi " + colormode + " from " + sIf(isadf, "Feeder", "Platen") + "\n\n")
+
+	// a Platen job delivers one page, so batches from it are that many jobs, while
+	// one Feeder job delivers pages until the feeder runs empty (or the batch is full)
+	numjobs, maxpages := 1, iIf(sj.Batch, sj.BatchCount, 1)
+	if sj.Batch && !isadf {
+		numjobs = max(1, sj.BatchCount)
+	}
+	for j := 0; j < numjobs; j++ {
+		_, location, status := esclDo("POST", baseurl+"/ScanJobs", []byte(settings), time.Minute)
+		if status != http.StatusCreated || location == "" {
+			panic(errors.New(baseurl + "/ScanJobs: HTTP " + itoa(status)))
+		}
+		joburl, err := url.Parse(baseurl + "/")
+		if err == nil {
+			joburl, err = joburl.Parse(location) // Location may be absolute or relative
+		}
+		if err != nil {
+			panic(err)
+		}
+		for numretries := 0; maxpages <= 0 || len(ret) < maxpages; {
+			data, _, status := esclDo("GET", strings.TrimSuffix(joburl.String(), "/")+"/NextDocument", nil, 11*time.Minute)
+			if status == http.StatusServiceUnavailable && numretries < 123 { // scanner still busy
+				numretries++
+				time.Sleep(time.Second)
+				continue
+			} else if status == http.StatusNotFound { // no more pages
+				break
+			} else if status != http.StatusOK {
+				panic(errors.New(joburl.String() + "/NextDocument: HTTP " + itoa(status)))
+			}
+			pagefilepath := filePathPrefix + itoa(1+len(ret)) + sIf(format == "image/png", ".png", ".jpg")
+			fileWrite(pagefilepath, data)
+			ret, numretries = append(ret, pagefilepath), 0
+		}
+		if !isadf || (maxpages > 0 && len(ret) >= maxpages) {
+			_, _, _ = esclDo("DELETE", joburl.String(), nil, 11*time.Second) // harmless if already done, frees the scanner if not
+		}
+	}
+	if len(ret) == 0 {
+		panic(errors.New(baseurl + ": no pages scanned"))
+	}
+	return
+}
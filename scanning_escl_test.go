@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const esclTestCaps = `<?xml version="1.0" encoding="UTF-8"?>
+<scan:ScannerCapabilities xmlns:scan="http://schemas.hp.com/imaging/escl/2011/05/03" xmlns:pwg="http://www.pwg.org/schemas/2010/12/sm">
+	<pwg:Version>2.63</pwg:Version>
+	<pwg:MakeAndModel>Acme ScanJet 1</pwg:MakeAndModel>
+	<scan:Manufacturer>Acme</scan:Manufacturer>
+	<scan:Platen><scan:PlatenInputCaps>
+		<scan:MaxWidth>2550</scan:MaxWidth><scan:MaxHeight>3508</scan:MaxHeight>
+		<scan:SettingProfiles><scan:SettingProfile>
+			<scan:ColorModes><scan:ColorMode>Grayscale8</scan:ColorMode><scan:ColorMode>RGB24</scan:ColorMode></scan:ColorModes>
+			<scan:DocumentFormats><pwg:DocumentFormat>image/jpeg</pwg:DocumentFormat><pwg:DocumentFormat>image/png</pwg:DocumentFormat></scan:DocumentFormats>
+			<scan:SupportedResolutions><scan:DiscreteResolutions>
+				<scan:DiscreteResolution><scan:XResolution>300</scan:XResolution><scan:YResolution>300</scan:YResolution></scan:DiscreteResolution>
+				<scan:DiscreteResolution><scan:XResolution>600</scan:XResolution><scan:YResolution>600</scan:YResolution></scan:DiscreteResolution>
+			</scan:DiscreteResolutions></scan:SupportedResolutions>
+		</scan:SettingProfile></scan:SettingProfiles>
+	</scan:PlatenInputCaps></scan:Platen>
+</scan:ScannerCapabilities>`
+
+// a stand-in eSCL scanner with one page on its platen: detection, then a cropped batch scan
+// (one job, its `NextDocument` giving that page and then 404 for no more pages)
+func TestScanBackendEscl(t *testing.T) {
+	page := []byte("\x89PNG\r\n\x1a\n(the scanned page)")
+	var mu sync.Mutex
+	var posted []byte
+	var numnextdocs int
+	var deleted bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.Method + " " + req.URL.Path {
+		case "GET /eSCL/ScannerCapabilities":
+			_, _ = io.WriteString(w, esclTestCaps)
+		case "POST /eSCL/ScanJobs":
+			posted, _ = io.ReadAll(req.Body)
+			w.Header().Set("Location", "/eSCL/ScanJobs/42")
+			w.WriteHeader(http.StatusCreated)
+		case "GET /eSCL/ScanJobs/42/NextDocument":
+			if numnextdocs++; numnextdocs == 1 {
+				_, _ = w.Write(page)
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case "DELETE /eSCL/ScanJobs/42":
+			deleted = true
+		default:
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL.Path)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+	App.Proj.Scan.Escl = []string{srv.URL + "/eSCL/"}
+	defer func() { App.Proj.Scan.Escl = nil }()
+
+	sds := scanBackendEscl{}.detect()
+	if len(sds) != 1 {
+		t.Fatalf("expected 1 device, got %d", len(sds))
+	}
+	sd := sds[0]
+	if sd.Ident != "escl:"+strings.TrimPrefix(srv.URL, "http://") || sd.Vendor != "Acme" || sd.Model != "Acme ScanJet 1" || sd.url != srv.URL+"/eSCL" {
+		t.Errorf("unexpected device: %+v", sd)
+	}
+	for name, formatinfo := range map[string]string{
+		"source":     "Flatbed [Flatbed]",
+		"mode":       "Gray|Color [Gray]",
+		"resolution": "300|600dpi [600]",
+		"l":          "0..215.9mm [0]",
+		"t":          "0..297.0mm [0]",
+		"x":          "0..215.9mm [215.9]",
+		"y":          "0..297.0mm [297.0]",
+	} {
+		var found bool
+		for _, opt := range sd.Options {
+			if found = (opt.Name == name); found {
+				if opt.FormatInfo != formatinfo {
+					t.Errorf("option %s: expected %q, got %q", name, formatinfo, opt.FormatInfo)
+				}
+				break
+			}
+		}
+		if !found {
+			t.Errorf("option %s: missing", name)
+		}
+	}
+
+	sj := &ScanJob{Dev: sd, Batch: true, Opts: map[string]string{"source": "Flatbed", "mode": "Gray", "resolution": "1200dpi", "l": "10", "t": "20", "x": "100", "y": "50"}}
+	fileprefix := filepath.Join(t.TempDir(), "scan")
+	files := sd.backend.scan(sj, fileprefix)
+	if len(files) != 1 || files[0] != fileprefix+"1.png" {
+		t.Fatalf("unexpected scanned files: %v", files)
+	}
+	if data, err := os.ReadFile(files[0]); err != nil || !bytes.Equal(data, page) {
+		t.Errorf("scanned page not as served: %q (%v)", data, err)
+	}
+	if sj.Opts["resolution"] != "600dpi" {
+		t.Errorf("expected resolution rounded down to 600dpi, got %s", sj.Opts["resolution"])
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, want := range []string{
+		"<pwg:InputSource>Platen</pwg:InputSource>",
+		"<scan:ColorMode>Grayscale8</scan:ColorMode>",
+		"<scan:XResolution>600</scan:XResolution>",
+		"<pwg:DocumentFormat>image/png</pwg:DocumentFormat>",
+		"<pwg:XOffset>118</pwg:XOffset><pwg:YOffset>236</pwg:YOffset>",
+		"<pwg:Width>1181</pwg:Width><pwg:Height>590</pwg:Height>",
+	} {
+		if !bytes.Contains(posted, []byte(want)) {
+			t.Errorf("ScanSettings lack %s:\n%s", want, posted)
+		}
+	}
+	if numnextdocs != 2 {
+		t.Errorf("expected NextDocument to be polled twice (page, then 404), got %d", numnextdocs)
+	}
+	if !deleted {
+		t.Errorf("expected the finished Platen job to be deleted")
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// held by the GUI's background `translateMissing` run, so one at a time
+var translateBusy sync.Mutex
+
+// a machine-translation backend: `dstTexts` has one entry per `srcTexts`
+// entry, an empty one meaning "no translation known" (not an error)
+type Translator interface {
+	Name() string
+	Translate(srcLang string, dstLang string, srcTexts []string) (dstTexts []string, err error)
+}
+
+// a LibreTranslate-compatible HTTP endpoint (`POST /translate`)
+type translatorHttp struct {
+	url    string
+	apiKey string
+}
+
+func (me *translatorHttp) Name() string { return me.url }
+
+func (me *translatorHttp) Translate(srcLang string, dstLang string, srcTexts []string) ([]string, error) {
+	req := map[string]Any{"q": srcTexts, "source": srcLang, "target": dstLang, "format": "text"}
+	if me.apiKey != "" {
+		req["api_key"] = me.apiKey
+	}
+	client := http.Client{Timeout: time.Minute}
+	resp, err := client.Post(me.url, "application/json", bytes.NewReader([]byte(toJsonStr(req))))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		TranslatedText []string
+		Error          string
+	}
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	} else if result.Error != "" || resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status + ": " + result.Error)
+	} else if len(result.TranslatedText) != len(srcTexts) {
+		return nil, errors.New("expected " + itoa(len(srcTexts)) + " translations but got " + itoa(len(result.TranslatedText)))
+	}
+	return result.TranslatedText, nil
+}
+
+// a JSON file of `{"<dstLang>": {"<srcText>": "<dstText>"}}`, tried on the
+// whole text first, then line by line (only if every non-empty line is known)
+type translatorGlossary struct {
+	filePath string
+	entries  map[string]map[string]string
+}
+
+func (me *translatorGlossary) Name() string { return me.filePath }
+
+func (me *translatorGlossary) Translate(srcLang string, dstLang string, srcTexts []string) ([]string, error) {
+	if me.entries == nil {
+		if fileStat(me.filePath) == nil {
+			return nil, errors.New("no such file: " + me.filePath)
+		}
+		me.entries = map[string]map[string]string{}
+		jsonLoad(me.filePath, nil, &me.entries)
+	}
+	glossary, ret := me.entries[dstLang], make([]string, len(srcTexts))
+	for i, srctext := range srcTexts {
+		if ret[i] = glossary[trim(srctext)]; ret[i] != "" {
+			continue
+		}
+		lines := strings.Split(srctext, "\n")
+		for j, line := range lines {
+			if line = trim(line); line != "" {
+				if lines[j] = glossary[line]; lines[j] == "" {
+					lines = nil
+					break
+				}
+			}
+		}
+		if lines != nil {
+			ret[i] = strings.Join(lines, "\n")
+		}
+	}
+	return ret, nil
+}
+
+// the backends configured in cx.json's `Translate`, glossary first
+func (me *Project) translators() (ret []Translator) {
+	if me.Translate.GlossaryFile != "" {
+		ret = append(ret, &translatorGlossary{filePath: me.Translate.GlossaryFile})
+	}
+	if me.Translate.Http.Url != "" {
+		ret = append(ret, &translatorHttp{url: me.Translate.Http.Url, apiKey: me.Translate.Http.ApiKey})
+	}
+	return
+}
+
+// pre-fills all empty `ImgPanelArea.Data[lang]` (of `sheetVer`, or if `nil` of all
+// sheets) from the default language via `me.translators()`, marked as `Drafts`: the
+// translators run outside `me.dataMu`, areas edited meanwhile are left alone
+func (me *Project) translateMissing(lang string, sheetVer *SheetVer) (numDrafted int) {
+	translators, at := me.translators(), Any(nil)
+	if sheetVer != nil {
+		at = sheetVer
+	}
+	if len(translators) == 0 {
+		panic("no translators configured in cx.json (Translate.GlossaryFile, Translate.Http.Url)")
+	}
+	type todo struct {
+		svID       string
+		pIdx, aIdx int
+	}
+	var todos []todo
+	var srctexts []string
+	me.dataMu.Lock()
+	for _, svid := range sortedMapKeys(me.data.Sv.textRects) {
+		if sheetVer != nil && sheetVer.ID != svid {
+			continue
+		}
+		for pidx, areas := range me.data.Sv.textRects[svid] {
+			for aidx, area := range areas {
+				if srctext := trim(area.Data[me.Langs[0]]); srctext != "" && trim(area.Data[lang]) == "" {
+					todos, srctexts = append(todos, todo{svid, pidx, aidx}), append(srctexts, area.Data[me.Langs[0]])
+				}
+			}
+		}
+	}
+	me.dataMu.Unlock()
+
+	dsttexts := make([]string, len(srctexts))
+	for _, translator := range translators {
+		var idxs []int
+		var pending []string
+		for i, dsttext := range dsttexts {
+			if dsttext == "" {
+				idxs, pending = append(idxs, i), append(pending, srctexts[i])
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		results, err := translator.Translate(me.Langs[0], lang, pending)
+		if err != nil {
+			App.Report.add("translate", at, translator.Name()+": "+err.Error())
+			continue
+		}
+		for i, idx := range idxs {
+			dsttexts[idx] = strings.TrimRight(results[i], "\n \t\r\v\b")
+		}
+	}
+
+	var svids []string
+	me.dataMu.Lock()
+	for i, todo := range todos {
+		if panels := me.data.Sv.textRects[todo.svID]; dsttexts[i] != "" && todo.pIdx < len(panels) && todo.aIdx < len(panels[todo.pIdx]) {
+			if area := &panels[todo.pIdx][todo.aIdx]; area.Data[me.Langs[0]] == srctexts[i] && trim(area.Data[lang]) == "" {
+				if len(svids) == 0 || svids[len(svids)-1] != todo.svID {
+					svids = append(svids, todo.svID)
+				}
+				if area.Drafts == nil {
+					area.Drafts = map[string]bool{}
+				}
+				area.Data[lang], area.Drafts[lang], numDrafted = dsttexts[i], true, numDrafted+1
+			}
+		}
+	}
+	me.dataMu.Unlock()
+	if numDrafted > 0 {
+		me.txtJournal(svids...)
+		me.save(true)
+	}
+	return
+}
+
+// the `translate` action: args optionally restrict the non-default languages to draft
+func projTranslate(flags map[string]bool) {
+	App.Report.reset("translate")
+	for _, lang := range App.Proj.Langs[1:] {
+		if len(flags) == 0 || flags[lang] {
+			timedLogged("Machine-translating missing '"+lang+"' texts...", func() string {
+				return "for " + itoa(App.Proj.translateMissing(lang, nil)) + " new draft(s)"
+			})
+		}
+	}
+}